@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/miekg/dns"
+
+	"github.com/natesales/q/output"
+	"github.com/natesales/q/transport"
+)
+
+// browser enumerates DNS-SD services, reusing records from earlier replies to avoid extra queries
+type browser struct {
+	txp     transport.Transport
+	records []dns.RR
+	queried map[dns.Question]bool
+}
+
+// find returns the records of a type at a name seen so far
+func (b *browser) find(name string, rrType uint16) []dns.RR {
+	var out []dns.RR
+	for _, rr := range b.records {
+		if rr.Header().Rrtype == rrType && strings.EqualFold(rr.Header().Name, name) {
+			out = append(out, rr)
+		}
+	}
+	return out
+}
+
+// lookup returns the records of a type at a name, querying the server unless they were included in an earlier reply.
+// PTR records are always queried since an earlier reply may only list some instances.
+func (b *browser) lookup(name string, rrType uint16) ([]dns.RR, error) {
+	name = dns.Fqdn(name)
+	question := dns.Question{Name: strings.ToLower(name), Qtype: rrType, Qclass: opts.Class}
+	if found := b.find(name, rrType); b.queried[question] || (rrType != dns.TypePTR && len(found) > 0) {
+		return found, nil
+	}
+	b.queried[question] = true
+
+	o := opts
+	o.Name = name
+	msg := createQuery(o, []uint16{rrType})[0]
+	log.Debugf("Browsing %s %s", name, dns.TypeToString[rrType])
+	reply, err := b.txp.Exchange(&msg)
+	if err != nil {
+		return nil, fmt.Errorf("querying %s %s: %s", name, dns.TypeToString[rrType], err)
+	}
+
+	for _, section := range [][]dns.RR{reply.Answer, reply.Ns, reply.Extra} {
+	next:
+		for _, rr := range section {
+			for _, existing := range b.records {
+				if dns.IsDuplicate(existing, rr) {
+					continue next
+				}
+			}
+			b.records = append(b.records, rr)
+		}
+	}
+	return b.find(name, rrType), nil
+}
+
+// browse enumerates the DNS-SD service types in a domain and resolves each of their instances
+func browse(txp transport.Transport, domain string) ([]*output.Service, error) {
+	b := &browser{txp: txp, queried: make(map[dns.Question]bool)}
+
+	ptrs, err := b.lookup("_services._dns-sd._udp."+dns.Fqdn(domain), dns.TypePTR)
+	if err != nil {
+		return nil, err
+	}
+
+	var services []*output.Service
+	for _, rr := range ptrs {
+		service := &output.Service{Type: rr.(*dns.PTR).Ptr}
+		services = append(services, service)
+
+		instances, err := b.lookup(service.Type, dns.TypePTR)
+		if err != nil {
+			log.Warnf("Browsing %s: %s", service.Type, err)
+			continue
+		}
+		for _, rr := range instances {
+			service.Instances = append(service.Instances, b.resolveInstance(rr.(*dns.PTR).Ptr))
+		}
+		sort.Slice(service.Instances, func(i, j int) bool {
+			return service.Instances[i].Name < service.Instances[j].Name
+		})
+	}
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].Type < services[j].Type
+	})
+
+	return services, nil
+}
+
+// resolveInstance looks up the SRV, TXT and address records of a service instance
+func (b *browser) resolveInstance(name string) *output.Instance {
+	instance := &output.Instance{Name: name}
+
+	srvs, err := b.lookup(name, dns.TypeSRV)
+	if err != nil {
+		log.Warnf("Resolving %s: %s", name, err)
+	}
+	if len(srvs) > 0 {
+		srv := srvs[0].(*dns.SRV)
+		instance.Host = srv.Target
+		instance.Port = srv.Port
+	}
+
+	txts, err := b.lookup(name, dns.TypeTXT)
+	if err != nil {
+		log.Debugf("Resolving %s: %s", name, err)
+	}
+	for _, rr := range txts {
+		for _, txt := range rr.(*dns.TXT).Txt {
+			if txt != "" {
+				instance.TXT = append(instance.TXT, txt)
+			}
+		}
+	}
+
+	if instance.Host != "" {
+		for _, rrType := range []uint16{dns.TypeA, dns.TypeAAAA} {
+			addrs, err := b.lookup(instance.Host, rrType)
+			if err != nil {
+				log.Debugf("Resolving %s: %s", instance.Host, err)
+			}
+			for _, rr := range addrs {
+				switch rr := rr.(type) {
+				case *dns.A:
+					instance.Addresses = append(instance.Addresses, rr.A.String())
+				case *dns.AAAA:
+					instance.Addresses = append(instance.Addresses, rr.AAAA.String())
+				}
+			}
+		}
+	}
+
+	return instance
+}
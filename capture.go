@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/miekg/dns"
+
+	"github.com/natesales/q/transport"
+	"github.com/natesales/q/util/dnstap"
+	"github.com/natesales/q/util/pcap"
+)
+
+// captureTransport writes each exchange with the wrapped transport to the dnstap and pcap outputs
+type captureTransport struct {
+	transport.Transport
+	transportType transport.Type
+	server        string
+}
+
+// wireRecorder is implemented by transports that keep the packed form of their last exchange
+type wireRecorder interface {
+	LastWire() transport.Wire
+}
+
+// capturing returns true if any capture output is enabled
+func capturing() bool {
+	return tapWriter != nil || pcapWriter != nil
+}
+
+// unwrapTransport returns the transport wrapped by a captureTransport, or txp itself
+func unwrapTransport(txp transport.Transport) transport.Transport {
+	if c, ok := txp.(*captureTransport); ok {
+		return c.Transport
+	}
+	return txp
+}
+
+func (c *captureTransport) Exchange(m *dns.Msg) (*dns.Msg, error) {
+	queryTime := time.Now()
+	reply, err := c.Transport.Exchange(m)
+	responseTime := time.Now()
+
+	// Capture the bytes as sent and received, or repack them for transports that don't record them
+	wire := c.LastWire()
+	if wire.Query == nil {
+		wire.Query, _ = m.Pack()
+		if reply != nil {
+			wire.Reply, _ = reply.Pack()
+		}
+	}
+	c.write(wire, queryTime, responseTime)
+
+	return reply, err
+}
+
+// ExchangeWire sends a packed query as is with the wrapped transport and captures it
+func (c *captureTransport) ExchangeWire(query []byte) ([]byte, error) {
+	w, ok := c.Transport.(transport.WireTransport)
+	if !ok {
+		return nil, transport.ErrWireUnsupported
+	}
+	queryTime := time.Now()
+	reply, err := w.ExchangeWire(query)
+	if errors.Is(err, transport.ErrWireUnsupported) {
+		return nil, err
+	}
+	c.write(transport.Wire{Query: query, Reply: reply}, queryTime, time.Now())
+	return reply, err
+}
+
+// LastWire returns the packed query and reply of the wrapped transport's last exchange, if it records them
+func (c *captureTransport) LastWire() transport.Wire {
+	if r, ok := c.Transport.(wireRecorder); ok {
+		return r.LastWire()
+	}
+	return transport.Wire{}
+}
+
+// write writes an exchange to the enabled capture outputs
+func (c *captureTransport) write(wire transport.Wire, queryTime, responseTime time.Time) {
+	if tapWriter != nil {
+		c.writeDnstap(wire.Query, wire.Reply, queryTime, responseTime)
+	}
+	if pcapWriter != nil {
+		c.writePcap(wire.Query, wire.Reply, queryTime, responseTime)
+	}
+}
+
+// openCaptures opens the dnstap and pcap outputs and returns a function that closes them
+func openCaptures() (func(), error) {
+	closeCaptures := func() {
+		if tapWriter != nil {
+			if err := tapWriter.Close(); err != nil {
+				log.Warnf("Closing dnstap output: %s", err)
+			}
+			tapWriter = nil
+		}
+		if pcapWriter != nil {
+			if err := pcapWriter.Close(); err != nil {
+				log.Warnf("Closing pcap output: %s", err)
+			}
+			pcapWriter = nil
+		}
+	}
+
+	var err error
+	if opts.Dnstap != "" {
+		tapWriter, err = dnstap.Open(opts.Dnstap)
+		if err != nil {
+			return nil, fmt.Errorf("opening dnstap output: %s", err)
+		}
+		tapWriter.Identity = "q"
+		tapWriter.Version = version
+	}
+	if opts.Pcap != "" {
+		pcapWriter, err = pcap.Create(opts.Pcap, "q "+version)
+		if err != nil {
+			closeCaptures()
+			return nil, fmt.Errorf("opening pcap output: %s", err)
+		}
+	}
+	return closeCaptures, nil
+}
@@ -33,13 +33,29 @@ type Flags struct {
 	ID               int           `long:"qid" description:"Set query ID (-1 for random)" default:"-1"`
 	BootstrapServer  string        `short:"b" long:"bootstrap-server" description:"DNS server to use for bootstrapping"`
 	BootstrapTimeout time.Duration `long:"bootstrap-timeout" description:"Bootstrapping timeout" default:"5s"`
+	Proxy            string        `long:"proxy" description:"Proxy for TCP based transports (http://, https://, socks5:// or socks5h:// for remote name resolution)"`
+	IPv4             bool          `short:"4" description:"Only connect to servers over IPv4"`
+	IPv6             bool          `short:"6" description:"Only connect to servers over IPv6"`
+	SourceIP         string        `long:"source-ip" description:"Source IP address for outgoing queries"`
+	SourcePort       int           `long:"source-port" description:"Source port for outgoing queries"`
+	Interface        string        `long:"interface" description:"Network interface to send queries from (Linux only)"`
 	Cookie           string        `long:"cookie" description:"EDNS0 cookie"`
 
 	// Special query modes
-	RecAXFR bool `long:"recaxfr" description:"Perform recursive AXFR"`
+	RecAXFR       bool   `long:"recaxfr" description:"Perform recursive AXFR"`
+	Browse        bool   `long:"browse" description:"Browse DNS-SD services in the domain (default: local)"`
+	Decode        string `long:"decode" description:"Decode and print a hex or base64url DNS message, or the dns parameter of a DoH URL"`
+	SendWire      string `long:"send-wire" description:"Send a hex or base64url DNS message as is instead of building queries"`
+	Interactive   bool   `short:"I" long:"interactive" description:"Read queries from an interactive prompt, keeping connections open between them"`
+	ListResolvers bool   `long:"list-resolvers" description:"List the public resolvers that can be used by name (e.g. @quad9 or @quad9/doq), or the --resolver-list entries"`
+	AllPublic     bool   `long:"all-public" description:"Query every resolver in the public resolver catalog"`
+	ResolverList  string `long:"resolver-list" description:"Resolver list in the dnscrypt-proxy public-resolvers.md format whose entries can be used by name"`
+	ResolverMatch string `long:"resolver-match" description:"Query every resolver in --resolver-list matching an expression over name, description, protocol, dnssec, nolog, nofilter and ipv6 (e.g. 'protocol == \"doh\" && nolog')"`
+	Stub          bool   `long:"stub" description:"Resolve like the system stub resolver, with the search list, ndots, attempts, timeout, rotate and every nameserver from --resolv-conf"`
+	ResolvConf    string `long:"resolv-conf" description:"Stub resolver configuration for finding the default server and --stub" default:"/etc/resolv.conf"`
 
 	// Output
-	Format         string `short:"f" long:"format" description:"Output format (pretty, column, json, yaml, raw)" default:"pretty"`
+	Format         string `short:"f" long:"format" description:"Output format (pretty, column, json, ndjson, yaml, csv, tsv, zone, template, raw, wire)" default:"pretty"`
 	PrettyTTLs     bool   `long:"pretty-ttls" description:"Format TTLs in human readable format (default: true)"`
 	ShortTTLs      bool   `long:"short-ttls" description:"Remove zero components of pretty TTLs. (24h0m0s->24h) (default: true)"`
 	Color          bool   `long:"color" description:"Enable color output"`
@@ -55,6 +71,21 @@ type Flags struct {
 	ValueOnly      bool   `short:"r" long:"short" description:"Show record values only"`
 	ResolveIPs     bool   `short:"R" long:"resolve-ips" description:"Resolve PTR records for IP addresses in A and AAAA records"`
 	RoundTTLs      bool   `long:"round-ttls" description:"Round TTLs to the nearest minute"`
+	Dnstap         string `long:"dnstap" description:"Write queries and responses as dnstap to a file, or to a Frame Streams socket with unix:/path"`
+	Pcap           string `long:"pcap" description:"Write queries and responses to a pcapng file"`
+	Template       string `long:"template" description:"Go text/template or template file executed for each server's results with the template format"`
+	ZoneTTL        bool   `long:"zone-ttl" description:"Write a $TTL directive with the most common TTL in zone output"`
+	RFC8427        bool   `long:"rfc8427" description:"Use the RFC 8427 representation of DNS messages in JSON and YAML output"`
+	Filter         string `long:"filter" description:"Only show RRs matching an expression over server, qname, qtype, rcode, section, owner, ttl, class, type and rdata (e.g. 'type == \"A\" && ttl < 300')"`
+	Select         string `long:"select" description:"Comma separated RR fields to show instead of whole records (e.g. rdata or owner,ttl)"`
+
+	// Offline decode
+	Read      string   `long:"read" description:"Read DNS messages from a pcap, pcapng or dnstap file instead of querying"`
+	ReadQname string   `long:"read-qname" description:"Only show messages read with --read for a name or its subdomains"`
+	ReadQtype []string `long:"read-qtype" description:"Only show messages read with --read with a question type"`
+	ReadRcode []string `long:"read-rcode" description:"Only show responses read with --read with an rcode (e.g. NXDOMAIN)"`
+	//lint:ignore SA5008 go-flags accepts multiple default values in the struct tag
+	ReadPort []uint16 `long:"read-port" description:"Ports to decode DNS from in pcap files read with --read" default:"53" default:"5353"`
 
 	// Header flags
 	AuthoritativeAnswer bool `long:"aa" description:"Set AA (Authoritative Answer) flag in query"`
@@ -76,11 +107,18 @@ type Flags struct {
 	TLSClientCertificate  string   `long:"tls-client-cert" description:"TLS client certificate file"`
 	TLSClientKey          string   `long:"tls-client-key" description:"TLS client key file"`
 	TLSKeyLogFile         string   `long:"tls-key-log-file" env:"SSLKEYLOGFILE" description:"TLS key log file"`
+	TLSSessionCache       bool     `long:"tls-session-cache" description:"Resume TLS sessions with a session ticket cache"`
+	TLSSessionFile        string   `long:"tls-session-file" description:"Persist TLS session tickets to a file (enables --tls-session-cache)"`
+
+	// ECH
+	ECH       bool   `long:"ech" description:"Use Encrypted Client Hello (ECH) with the config list from the server's HTTPS/SVCB record"`
+	ECHConfig string `long:"ech-config" description:"ECH config list (base64 or file path)"`
 
 	// HTTP
 	HTTPUserAgent string   `long:"http-user-agent" description:"HTTP user agent" default:""`
 	HTTPMethod    string   `long:"http-method" description:"HTTP method" default:"GET"`
 	HTTPHeaders   []string `long:"http-header" description:"HTTP header in format 'Name: Value'"`
+	HTTPJSON      bool     `long:"http-json" description:"Use the DoH JSON API (application/dns-json) instead of RFC 8484 wire format"`
 
 	PMTUD bool `long:"pmtud" description:"PMTU discovery (default: true)"`
 
@@ -92,6 +130,7 @@ type Flags struct {
 	//lint:ignore SA5008 go-flags accepts multiple default values in the struct tag
 	QUICALPNTokens   []string `long:"quic-alpn-tokens" description:"QUIC ALPN tokens" default:"doq" default:"doq-i11"`
 	QUICLengthPrefix bool     `long:"quic-length-prefix" description:"Add RFC 9250 compliant length prefix (default: true)"`
+	QUIC0RTT         bool     `long:"quic-0rtt" description:"Send DoQ queries as 0-RTT data when resuming a TLS session"`
 
 	// DNSCrypt
 	DNSCryptTCP       bool   `long:"dnscrypt-tcp" description:"Use TCP for DNSCrypt (default UDP)"`
@@ -99,6 +138,19 @@ type Flags struct {
 	DNSCryptPublicKey string `long:"dnscrypt-key" description:"DNSCrypt public key"`
 	DNSCryptProvider  string `long:"dnscrypt-provider" description:"DNSCrypt provider name"`
 
+	// Serve
+	ServeListen string `long:"serve-listen" description:"Address for q serve to listen on (UDP and TCP)" default:"127.0.0.1:5300"`
+	ServeCache  bool   `long:"serve-cache" description:"Cache replies in q serve"`
+	ServeLog    bool   `long:"serve-log" description:"Log each query forwarded by q serve"`
+
+	// Config file
+	Config  string `long:"config" description:"Config file with named servers and profiles (default: q/config.yaml in the user config directory)"`
+	Profile string `long:"profile" description:"Config file profile to apply"`
+
+	// mDNS
+	MDNSUnicast bool          `long:"mdns-qu" description:"Set the QU bit in mDNS queries to request unicast responses"`
+	MDNSTimeout time.Duration `long:"mdns-timeout" description:"Time to collect mDNS responses for" default:"2s"`
+
 	//lint:ignore SA5008 go-flags accepts multiple default values in the struct tag
 	DefaultRRTypes []string `long:"default-rr-types" description:"Default record types" default:"A" default:"AAAA" default:"NS" default:"MX" default:"TXT" default:"HTTPS" default:"CNAME"`
 
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"gopkg.in/yaml.v3"
+)
+
+// qConfig is the structured config file
+type qConfig struct {
+	// Defaults are flags applied to every query
+	Defaults argList `yaml:"defaults"`
+
+	// Servers are named servers, used as @name
+	Servers map[string]serverConfig `yaml:"servers"`
+
+	// Profiles are named bundles of flags and servers, selected with --profile
+	Profiles map[string]profileConfig `yaml:"profiles"`
+}
+
+// serverConfig is a named server and the flags applied whenever it's queried
+type serverConfig struct {
+	Address string  `yaml:"address"`
+	Flags   argList `yaml:"flags"`
+}
+
+// profileConfig is a set of flags and servers selected with --profile
+type profileConfig struct {
+	Servers argList `yaml:"servers"`
+	Flags   argList `yaml:"flags"`
+}
+
+// argList is a list of arguments written as a YAML list or a single string split like a shell
+type argList []string
+
+func (a *argList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		args, err := splitArgs(value.Value)
+		if err != nil {
+			return fmt.Errorf("line %d: %s", value.Line, err)
+		}
+		*a = args
+		return nil
+	}
+	var args []string
+	if err := value.Decode(&args); err != nil {
+		return err
+	}
+	*a = args
+	return nil
+}
+
+// defaultConfigPath returns the path of the config file in the user config directory
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		log.Debugf("Could not find user config directory: %s", err)
+		return ""
+	}
+	return filepath.Join(dir, "q", "config.yaml")
+}
+
+// loadConfigFile reads a structured config file, returning nil if it doesn't exist and isn't required
+func loadConfigFile(path string, required bool) (*qConfig, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %s", err)
+	}
+
+	var cfg qConfig
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parsing config file %s: %s", path, err)
+	}
+	for _, name := range slices.Sorted(maps.Keys(cfg.Servers)) {
+		if cfg.Servers[name].Address == "" {
+			return nil, fmt.Errorf("parsing config file %s: server %s has no address", path, name)
+		}
+	}
+	log.Debugf("Loaded config file %s", path)
+	return &cfg, nil
+}
+
+// argValue returns the value of a long or short flag given as --flag=value, --flag value or -f value
+func argValue(args []string, long, short string) (string, bool) {
+	for i, arg := range args {
+		if v, ok := strings.CutPrefix(arg, "--"+long+"="); ok {
+			return v, true
+		}
+		if (arg == "--"+long || (short != "" && arg == "-"+short)) && i+1 < len(args) {
+			return args[i+1], true
+		}
+	}
+	return "", false
+}
+
+// applyConfig expands the structured config file into arguments, in order of increasing precedence: the ~/.qrc
+// arguments, the config defaults, the flags of the servers being queried, the --profile flags and the command line.
+// Named servers given as @name or with --server are replaced with their addresses.
+func applyConfig(rcArgs, args []string) ([]string, error) {
+	all := slices.Concat(rcArgs, args)
+	path, required := argValue(all, "config", "")
+	if !required {
+		path = defaultConfigPath()
+		if path == "" {
+			return all, nil
+		}
+	}
+	cfg, err := loadConfigFile(path, required)
+	if err != nil || cfg == nil {
+		return all, err
+	}
+
+	var profileFlags []string
+	if name, ok := argValue(all, "profile", ""); ok {
+		profile, ok := cfg.Profiles[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown profile %s", name)
+		}
+		log.Debugf("Using profile %s", name)
+		profileFlags = profile.Flags
+
+		// Profile servers are used unless servers are given on the command line or in ~/.qrc
+		if _, ok := argValue(all, "server", "s"); !ok && !slices.ContainsFunc(all, isServerArg) {
+			for _, server := range profile.Servers {
+				profileFlags = append(profileFlags, "@"+strings.TrimPrefix(server, "@"))
+			}
+		}
+	}
+
+	// Resolve named servers and collect their flags
+	var serverFlags []string
+	resolve := func(server string) string {
+		if s, ok := cfg.Servers[server]; ok {
+			serverFlags = append(serverFlags, s.Flags...)
+			return s.Address
+		}
+		for _, name := range slices.Sorted(maps.Keys(cfg.Servers)) {
+			if s := cfg.Servers[name]; server == s.Address {
+				serverFlags = append(serverFlags, s.Flags...)
+				return s.Address
+			}
+		}
+		return server
+	}
+	rcArgs, profileFlags, args = slices.Clone(rcArgs), slices.Clone(profileFlags), slices.Clone(args)
+	for _, list := range [][]string{rcArgs, profileFlags, args} {
+		for i, arg := range list {
+			switch {
+			case isServerArg(arg):
+				list[i] = "@" + resolve(strings.TrimPrefix(arg, "@"))
+			case strings.HasPrefix(arg, "--server="):
+				list[i] = "--server=" + resolve(strings.TrimPrefix(arg, "--server="))
+			case (arg == "--server" || arg == "-s") && i+1 < len(list):
+				list[i+1] = resolve(list[i+1])
+			}
+		}
+	}
+
+	out := slices.Concat(rcArgs, cfg.Defaults, serverFlags, profileFlags, args)
+	log.Debugf("Arguments after applying config: %v", out)
+	return out, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/natesales/q/transport"
+	"github.com/natesales/q/util/dnstap"
+)
+
+// tapWriter is the dnstap output for all transports, or nil if disabled
+var tapWriter *dnstap.Writer
+
+// tapProtocol returns the dnstap socket protocol for a transport type
+func tapProtocol(transportType transport.Type) dnstap.SocketProtocol {
+	switch transportType {
+	case transport.TypeTLS:
+		return dnstap.ProtocolDOT
+	case transport.TypeHTTP:
+		return dnstap.ProtocolDOH
+	case transport.TypeQUIC:
+		return dnstap.ProtocolDOQ
+	case transport.TypeDNSCrypt:
+		if opts.DNSCryptTCP {
+			return dnstap.ProtocolDNSCryptTCP
+		}
+		return dnstap.ProtocolDNSCryptUDP
+	case transport.TypeTCP:
+		return dnstap.ProtocolTCP
+	default:
+		if opts.TCP || opts.Proxy != "" {
+			return dnstap.ProtocolTCP
+		}
+		return dnstap.ProtocolUDP
+	}
+}
+
+// writeDnstap writes a query frame and a response frame if there was a reply
+func (c *captureTransport) writeDnstap(query, response []byte, queryTime, responseTime time.Time) {
+	msg := &dnstap.Message{
+		Type:      dnstap.MessageToolQuery,
+		Protocol:  tapProtocol(c.transportType),
+		QueryTime: queryTime,
+		Query:     query,
+	}
+	if server, err := netip.ParseAddrPort(c.ConnState().RemoteAddr); err == nil {
+		msg.ServerIP = net.IP(server.Addr().Unmap().AsSlice())
+		msg.ServerPort = server.Port()
+		msg.Family = dnstap.FamilyINET6
+		if server.Addr().Unmap().Is4() {
+			msg.Family = dnstap.FamilyINET
+		}
+	}
+	if client, err := netip.ParseAddrPort(c.ConnState().LocalAddr); err == nil {
+		msg.ClientIP = net.IP(client.Addr().Unmap().AsSlice())
+		msg.ClientPort = client.Port()
+	}
+	if err := tapWriter.Write(msg); err != nil {
+		log.Warnf("Writing dnstap frame: %s", err)
+	}
+
+	if response != nil {
+		msg.Type = dnstap.MessageToolResponse
+		msg.ResponseTime = responseTime
+		msg.Response = response
+		if err := tapWriter.Write(msg); err != nil {
+			log.Warnf("Writing dnstap frame: %s", err)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/miekg/dns"
+
+	"github.com/natesales/q/transport"
+)
+
+// parseECHConfig parses an ECH config list from a base64 string or a file containing a PEM, base64, or binary config list
+func parseECHConfig(s string) ([]byte, error) {
+	if b, err := os.ReadFile(s); err == nil {
+		log.Debugf("Loading ECH config list from %s", s)
+		if block, _ := pem.Decode(b); block != nil {
+			return block.Bytes, nil
+		}
+		if decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b))); err == nil {
+			return decoded, nil
+		}
+		return b, nil
+	}
+
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("decoding ECH config list: %s", err)
+	}
+	return b, nil
+}
+
+// echRecordName returns the owner name and type of the HTTPS/SVCB record that publishes a server's ECH config list
+func echRecordName(server string, transportType transport.Type) (string, uint16, error) {
+	var host, port string
+	switch transportType {
+	case transport.TypeHTTP:
+		u, err := url.Parse(server)
+		if err != nil {
+			return "", 0, err
+		}
+		host, port = u.Hostname(), u.Port()
+	case transport.TypeTLS, transport.TypeQUIC:
+		var err error
+		host, _, err = net.SplitHostPort(server)
+		if err != nil {
+			return "", 0, err
+		}
+	default:
+		return "", 0, fmt.Errorf("ECH is not supported by the %s transport", transportType)
+	}
+
+	if net.ParseIP(host) != nil {
+		return "", 0, fmt.Errorf("cannot look up ECH config for IP address %s, use --ech-config instead", host)
+	}
+
+	// DoH servers publish an HTTPS record (RFC 9460), other encrypted DNS servers publish an SVCB record under _dns (RFC 9461)
+	if transportType == transport.TypeHTTP {
+		if port != "" && port != "443" {
+			return dns.Fqdn(fmt.Sprintf("_%s._https.%s", port, host)), dns.TypeHTTPS, nil
+		}
+		return dns.Fqdn(host), dns.TypeHTTPS, nil
+	}
+	return dns.Fqdn("_dns." + host), dns.TypeSVCB, nil
+}
+
+// bootstrapAddr returns the address of the plain DNS server used for bootstrap lookups
+func bootstrapAddr() (string, error) {
+	if opts.BootstrapServer != "" {
+		return opts.BootstrapServer, nil
+	}
+	conf, err := dns.ClientConfigFromFile("/etc/resolv.conf")
+	if err != nil {
+		return "", fmt.Errorf("no bootstrap server set and unable to read /etc/resolv.conf: %s", err)
+	}
+	if len(conf.Servers) == 0 {
+		return "", fmt.Errorf("no bootstrap server set and no servers found in /etc/resolv.conf")
+	}
+	return net.JoinHostPort(conf.Servers[0], conf.Port), nil
+}
+
+// lookupECHConfig fetches the ECH config list for a server from its HTTPS/SVCB record
+func lookupECHConfig(server string, transportType transport.Type) ([]byte, error) {
+	name, qType, err := echRecordName(server, transportType)
+	if err != nil {
+		return nil, err
+	}
+	bootstrap, err := bootstrapAddr()
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debugf("Looking up ECH config list in %s %s from %s", name, dns.TypeToString[qType], bootstrap)
+	msg := new(dns.Msg)
+	msg.SetQuestion(name, qType)
+	msg.SetEdns0(opts.UDPBuffer, false)
+	client := dns.Client{Timeout: opts.BootstrapTimeout}
+	reply, _, err := client.Exchange(msg, bootstrap)
+	if err != nil {
+		return nil, fmt.Errorf("looking up %s %s: %s", name, dns.TypeToString[qType], err)
+	}
+
+	for _, rr := range reply.Answer {
+		var svcb *dns.SVCB
+		switch r := rr.(type) {
+		case *dns.HTTPS:
+			svcb = &r.SVCB
+		case *dns.SVCB:
+			svcb = r
+		default:
+			continue
+		}
+		for _, kv := range svcb.Value {
+			if ech, ok := kv.(*dns.SVCBECHConfig); ok {
+				return ech.ECH, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("no ECH config list found in %s %s", name, dns.TypeToString[qType])
+}
+
+// echConfigList returns the ECH config list for a server from --ech-config or the server's HTTPS/SVCB record
+func echConfigList(server string, transportType transport.Type) ([]byte, error) {
+	if opts.ECHConfig != "" {
+		return parseECHConfig(opts.ECHConfig)
+	}
+	return lookupECHConfig(server, transportType)
+}
+
+// echTLSConfig returns a copy of tlsConfig with ECH enabled for a server
+func echTLSConfig(tlsConfig *tls.Config, server string, transportType transport.Type) (*tls.Config, error) {
+	if opts.ODoHProxy != "" {
+		return nil, fmt.Errorf("ECH is not supported with ODoH")
+	}
+	if tlsConfig.MaxVersion != 0 && tlsConfig.MaxVersion < tls.VersionTLS13 {
+		return nil, fmt.Errorf("ECH requires TLS 1.3")
+	}
+
+	configList, err := echConfigList(server, transportType)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("Using %d byte ECH config list for %s", len(configList), server)
+
+	tc := tlsConfig.Clone()
+	tc.EncryptedClientHelloConfigList = configList
+	tc.MinVersion = tls.VersionTLS13
+	return tc, nil
+}
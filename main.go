@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -25,6 +26,8 @@ import (
 	"github.com/natesales/q/output"
 	"github.com/natesales/q/transport"
 	"github.com/natesales/q/util"
+	"github.com/natesales/q/util/expr"
+	"github.com/natesales/q/util/resolvers"
 	tlsutil "github.com/natesales/q/util/tls"
 )
 
@@ -32,6 +35,12 @@ const defaultServerVar = "Q_DEFAULT_SERVER"
 
 var opts = cli.Flags{}
 
+// errHelp is returned by driver after printing the usage, which needs no further error message
+var errHelp = errors.New("help requested")
+
+// rrFilter is the parsed --filter expression, or nil if there isn't one
+var rrFilter *expr.Expr
+
 // Build process flags
 var (
 	version = "dev"
@@ -87,9 +96,14 @@ func dnsStampToURL(s string) (string, error) {
 
 	switch parsedStamp.Proto {
 	case dnsstamps.StampProtoTypePlain:
+		// Plain stamps only have an address
 		u.Scheme = string(transport.TypePlain)
+		u.Host = parsedStamp.ServerAddrStr
+		return u.String(), nil
 	case dnsstamps.StampProtoTypeTLS:
 		u.Scheme = string(transport.TypeTLS)
+	case dnsstamps.StampProtoTypeDoQ:
+		u.Scheme = string(transport.TypeQUIC)
 	case dnsstamps.StampProtoTypeDoH:
 		u.Scheme = string(transport.TypeHTTP) + "s" // default to HTTPS
 	case dnsstamps.StampProtoTypeDNSCrypt:
@@ -185,7 +199,11 @@ func parseServer(s string) (string, transport.Type, error) {
 				setPort(tu, 80)
 			}
 		case transport.TypePlain, transport.TypeTCP:
-			setPort(tu, 53)
+			if ip := net.ParseIP(tu.Hostname()); ip != nil && ip.IsMulticast() {
+				setPort(tu, 5353) // mDNS
+			} else {
+				setPort(tu, 53)
+			}
 		}
 	}
 
@@ -250,20 +268,31 @@ func loadConfig() []string {
 
 // driver is the "main" function for this program that accepts a flag slice for testing
 func driver(args []string, out io.Writer) error {
-	configArgs := loadConfig()
-	args = append(configArgs, args...)
+	cmdArgs := slices.Clone(args)
+	args, err := applyConfig(loadConfig(), args)
+	if err != nil {
+		return err
+	}
 	args = cli.SetFalseBooleans(&opts, args)
 	args = cli.AddEqualSigns(args)
 	parser := flags.NewParser(&opts, flags.Default)
 	parser.Usage = `[OPTIONS] [@server] [type...] [name]
+  q serve [OPTIONS] @upstream...
 
 All long form (--) flags can be toggled with the dig-standard +[no]flag notation.`
-	_, err := parser.ParseArgs(args)
+	rest, err := parser.ParseArgs(args)
 	if err != nil {
-		if !strings.Contains(err.Error(), "Usage") {
-			log.Fatal(err)
+		if strings.Contains(err.Error(), "Usage") {
+			return errHelp
 		}
-		os.Exit(1)
+		return err
+	}
+
+	// Remove the serve subcommand so it isn't parsed as a query name
+	serveMode := len(rest) > 0 && rest[0] == "serve"
+	if serveMode {
+		i := slices.Index(args, "serve")
+		args = slices.Delete(args, i, i+1)
 	}
 	cli.ParsePlusFlags(&opts, args)
 	util.UseColor = opts.Color
@@ -282,6 +311,10 @@ All long form (--) flags can be toggled with the dig-standard +[no]flag notation
 		return nil
 	}
 
+	if opts.ListResolvers {
+		return listResolvers(out)
+	}
+
 	if opts.ShowAll {
 		opts.ShowQuestion = true
 		opts.ShowAnswer = true
@@ -290,6 +323,23 @@ All long form (--) flags can be toggled with the dig-standard +[no]flag notation
 		opts.ShowStats = true
 	}
 
+	// Parse RR filter and field selection before sending any queries
+	rrFilter = nil
+	if opts.Filter != "" {
+		rrFilter, err = output.ParseFilter(opts.Filter)
+		if err != nil {
+			return err
+		}
+	}
+	if opts.Select != "" {
+		if _, err := output.ParseSelect(opts.Select); err != nil {
+			return err
+		}
+		if opts.Format == output.FormatNDJSON {
+			return fmt.Errorf("--select isn't supported with the %s format", opts.Format)
+		}
+	}
+
 	// Set bootstrap resolver
 	if opts.BootstrapServer != "" {
 		// Add port if not specified
@@ -347,6 +397,11 @@ All long form (--) flags can be toggled with the dig-standard +[no]flag notation
 		}
 	}
 
+	// Browse the mDNS domain by default
+	if opts.Browse && opts.Name == "" {
+		opts.Name = "local"
+	}
+
 	// If no RR types are defined, set a list of default ones
 	if len(rrTypes) < 1 {
 		if opts.Name == "" {
@@ -402,31 +457,66 @@ All long form (--) flags can be toggled with the dig-standard +[no]flag notation
 		log.Debugf("RR types: %+v", rrTypeStrings)
 	}
 
-	// Set default DNS server
-	if len(opts.Server) == 0 {
+	// Read queries from a prompt, with the command line flags applied to each one
+	if opts.Interactive && !inREPL {
+		return interactive(stdin, out, slices.DeleteFunc(cmdArgs, func(arg string) bool {
+			return arg == "-I" || arg == "--interactive" || arg == "+interactive"
+		}))
+	}
+
+	// Decode messages from a capture file or the command line instead of querying
+	if opts.Read != "" {
+		return readCapture(out)
+	}
+	if opts.Decode != "" {
+		return decodeMessage(out)
+	}
+
+	// Add servers from the public resolver catalog and --resolver-list
+	resolverList, err := loadResolverList()
+	if err != nil {
+		return err
+	}
+	publicServers, err := publicServers(resolverList)
+	if err != nil {
+		return err
+	}
+	opts.Server = append(opts.Server, publicServers...)
+
+	// Set default DNS server, leaving the nameservers to the stub resolver
+	// q serve needs upstreams given explicitly, since the system resolver may be q itself
+	if len(opts.Server) == 0 && !opts.Stub && !serveMode {
 		opts.Server = make([]string, 1)
 
 		if os.Getenv(defaultServerVar) != "" {
 			opts.Server[0] = os.Getenv(defaultServerVar)
 			log.Debugf("Using %s from %s environment variable", opts.Server, defaultServerVar)
 		} else {
-			log.Debugf("No server specified or %s set, using /etc/resolv.conf", defaultServerVar)
-			conf, err := dns.ClientConfigFromFile("/etc/resolv.conf")
+			log.Debugf("No server specified or %s set, using %s", defaultServerVar, opts.ResolvConf)
+			conf, err := dns.ClientConfigFromFile(opts.ResolvConf)
 			if err != nil {
-				opts.Server[0] = "https://cloudflare-dns.com/dns-query"
+				opts.Server[0] = resolvers.Fallback()
 				log.Debugf("no server set, using %s", opts.Server)
 			} else {
 				if len(conf.Servers) == 0 {
-					opts.Server[0] = "https://cloudflare-dns.com/dns-query"
+					opts.Server[0] = resolvers.Fallback()
 					log.Debugf("no server set, using %s", opts.Server)
 				} else {
 					opts.Server[0] = conf.Servers[0]
-					log.Debugf("found server %s from /etc/resolv.conf", opts.Server)
+					log.Debugf("found server %s from %s", opts.Server, opts.ResolvConf)
 				}
 			}
 		}
 	}
 
+	// Expand public resolver names (e.g. quad9 or quad9/doq)
+	for i, server := range opts.Server {
+		opts.Server[i], err = expandServer(server, resolverList)
+		if err != nil {
+			return fmt.Errorf("server %s: %s", server, err)
+		}
+	}
+
 	// Validate ODoH
 	if opts.ODoHProxy != "" {
 		if !strings.HasPrefix(opts.ODoHProxy, "https://") {
@@ -480,15 +570,69 @@ All long form (--) flags can be toggled with the dig-standard +[no]flag notation
 		tlsConfig.KeyLogWriter = keyLogFile
 	}
 
+	// TLS session resumption
+	if opts.TLSSessionCache || opts.TLSSessionFile != "" || opts.QUIC0RTT {
+		log.Debugf("Using TLS session cache (file: %q)", opts.TLSSessionFile)
+		tlsConfig.ClientSessionCache = tlsutil.NewSessionCache(opts.TLSSessionFile)
+	}
+
+	if opts.ClientSubnet != "" {
+		if _, _, err := net.ParseCIDR(opts.ClientSubnet); err != nil {
+			return fmt.Errorf("parsing subnet %s: %s", opts.ClientSubnet, err)
+		}
+	}
+
+	// dnstap and pcap outputs
+	closeCaptures, err := openCaptures()
+	if err != nil {
+		return err
+	}
+	defer closeCaptures()
+
+	if serveMode {
+		return serve(tlsConfig)
+	}
+
 	var rrTypesSlice []uint16
 	for rrType := range rrTypes {
 		rrTypesSlice = append(rrTypesSlice, rrType)
 	}
 	msgs := createQuery(opts, rrTypesSlice)
 
+	// Send a message exactly as given instead of building queries
+	sendWire = nil
+	if opts.SendWire != "" {
+		msg, b, err := decodeWire(opts.SendWire)
+		if err != nil {
+			return fmt.Errorf("decoding message to send: %s", err)
+		}
+		msgs = []dns.Msg{*msg}
+		sendWire = b
+	}
+
 	errChan := make(chan error)
 
+	// Try each search list name against each nameserver like the system resolver
+	if opts.Stub {
+		_, timeoutSet := argValue(args, "timeout", "")
+		s, err := newStubResolver(tlsConfig, timeoutSet)
+		if err != nil {
+			return err
+		}
+		go func() {
+			errChan <- s.resolve(out, msgs)
+		}()
+		return awaitQueries(errChan, opts.Timeout*time.Duration(len(s.servers)))
+	}
+
 	go func() {
+		printer := output.Printer{
+			Out:  out,
+			Opts: &opts,
+		}
+		// ndjson output is written as each reply arrives
+		streaming := opts.Format == output.FormatNDJSON
+
 		var entries []*output.Entry
 		multiServer := len(opts.Server) > 1
 		for _, serverStr := range opts.Server {
@@ -510,13 +654,30 @@ All long form (--) flags can be toggled with the dig-standard +[no]flag notation
 					errChan <- fmt.Errorf("no name specified for AXFR")
 					return
 				}
-				_ = RecAXFR(opts.Name, server, out)
+				if _, err := RecAXFR(opts.Name, server, out); err != nil {
+					errChan <- fmt.Errorf("recursive AXFR: %s", err)
+					return
+				}
 				errChan <- nil // exit immediately
 				return
 			}
 
+			// Set up Encrypted Client Hello
+			serverTLSConfig := tlsConfig
+			if opts.ECH || opts.ECHConfig != "" {
+				serverTLSConfig, err = echTLSConfig(tlsConfig, server, transportType)
+				if err != nil {
+					if multiServer {
+						log.Warnf("Skipping server %s (ECH error): %v", server, err)
+						continue
+					}
+					errChan <- fmt.Errorf("configuring ECH: %s", err)
+					return
+				}
+			}
+
 			// Create transport
-			txp, err := newTransport(server, transportType, tlsConfig)
+			txp, err := openTransport(server, transportType, serverTLSConfig)
 			if err != nil {
 				if multiServer {
 					log.Warnf("Skipping server %s (transport error): %v", server, err)
@@ -526,22 +687,68 @@ All long form (--) flags can be toggled with the dig-standard +[no]flag notation
 				return
 			}
 
+			// DNS-SD service browsing
+			if opts.Browse {
+				startTime := time.Now()
+				services, err := browse(*txp, opts.Name)
+				_ = closeTransport(txp, err != nil)
+				if err != nil {
+					if multiServer {
+						log.Warnf("Server %s failed: %v", server, err)
+						continue
+					}
+					errChan <- fmt.Errorf("browsing %s: %s", opts.Name, err)
+					return
+				}
+				entries = append(entries, &output.Entry{
+					Server:    server,
+					Time:      time.Since(startTime),
+					ConnState: (*txp).ConnState(),
+					Services:  services,
+				})
+				continue
+			}
+
 			startTime := time.Now()
 			var replies []*dns.Msg
+			var wires []transport.Wire
 			var serverFailed error
 			for _, msg := range msgs {
 				if txp == nil {
 					serverFailed = fmt.Errorf("transport is nil")
 					break
 				}
-				reply, err := (*txp).Exchange(&msg)
-				if err != nil {
+				queryStart := time.Now()
+				reply, wire, err := exchange(*txp, &msg)
+				rtt := time.Since(queryStart)
+				switch {
+				case err != nil:
 					serverFailed = fmt.Errorf("exchange: %s", err)
-					break
+				case reply == nil:
+					serverFailed = fmt.Errorf("no reply from server")
+				default:
+					if serverFailed = checkReply(&msg, reply, transportType); serverFailed == nil {
+						processReply(reply)
+					}
 				}
 
-				if reply == nil {
-					serverFailed = fmt.Errorf("no reply from server")
+				// Write each reply as it arrives, after the same checks and processing as other formats
+				if streaming {
+					if serverFailed != nil {
+						if err == nil {
+							err = serverFailed
+						}
+						reply = nil
+					}
+					if reply != nil && rrFilter != nil {
+						if err := output.FilterReply(server, reply, rrFilter); err != nil {
+							errChan <- err
+							return
+						}
+					}
+					printer.WriteNDJSON(server, &msg, reply, queryStart.Add(rtt), rtt, err)
+				}
+				if serverFailed != nil {
 					break
 				}
 
@@ -553,16 +760,13 @@ All long form (--) flags can be toggled with the dig-standard +[no]flag notation
 					}
 				}
 
-				if transportType != transport.TypeQUIC && opts.IDCheck && reply.Id != msg.Id {
-					serverFailed = fmt.Errorf("ID mismatch: expected %d, got %d", msg.Id, reply.Id)
-					break
-				}
 				replies = append(replies, reply)
+				wires = append(wires, wire)
 			}
 
 			// If this server failed at any point, either skip (multi) or exit (single)
 			if serverFailed != nil {
-				_ = (*txp).Close()
+				_ = closeTransport(txp, true)
 				if multiServer {
 					log.Warnf("Server %s failed: %v", server, serverFailed)
 					continue
@@ -571,27 +775,17 @@ All long form (--) flags can be toggled with the dig-standard +[no]flag notation
 				return
 			}
 
-			// Process TXT parsing
-			if opts.TXTConcat {
-				for _, reply := range replies {
-					txtConcat(reply)
-				}
-			}
-
-			// Round TTL
-			if opts.RoundTTLs {
-				for _, reply := range replies {
-					for _, rr := range reply.Answer {
-						rr.Header().Ttl = rr.Header().Ttl - (rr.Header().Ttl % 60)
-					}
-				}
+			e := &output.Entry{
+				Queries:   msgs,
+				Replies:   replies,
+				Wire:      wires,
+				Server:    server,
+				Time:      time.Since(startTime),
+				ConnState: (*txp).ConnState(),
 			}
 
-			e := &output.Entry{
-				Queries: msgs,
-				Replies: replies,
-				Server:  server,
-				Time:    time.Since(startTime),
+			if mdns, ok := unwrapTransport(*txp).(*transport.MDNS); ok {
+				e.Responses = mdns.Responses()
 			}
 
 			if opts.ResolveIPs {
@@ -600,7 +794,7 @@ All long form (--) flags can be toggled with the dig-standard +[no]flag notation
 
 			entries = append(entries, e)
 
-			if err := (*txp).Close(); err != nil {
+			if err := closeTransport(txp, false); err != nil {
 				if multiServer {
 					log.Warnf("Server %s close error: %v", server, err)
 				} else {
@@ -616,36 +810,20 @@ All long form (--) flags can be toggled with the dig-standard +[no]flag notation
 			return
 		}
 
-		printer := output.Printer{
-			Out:  out,
-			Opts: &opts,
-		}
-
-		if (opts.NSID && (opts.Format == output.FormatPretty || opts.Format == output.FormatColumn)) || opts.NSIDOnly {
-			printer.PrettyPrintNSID(entries, !opts.NSIDOnly)
-		}
-
-		// Skip printing if NSIDOnly is set
-		if opts.NSIDOnly {
+		// Replies have already been written
+		if streaming && !opts.Browse {
 			errChan <- nil
 			return
 		}
 
-		switch opts.Format {
-		case output.FormatPretty:
-			printer.PrintPretty(entries)
-		case output.FormatColumn:
-			printer.PrintColumn(entries)
-		case output.FormatRAW:
-			printer.PrintRaw(entries)
-		case output.FormatJSON, output.FormatYAML, "yml":
-			printer.PrintStructured(entries)
-		default:
-			errChan <- fmt.Errorf("invalid output format %s", opts.Format)
+		// Print browsed services as a tree unless a structured format is requested
+		if opts.Browse && !opts.NSIDOnly && slices.Contains([]string{output.FormatPretty, output.FormatColumn, output.FormatRAW}, opts.Format) {
+			printer.PrintBrowse(entries)
+			errChan <- nil
 			return
 		}
 
-		errChan <- nil
+		errChan <- printQueryEntries(printer, entries)
 	}()
 
 	// When multiple servers are configured, queries are attempted sequentially.
@@ -657,17 +835,97 @@ All long form (--) flags can be toggled with the dig-standard +[no]flag notation
 		totalTimeout = opts.Timeout * time.Duration(len(opts.Server))
 	}
 
+	return awaitQueries(errChan, totalTimeout)
+}
+
+// awaitQueries waits for the queries to finish, giving up on them after the timeout
+func awaitQueries(errChan chan error, timeout time.Duration) error {
 	select {
-	case <-time.After(totalTimeout):
-		return fmt.Errorf("timeout after %s", totalTimeout)
+	case <-time.After(timeout):
+		abandonTransports()
+		return fmt.Errorf("timeout after %s", timeout)
 	case err := <-errChan:
 		return err
 	}
 }
 
+// checkReply returns an error if the ID of a reply doesn't match its query, unless ID checks are off or don't apply
+// to the transport
+func checkReply(query, reply *dns.Msg, transportType transport.Type) error {
+	if transportType != transport.TypeQUIC && opts.IDCheck && reply.Id != query.Id {
+		return fmt.Errorf("ID mismatch: expected %d, got %d", query.Id, reply.Id)
+	}
+	return nil
+}
+
+// processReply concatenates TXT strings and rounds TTLs in a reply if requested
+func processReply(reply *dns.Msg) {
+	// Process TXT parsing
+	if opts.TXTConcat {
+		txtConcat(reply)
+	}
+
+	// Round TTL
+	if opts.RoundTTLs {
+		for _, rr := range reply.Answer {
+			rr.Header().Ttl = rr.Header().Ttl - (rr.Header().Ttl % 60)
+		}
+	}
+}
+
+// printQueryEntries prints the NSID of each reply if requested, followed by the entries unless only NSIDs are shown
+func printQueryEntries(printer output.Printer, entries []*output.Entry) error {
+	if (opts.NSID && (opts.Format == output.FormatPretty || opts.Format == output.FormatColumn)) || opts.NSIDOnly {
+		printer.PrettyPrintNSID(entries, !opts.NSIDOnly)
+	}
+	if opts.NSIDOnly {
+		return nil
+	}
+	return printEntries(printer, entries)
+}
+
+// printEntries prints entries in the selected output format
+func printEntries(printer output.Printer, entries []*output.Entry) error {
+	if rrFilter != nil {
+		if err := output.FilterEntries(entries, rrFilter); err != nil {
+			return err
+		}
+	}
+	if opts.Select != "" {
+		return printer.PrintSelect(entries)
+	}
+
+	switch opts.Format {
+	case output.FormatPretty:
+		printer.PrintPretty(entries)
+	case output.FormatColumn:
+		printer.PrintColumn(entries)
+	case output.FormatRAW:
+		printer.PrintRaw(entries)
+	case output.FormatWire:
+		printer.PrintWire(entries)
+	case output.FormatJSON, output.FormatYAML, "yml":
+		printer.PrintStructured(entries)
+	case output.FormatNDJSON:
+		printer.PrintNDJSON(entries)
+	case output.FormatCSV, output.FormatTSV:
+		printer.PrintTabular(entries)
+	case output.FormatZone:
+		printer.PrintZone(entries)
+	case output.FormatTemplate:
+		return printer.PrintTemplate(entries)
+	default:
+		return fmt.Errorf("invalid output format %s", opts.Format)
+	}
+	return nil
+}
+
 func main() {
 	clearOpts()
 	if err := driver(os.Args[1:], os.Stdout); err != nil {
+		if errors.Is(err, errHelp) {
+			os.Exit(1)
+		}
 		log.Fatal(err)
 	}
 }
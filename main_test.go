@@ -2,19 +2,46 @@ package main
 
 import (
 	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/jedisct1/go-dnsstamps"
+	"github.com/miekg/dns"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/net/idna"
 
 	"github.com/natesales/q/cli"
+	"github.com/natesales/q/output"
 	"github.com/natesales/q/transport"
+	"github.com/natesales/q/util/pcap"
 )
 
+func TestMain(m *testing.M) {
+	// Keep the user's config file out of tests
+	dir, err := os.MkdirTemp("", "q-config")
+	if err != nil {
+		panic(err)
+	}
+	_ = os.Setenv("XDG_CONFIG_HOME", dir)
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
 func run(args ...string) (*bytes.Buffer, error) {
 	clearOpts()
 	var out bytes.Buffer
@@ -427,6 +454,11 @@ func TestMainParseServer(t *testing.T) {
 			Type:         transport.TypePlain,
 			ExpectedHost: "[2a09::]:5353",
 		},
+		{ // mDNS with no port
+			Server:       "224.0.0.251",
+			Type:         transport.TypePlain,
+			ExpectedHost: "224.0.0.251:5353",
+		},
 		{ // TLS with no port
 			Server:       "tls://dns.quad9.net",
 			Type:         transport.TypeTLS,
@@ -697,3 +729,847 @@ func TestMainMultipleServersAllFail(t *testing.T) {
 	erroredOut := strings.Contains(err.Error(), "all servers failed")
 	assert.True(t, timedOut || erroredOut)
 }
+
+func TestMainECHRecordName(t *testing.T) {
+	for _, tc := range []struct {
+		Server       string
+		Type         transport.Type
+		ExpectedName string
+		ExpectedType uint16
+	}{
+		{
+			Server:       "https://cloudflare-dns.com:443/dns-query",
+			Type:         transport.TypeHTTP,
+			ExpectedName: "cloudflare-dns.com.",
+			ExpectedType: dns.TypeHTTPS,
+		},
+		{
+			Server:       "https://doh.example.com:8443/dns-query",
+			Type:         transport.TypeHTTP,
+			ExpectedName: "_8443._https.doh.example.com.",
+			ExpectedType: dns.TypeHTTPS,
+		},
+		{
+			Server:       "dns.example.com:853",
+			Type:         transport.TypeTLS,
+			ExpectedName: "_dns.dns.example.com.",
+			ExpectedType: dns.TypeSVCB,
+		},
+	} {
+		t.Run(tc.Server, func(t *testing.T) {
+			name, qType, err := echRecordName(tc.Server, tc.Type)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.ExpectedName, name)
+			assert.Equal(t, tc.ExpectedType, qType)
+		})
+	}
+
+	_, _, err := echRecordName("1.1.1.1:853", transport.TypeTLS)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "use --ech-config")
+}
+
+// localZoneServer starts a UDP DNS server on a random local port that answers from a zone
+func localZoneServer(t *testing.T, zone string) string {
+	var records []dns.RR
+	zp := dns.NewZoneParser(strings.NewReader(zone), "", "")
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		records = append(records, rr)
+	}
+	assert.Nil(t, zp.Err())
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	server := &dns.Server{PacketConn: conn, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		for _, rr := range records {
+			if strings.EqualFold(rr.Header().Name, r.Question[0].Name) && rr.Header().Rrtype == r.Question[0].Qtype {
+				m.Answer = append(m.Answer, rr)
+			}
+		}
+		_ = w.WriteMsg(m)
+	})}
+	go func() { _ = server.ActivateAndServe() }()
+	t.Cleanup(func() { _ = server.Shutdown() })
+	return conn.LocalAddr().String()
+}
+
+const browseZone = `
+_services._dns-sd._udp.example.com. 60 IN PTR _ipp._tcp.example.com.
+_services._dns-sd._udp.example.com. 60 IN PTR _ssh._tcp.example.com.
+_ipp._tcp.example.com. 60 IN PTR Office\ Printer._ipp._tcp.example.com.
+Office\ Printer._ipp._tcp.example.com. 60 IN SRV 0 0 631 printer.example.com.
+Office\ Printer._ipp._tcp.example.com. 60 IN TXT "txtvers=1" "rp=ipp/print"
+printer.example.com. 60 IN A 192.0.2.10
+printer.example.com. 60 IN AAAA 2001:db8::10
+_ssh._tcp.example.com. 60 IN PTR lab1._ssh._tcp.example.com.
+lab1._ssh._tcp.example.com. 60 IN SRV 0 0 22 lab1.example.com.
+lab1.example.com. 60 IN A 192.0.2.20
+`
+
+func TestMainBrowse(t *testing.T) {
+	server := localZoneServer(t, browseZone)
+	out, err := run("--browse", "example.com", "@"+server)
+	assert.Nil(t, err)
+	assert.Equal(t, `example.com
+├── _ipp._tcp.example.com.
+│   └── Office Printer
+│       ├── host printer.example.com.:631
+│       ├── addresses 192.0.2.10, 2001:db8::10
+│       └── txt txtvers=1 rp=ipp/print
+└── _ssh._tcp.example.com.
+    └── lab1
+        ├── host lab1.example.com.:22
+        └── addresses 192.0.2.20
+`, out.String())
+}
+
+func TestMainBrowseJSON(t *testing.T) {
+	server := localZoneServer(t, browseZone)
+	out, err := run("--browse", "example.com", "@"+server, "--format=json")
+	assert.Nil(t, err)
+	assert.Contains(t, out.String(), `"services":[{"type":"_ipp._tcp.example.com.","instances":[{"name":"Office\\ Printer._ipp._tcp.example.com.","host":"printer.example.com.","port":631`)
+}
+
+// countingTransport answers every query with a fixed A record and counts exchanges
+type countingTransport struct {
+	transport.Common
+	exchanges int
+	err       error
+	failures  int // exchanges to fail with err before answering, or 0 to always fail
+}
+
+func (c *countingTransport) Exchange(m *dns.Msg) (*dns.Msg, error) {
+	c.exchanges++
+	if c.err != nil && (c.failures == 0 || c.exchanges <= c.failures) {
+		return nil, c.err
+	}
+	reply := new(dns.Msg)
+	reply.SetReply(m)
+	rr, _ := dns.NewRR(m.Question[0].Name + " 300 IN A 192.0.2.1")
+	reply.Answer = append(reply.Answer, rr)
+	return reply, nil
+}
+
+func (c *countingTransport) Close() error {
+	return nil
+}
+
+func TestMainServeForward(t *testing.T) {
+	server, transportType, err := parseServer(localZoneServer(t, browseZone))
+	assert.Nil(t, err)
+	clearOpts()
+	txp, err := newTransport(server, transportType, nil)
+	assert.Nil(t, err)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	s := &dns.Server{PacketConn: conn, Handler: &forwarder{upstreams: []*upstream{{server: server, txp: *txp}}}}
+	go func() { _ = s.ActivateAndServe() }()
+	defer func() { _ = s.Shutdown() }()
+
+	query := new(dns.Msg)
+	query.SetQuestion("printer.example.com.", dns.TypeA)
+	reply, err := dns.Exchange(query, conn.LocalAddr().String())
+	assert.Nil(t, err)
+	assert.Equal(t, query.Id, reply.Id)
+	assert.Len(t, reply.Answer, 1)
+	assert.Equal(t, "192.0.2.10", reply.Answer[0].(*dns.A).A.String())
+}
+
+func TestMainServeCacheAndFallback(t *testing.T) {
+	failing := &countingTransport{err: errors.New("connection refused")}
+	working := &countingTransport{}
+	f := &forwarder{
+		upstreams: []*upstream{
+			{server: "failing", txp: failing},
+			{server: "working", txp: working},
+		},
+		cache: &cache{entries: make(map[cacheKey]cacheEntry)},
+	}
+
+	query := new(dns.Msg)
+	query.SetQuestion("Example.com.", dns.TypeA)
+	reply, source, err := f.resolve(query)
+	assert.Nil(t, err)
+	assert.Equal(t, "working", source)
+	assert.Len(t, reply.Answer, 1)
+
+	query.SetQuestion("example.com.", dns.TypeA)
+	reply, source, err = f.resolve(query)
+	assert.Nil(t, err)
+	assert.Equal(t, "cache", source)
+	assert.Len(t, reply.Answer, 1)
+	assert.Equal(t, 2, failing.exchanges)
+	assert.Equal(t, 1, working.exchanges)
+
+	// DNSSEC and checking disabled queries aren't answered from the cache of plain queries
+	query.SetEdns0(1232, true)
+	_, source, err = f.resolve(query)
+	assert.Nil(t, err)
+	assert.Equal(t, "working", source)
+	query.SetQuestion("example.com.", dns.TypeA)
+	query.CheckingDisabled = true
+	_, source, err = f.resolve(query)
+	assert.Nil(t, err)
+	assert.Equal(t, "working", source)
+
+	_, _, err = (&forwarder{}).resolve(query)
+	assert.ErrorContains(t, err, "no upstreams")
+
+	// A connection the upstream closed is retried once instead of failing the query
+	stale := &countingTransport{err: errors.New("connection reset by peer"), failures: 1}
+	query.SetQuestion("stale.example.com.", dns.TypeA)
+	_, source, err = (&forwarder{upstreams: []*upstream{{server: "stale", txp: stale}}}).resolve(query)
+	assert.Nil(t, err)
+	assert.Equal(t, "stale", source)
+	assert.Equal(t, 2, stale.exchanges)
+
+	// Timeouts aren't retried
+	timeout := &countingTransport{err: os.ErrDeadlineExceeded}
+	_, _, err = (&forwarder{upstreams: []*upstream{{server: "timeout", txp: timeout}}}).resolve(query)
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, timeout.exchanges)
+}
+
+func TestMainServeCacheEviction(t *testing.T) {
+	c := &cache{entries: make(map[cacheKey]cacheEntry)}
+	reply := func(name string, ttl uint32) (*dns.Msg, *dns.Msg) {
+		query := new(dns.Msg)
+		query.SetQuestion(name, dns.TypeA)
+		reply := new(dns.Msg)
+		reply.SetReply(query)
+		rr, _ := dns.NewRR(fmt.Sprintf("%s %d IN A 192.0.2.1", name, ttl))
+		reply.Answer = []dns.RR{rr}
+		return query, reply
+	}
+
+	// Expired entries are swept even if they're never read again
+	query, r := reply("expired.example.com.", 1)
+	c.set(query, r)
+	c.nextSweep = time.Now()
+	c.entries[newCacheKey(query)] = cacheEntry{reply: r, expires: time.Now().Add(-time.Second)}
+	query, r = reply("fresh.example.com.", 300)
+	c.set(query, r)
+	assert.Len(t, c.entries, 1)
+
+	// The cache doesn't grow past its size limit
+	for i := 0; i < maxCacheEntries+10; i++ {
+		query, r := reply(fmt.Sprintf("%d.example.com.", i), 300)
+		c.set(query, r)
+	}
+	assert.Len(t, c.entries, maxCacheEntries)
+}
+
+func TestMainServeUpstreams(t *testing.T) {
+	// The serve subcommand must come first, so run isn't used
+	clearOpts()
+	err := driver([]string{"serve"}, io.Discard)
+	assert.ErrorContains(t, err, "no upstream servers to forward to")
+	clearOpts()
+	err = driver([]string{"serve", "--serve-listen", "127.0.0.1:5353", "@127.0.0.1:5353"}, io.Discard)
+	assert.ErrorContains(t, err, "upstream 127.0.0.1:5353 is the listen address")
+}
+
+func TestMainDnstap(t *testing.T) {
+	server := localZoneServer(t, browseZone)
+	path := filepath.Join(t.TempDir(), "q.dnstap")
+	_, err := run("A", "printer.example.com", "@"+server, "--dnstap", path)
+	assert.Nil(t, err)
+
+	b, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Contains(t, string(b), "protobuf:dnstap.Dnstap")
+	assert.Contains(t, string(b), "\x07printer\x07example\x03com\x00")
+}
+
+func TestMainPcap(t *testing.T) {
+	server := localZoneServer(t, browseZone)
+	path := filepath.Join(t.TempDir(), "q.pcapng")
+	_, err := run("A", "printer.example.com", "@"+server, "--pcap", path)
+	assert.Nil(t, err)
+
+	b, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x0A, 0x0D, 0x0D, 0x0A}, b[:4])
+	assert.Contains(t, string(b), "\x07printer\x07example\x03com\x00")
+}
+
+func TestMainReadPcap(t *testing.T) {
+	server := localZoneServer(t, browseZone)
+	path := filepath.Join(t.TempDir(), "q.pcapng")
+	_, err := run("A", "printer.example.com", "@"+server, "--pcap", path)
+	assert.Nil(t, err)
+	_, port, err := net.SplitHostPort(server)
+	assert.Nil(t, err)
+
+	out, err := run("--read", path, "--read-port", port, "--format", "raw", "--stats")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, strings.Count(out.String(), "printer.example.com.\tIN\t A"))
+	assert.Contains(t, out.String(), "printer.example.com.\t60\tIN\tA\t192.0.2.10")
+	assert.Contains(t, out.String(), ";; From "+server+" > 127.0.0.1:")
+
+	out, err = run("--read", path, "--read-port", port, "--read-qtype", "TXT", "--format", "json")
+	assert.Nil(t, err)
+	assert.Equal(t, "[]\n", out.String())
+
+	out, err = run("--read", path, "--read-port", port, "--read-qname", "example.com", "--read-rcode", "NOERROR", "--format", "json")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, strings.Count(out.String(), `"server":`))
+
+	out, err = run("--read", path, "--format", "json")
+	assert.Nil(t, err)
+	assert.Equal(t, "[]\n", out.String())
+}
+
+func TestMainReadDnstap(t *testing.T) {
+	server := localZoneServer(t, browseZone)
+	path := filepath.Join(t.TempDir(), "q.dnstap")
+	_, err := run("A", "AAAA", "printer.example.com", "@"+server, "--dnstap", path)
+	assert.Nil(t, err)
+
+	out, err := run("--read", path, "--read-qtype", "AAAA", "--format", "column")
+	assert.Nil(t, err)
+	assert.Equal(t, "AAAA 1m 2001:db8::10\n", out.String())
+
+	_, err = run("--read", path, "--read-rcode", "BOGUS")
+	assert.NotNil(t, err)
+}
+
+func TestMainReadPcapTCPSegments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tcp.pcapng")
+	w, err := pcap.Create(path, "")
+	assert.Nil(t, err)
+
+	client := netip.MustParseAddrPort("192.0.2.1:40000")
+	server := netip.MustParseAddrPort("192.0.2.53:53")
+	query := new(dns.Msg).SetQuestion("example.com.", dns.TypeMX)
+	reply := new(dns.Msg).SetRcode(query, dns.RcodeNameError)
+	q, err := query.Pack()
+	assert.Nil(t, err)
+	r, err := reply.Pack()
+	assert.Nil(t, err)
+
+	// Query split across two segments, reply in one
+	q = prefixLength(q)
+	assert.Nil(t, w.WriteTCP(time.Unix(1700000000, 0), client, server, q[:5], ""))
+	assert.Nil(t, w.WriteTCP(time.Unix(1700000000, 0), client, server, q[5:], ""))
+	assert.Nil(t, w.WriteTCP(time.Unix(1700000000, 5e6), server, client, prefixLength(r), ""))
+	assert.Nil(t, w.Close())
+
+	out, err := run("--read", path, "--read-qtype", "MX", "--stats")
+	assert.Nil(t, err)
+	assert.Contains(t, out.String(), "from 192.0.2.1:40000 > 192.0.2.53:53 in 0s")
+	assert.Contains(t, out.String(), "from 192.0.2.53:53 > 192.0.2.1:40000 in 5ms")
+	assert.Contains(t, out.String(), "Status: NXDOMAIN")
+
+	out, err = run("--read", path, "--read-rcode", "NXDOMAIN", "--format", "json")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, strings.Count(out.String(), `"server":`))
+}
+
+func TestMainDecode(t *testing.T) {
+	for _, in := range []string{
+		"AAABAAABAAAAAAAAB2V4YW1wbGUDY29tAAABAAE",
+		"0x0000 0100 0001 0000 0000 0000 0765 7861 6d70 6c65 0363 6f6d 0000 0100 01",
+		"https://dns.example/dns-query?ct&dns=AAABAAABAAAAAAAAB2V4YW1wbGUDY29tAAABAAE",
+	} {
+		out, err := run("--decode", in, "--format", "raw")
+		assert.Nil(t, err, in)
+		assert.Contains(t, out.String(), ";example.com.\tIN\t A", in)
+	}
+
+	_, err := run("--decode", "not a message")
+	assert.NotNil(t, err)
+}
+
+func TestMainSendWire(t *testing.T) {
+	server := localZoneServer(t, browseZone)
+	query := new(dns.Msg).SetQuestion("printer.example.com.", dns.TypeAAAA)
+	query.Id = 4242
+	query.RecursionDesired = false
+	b, err := query.Pack()
+	assert.Nil(t, err)
+
+	out, err := run("--send-wire", base64.RawURLEncoding.EncodeToString(b), "@"+server, "--format", "raw")
+	assert.Nil(t, err)
+	assert.Contains(t, out.String(), "id: 4242")
+	assert.Contains(t, out.String(), ";; flags: qr;")
+	assert.Contains(t, out.String(), "2001:db8::10")
+
+	// The message is sent byte for byte, without the OPT record +edns adds, even if it has no question
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer conn.Close()
+	received := make(chan []byte, 1)
+	go func() {
+		buf := make([]byte, 512)
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		received <- slices.Clone(buf[:n])
+		buf[2] |= 0x80 // QR
+		_, _ = conn.WriteTo(buf[:n], addr)
+	}()
+	raw := []byte{0x12, 0x34, 0x01, 0x00, 0, 0, 0, 0, 0, 0, 0, 0}
+	out, err = run("--send-wire", hex.EncodeToString(raw), "@"+conn.LocalAddr().String(), "+edns", "--format", "wire")
+	assert.Nil(t, err)
+	assert.Equal(t, raw, <-received)
+	assert.Contains(t, out.String(), ";; Query (12 bytes)\n;; HEADER\n0000  12 34")
+	assert.Contains(t, out.String(), ";; Response (12 bytes)\n;; HEADER\n0000  12 34")
+}
+
+func TestMainNDJSON(t *testing.T) {
+	server := localZoneServer(t, browseZone)
+	closed, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	closedAddr := closed.LocalAddr().String()
+	assert.Nil(t, closed.Close())
+
+	out, err := run("A", "AAAA", "printer.example.com", "@"+server, "@"+closedAddr, "--format", "ndjson", "--timeout", "2s")
+	assert.Nil(t, err)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 3)
+	var records []map[string]any
+	for _, line := range lines {
+		var r map[string]any
+		assert.Nil(t, json.Unmarshal([]byte(line), &r), line)
+		assert.Contains(t, r, "timestamp")
+		assert.Contains(t, r, "time")
+		records = append(records, r)
+	}
+	assert.Equal(t, server, records[0]["server"])
+	assert.Contains(t, records[0], "query")
+	assert.Contains(t, records[0], "reply")
+	assert.Contains(t, lines[0]+lines[1], "192.0.2.10")
+	assert.Contains(t, lines[0]+lines[1], "2001:db8::10")
+	assert.Equal(t, closedAddr, records[2]["server"])
+	assert.NotContains(t, records[2], "reply")
+	assert.Contains(t, records[2]["error"], "refused")
+}
+
+func TestMainNDJSONProcessesReplies(t *testing.T) {
+	server := localZoneServer(t, `
+txt.example.com. 119 IN TXT "txtvers=1" "rp=ipp/print"
+`)
+	out, err := run("TXT", "txt.example.com", "@"+server, "--format", "ndjson", "--txtconcat", "--round-ttls")
+	assert.Nil(t, err)
+	assert.Contains(t, out.String(), `"txt":["txtvers=1rp=ipp/print"]`)
+	assert.Contains(t, out.String(), `"ttl":60`)
+}
+
+func TestMainReadNDJSON(t *testing.T) {
+	server := localZoneServer(t, browseZone)
+	path := filepath.Join(t.TempDir(), "q.dnstap")
+	_, err := run("A", "printer.example.com", "@"+server, "--dnstap", path)
+	assert.Nil(t, err)
+
+	out, err := run("--read", path, "--format", "ndjson", "--rfc8427")
+	assert.Nil(t, err)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 2)
+	assert.Contains(t, lines[0], `"query":{`)
+	assert.NotContains(t, lines[0], `"reply"`)
+	assert.Contains(t, lines[1], `"reply":{`)
+	assert.Contains(t, lines[1], `"rdataA":"192.0.2.10"`)
+}
+
+func TestMainFilterSelect(t *testing.T) {
+	server := localZoneServer(t, browseZone)
+	out, err := run("A", "AAAA", "printer.example.com", "@"+server, "--filter", `type == "AAAA"`, "--select", "owner,rdata", "--format", "column")
+	assert.Nil(t, err)
+	assert.Equal(t, "printer.example.com. 2001:db8::10\n", out.String())
+
+	out, err = run("A", "AAAA", "printer.example.com", "@"+server, "--filter", `rdata =~ "^192\\."`, "--format", "json")
+	assert.Nil(t, err)
+	assert.Contains(t, out.String(), "192.0.2.10")
+	assert.NotContains(t, out.String(), "2001:db8::10")
+
+	_, err = run("A", "printer.example.com", "@"+server, "--filter", `type ==`)
+	assert.NotNil(t, err)
+	_, err = run("A", "printer.example.com", "@"+server, "--select", "owner", "--format", "ndjson")
+	assert.NotNil(t, err)
+}
+
+func TestMainInteractive(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	server := localZoneServer(t, browseZone)
+	stdin = strings.NewReader(strings.Join([]string{
+		"printer.example.com A +short",
+		":set --format json",
+		":flags",
+		"printer.example.com AAAA",
+		":unset format",
+		":set --bogus",
+		":nope",
+		"--filter 'type == \"AAAA\"' printer.example.com A AAAA +short",
+		":server 127.0.0.1:1",
+		":server",
+		":reset",
+		":history",
+		":quit",
+		"never.example.com",
+	}, "\n"))
+	t.Cleanup(func() { stdin = os.Stdin })
+
+	out, err := run("-I", "@"+server)
+	assert.Nil(t, err)
+	lines := strings.Split(out.String(), "\n")
+	assert.Equal(t, "192.0.2.10", lines[0])
+	assert.Equal(t, "+nocolor @"+server+" --format json", lines[1])
+	assert.Contains(t, out.String(), `"2001:db8::10"`)
+	assert.Contains(t, out.String(), "\n2001:db8::10\n@127.0.0.1:1\n")
+	assert.Contains(t, out.String(), "   4  printer.example.com AAAA\n")
+	assert.NotContains(t, out.String(), "never.example.com")
+	assert.Nil(t, cachedTransports)
+
+	history, err := os.ReadFile(filepath.Join(home, ".q_history"))
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(history), "printer.example.com A +short\n"))
+}
+
+func TestMainInteractiveErrors(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Chdir(t.TempDir())
+	server := localZoneServer(t, browseZone)
+	stdin = strings.NewReader(strings.Join([]string{
+		"+recaxfr example.com @tcp://127.0.0.1:1",
+		"--subnet bogus printer.example.com A",
+		"--help",
+		"printer.example.com A +short",
+	}, "\n"))
+	t.Cleanup(func() { stdin = os.Stdin })
+
+	out, err := run("-I", "@"+server)
+	assert.Nil(t, err)
+	assert.Contains(t, out.String(), "Attempting recursive AXFR for example.com")
+	assert.True(t, strings.HasSuffix(out.String(), "192.0.2.10\n"))
+
+	history, err := os.ReadFile(filepath.Join(home, ".q_history"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(history), "printer.example.com A +short\n")
+}
+
+func TestMainErrors(t *testing.T) {
+	t.Chdir(t.TempDir())
+	_, err := run("+recaxfr", "@tcp://127.0.0.1:1", "example.com")
+	assert.ErrorContains(t, err, "recursive AXFR: transferring zone example.com.")
+	_, err = run("--subnet", "bogus", "example.com")
+	assert.ErrorContains(t, err, "parsing subnet bogus")
+	_, err = run("--help")
+	assert.ErrorIs(t, err, errHelp)
+}
+
+func TestMainInteractiveTransports(t *testing.T) {
+	cachedTransports = make(map[string]*transport.Transport)
+	transportsInUse = make(map[*transport.Transport]bool)
+	t.Cleanup(func() {
+		cachedTransports = nil
+		transportsInUse = nil
+	})
+
+	first, err := openTransport("127.0.0.1:53", transport.TypePlain, nil)
+	assert.Nil(t, err)
+	second, err := openTransport("127.0.0.1:53", transport.TypePlain, nil)
+	assert.Nil(t, err)
+	assert.Same(t, first, second)
+
+	transportFlags = "--tcp"
+	t.Cleanup(func() { transportFlags = "" })
+	other, err := openTransport("127.0.0.1:53", transport.TypePlain, nil)
+	assert.Nil(t, err)
+	assert.NotSame(t, first, other)
+
+	assert.Nil(t, closeTransport(first, false))
+	assert.Len(t, cachedTransports, 2)
+	assert.Nil(t, closeTransport(first, true))
+	assert.Len(t, cachedTransports, 1)
+
+	// Transports still used by a query that timed out aren't given to the next query
+	assert.Nil(t, closeTransport(other, false))
+	transportFlags = ""
+	busy, err := openTransport("127.0.0.1:53", transport.TypePlain, nil)
+	assert.Nil(t, err)
+	abandonTransports()
+	assert.Len(t, cachedTransports, 1)
+	next, err := openTransport("127.0.0.1:53", transport.TypePlain, nil)
+	assert.Nil(t, err)
+	assert.NotSame(t, busy, next)
+	assert.Nil(t, closeTransport(busy, false))
+	assert.False(t, transportsInUse[busy])
+}
+
+func TestMainInteractiveArgs(t *testing.T) {
+	args, err := splitArgs(`example.com --filter 'type == "A"' "two words" a\ b +short`)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"example.com", "--filter", `type == "A"`, "two words", "a b", "+short"}, args)
+	_, err = splitArgs(`--filter 'type`)
+	assert.NotNil(t, err)
+
+	session := []string{"@1.1.1.1", "--format", "json", "-t", "A", "+short", "--stats=true"}
+	assert.Equal(t, []string{"@1.1.1.1", "-t", "A", "+short", "--stats=true"}, unsetFlag(session, "format"))
+	assert.Equal(t, []string{"@1.1.1.1", "--format", "json", "+short", "--stats=true"}, unsetFlag(session, "type"))
+	assert.Equal(t, []string{"@1.1.1.1", "--format", "json", "-t", "A", "--stats=true"}, unsetFlag(session, "+short"))
+	assert.Equal(t, []string{"@1.1.1.1", "--format", "json", "-t", "A", "+short"}, unsetFlag(session, "S"))
+
+	complete := replCompleter()
+	assert.Equal(t, []string{":server", ":set"}, complete(":se"))
+	assert.Equal(t, []string{"AAAA"}, complete("aaa"))
+	assert.Contains(t, complete("--form"), "--format")
+	assert.Equal(t, []string{"+noshort", "+noshort-ttls"}, complete("+nosho"))
+	assert.Equal(t, []string{"@quad9", "@quad9/doh", "@quad9/doq", "@quad9/dot", "@quad9/tcp", "@quad9/udp"}, complete("@qu"))
+	assert.Nil(t, complete(""))
+}
+
+func TestMainConfigFile(t *testing.T) {
+	server := localZoneServer(t, browseZone)
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	assert.Nil(t, os.WriteFile(config, []byte(`
+defaults: --filter 'type != "AAAA"'
+servers:
+  zone:
+    address: `+server+`
+    flags: [--select, rdata]
+profiles:
+  owners:
+    servers: [zone]
+    flags: --select owner,rdata
+`), 0600))
+
+	out, err := run("--config", config, "printer.example.com", "A", "AAAA", "@zone")
+	assert.Nil(t, err)
+	assert.Equal(t, "192.0.2.10\n", out.String())
+
+	out, err = run("--config", config, "--profile", "owners", "printer.example.com", "A")
+	assert.Nil(t, err)
+	assert.Equal(t, "printer.example.com. 192.0.2.10\n", out.String())
+
+	out, err = run("--config", config, "--profile=owners", "--select", "type", "printer.example.com", "A")
+	assert.Nil(t, err)
+	assert.Equal(t, "A\n", out.String())
+
+	_, err = run("--config", config, "--profile", "missing", "printer.example.com")
+	assert.ErrorContains(t, err, "unknown profile missing")
+	_, err = run("--config", filepath.Join(t.TempDir(), "missing.yaml"), "printer.example.com")
+	assert.NotNil(t, err)
+
+	// The config file in the user config directory is used by default, and servers given by address use the flags of
+	// the first server name with that address
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	assert.Nil(t, os.Mkdir(filepath.Join(dir, "q"), 0700))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "q", "config.yaml"), []byte(`
+servers:
+  zz:
+    address: `+server+`
+    flags: [--select, rdata]
+  aa:
+    address: `+server+`
+    flags: [--select, owner]
+`), 0600))
+	for i := 0; i < 10; i++ {
+		out, err = run("printer.example.com", "A", "@"+server)
+		assert.Nil(t, err)
+		assert.Equal(t, "printer.example.com.\n", out.String())
+	}
+
+	assert.Nil(t, os.WriteFile(config, []byte("servers:\n  zone:\n    adress: 192.0.2.1\n"), 0600))
+	_, err = run("--config", config, "printer.example.com")
+	assert.ErrorContains(t, err, "field adress not found")
+}
+
+func TestMainPublicResolvers(t *testing.T) {
+	out, err := run("--list-resolvers")
+	assert.Nil(t, err)
+	assert.Contains(t, out.String(), "quad9 Quad9")
+	assert.Contains(t, out.String(), "  doq      quic://dns.quad9.net\n")
+
+	_, err = run("example.com", "@google/doq")
+	assert.ErrorContains(t, err, "server google/doq: google doesn't support doq")
+}
+
+func TestMainResolverList(t *testing.T) {
+	server := localZoneServer(t, browseZone)
+	stamp := func(props dnsstamps.ServerInformalProperties) string {
+		s := dnsstamps.ServerStamp{Proto: dnsstamps.StampProtoTypePlain, ServerAddrStr: server, Props: props}
+		return s.String()
+	}
+	relay := dnsstamps.ServerStamp{Proto: dnsstamps.StampProtoTypeDNSCryptRelay, ServerAddrStr: "192.0.2.1:443"}
+	list := filepath.Join(t.TempDir(), "public-resolvers.md")
+	assert.Nil(t, os.WriteFile(list, []byte(`# test resolvers
+
+## local-logging
+
+Logs queries
+
+`+stamp(dnsstamps.ServerInformalPropertyDNSSEC)+`
+
+## local-private
+
+Doesn't log queries
+
+`+stamp(dnsstamps.ServerInformalPropertyDNSSEC|dnsstamps.ServerInformalPropertyNoLog)+`
+
+## relay
+
+`+relay.String()+"\n"), 0600))
+
+	out, err := run("--resolver-list", list, "@local-private", "printer.example.com", "A", "+short")
+	assert.Nil(t, err)
+	assert.Equal(t, "192.0.2.10\n", out.String())
+
+	out, err = run("--resolver-list", list, "--resolver-match", `nolog && protocol == "udp"`, "printer.example.com", "A", "--format", "json")
+	assert.Nil(t, err)
+	var entries []map[string]any
+	assert.Nil(t, json.Unmarshal(out.Bytes(), &entries))
+	assert.Len(t, entries, 1)
+
+	out, err = run("--resolver-list", list, "--resolver-match", "dnssec", "printer.example.com", "A", "--format", "json")
+	assert.Nil(t, err)
+	assert.Nil(t, json.Unmarshal(out.Bytes(), &entries))
+	assert.Len(t, entries, 2)
+
+	out, err = run("--resolver-list", list, "--list-resolvers", "--resolver-match", `name =~ "^local"`)
+	assert.Nil(t, err)
+	assert.Equal(t, "local-logging udp      dnssec\nlocal-private udp      dnssec no-log\n", out.String())
+
+	_, err = run("--resolver-list", list, "@relay", "printer.example.com")
+	assert.ErrorContains(t, err, "relay is a relay server and can't be queried directly")
+	_, err = run("--resolver-list", list, "--resolver-match", "nofilter", "printer.example.com")
+	assert.ErrorContains(t, err, "no resolvers in")
+	_, err = run("--resolver-match", "nolog", "printer.example.com")
+	assert.ErrorContains(t, err, "--resolver-match requires --resolver-list")
+}
+
+func TestMainStub(t *testing.T) {
+	server := localZoneServer(t, browseZone)
+	conf := filepath.Join(t.TempDir(), "resolv.conf")
+	assert.Nil(t, os.WriteFile(conf, []byte(`nameserver 127.0.0.1:1
+nameserver `+server+`
+search corp.example example.com
+options ndots:2 timeout:1 attempts:1 rotate
+`), 0600))
+
+	out, err := run("--stub", "--resolv-conf", conf, "printer", "A")
+	assert.Nil(t, err)
+	assert.Contains(t, out.String(), "Search:\n"+
+		"printer.corp.example. NOERROR from "+server+"\n"+
+		"printer.example.com. NOERROR from "+server+" (answered)\n")
+	assert.Contains(t, out.String(), "Answer:\nprinter.example.com. 1m A 192.0.2.10\n")
+
+	out, err = run("--stub", "--resolv-conf", conf, "printer", "AAAA", "+short")
+	assert.Nil(t, err)
+	assert.Equal(t, "2001:db8::10\n", out.String())
+
+	out, err = run("--stub", "--resolv-conf", conf, "missing", "A", "--format", "json")
+	assert.Nil(t, err)
+	var entries []struct{ Search []output.SearchAttempt }
+	assert.Nil(t, json.Unmarshal(out.Bytes(), &entries))
+	assert.Len(t, entries, 1)
+	assert.Equal(t, []output.SearchAttempt{
+		{Name: "missing.corp.example.", Server: server, Rcode: "NOERROR"},
+		{Name: "missing.example.com.", Server: server, Rcode: "NOERROR"},
+		{Name: "missing.", Server: server, Rcode: "NOERROR"},
+	}, entries[0].Search)
+
+	// Servers given on the command line replace the nameservers
+	out, err = run("--stub", "--resolv-conf", conf, "@"+server, "printer.example.com", "A", "+short")
+	assert.Nil(t, err)
+	assert.Equal(t, "192.0.2.10\n", out.String())
+
+	// A name without the queried type is shown over later names that don't exist
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	nxServer := &dns.Server{PacketConn: conn, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		switch {
+		case len(r.Question) == 0:
+			m.Rcode = dns.RcodeServerFailure
+		case r.Question[0].Name != "printer.example.com.":
+			m.Rcode = dns.RcodeNameError
+		}
+		_ = w.WriteMsg(m)
+	}), MsgAcceptFunc: func(dns.Header) dns.MsgAcceptAction { return dns.MsgAccept }}
+	go func() { _ = nxServer.ActivateAndServe() }()
+	t.Cleanup(func() { _ = nxServer.Shutdown() })
+	nxConf := filepath.Join(t.TempDir(), "resolv.conf")
+	assert.Nil(t, os.WriteFile(nxConf, []byte("nameserver "+conn.LocalAddr().String()+"\nsearch corp.example example.com\noptions ndots:2\n"), 0600))
+	out, err = run("--stub", "--resolv-conf", nxConf, "printer", "TXT", "--format", "json")
+	assert.Nil(t, err)
+	var nodata []struct {
+		Replies []struct {
+			Rcode    int
+			Question []struct{ Name string }
+		}
+	}
+	assert.Nil(t, json.Unmarshal(out.Bytes(), &nodata))
+	assert.Len(t, nodata, 1)
+	assert.Equal(t, dns.RcodeSuccess, nodata[0].Replies[0].Rcode)
+	assert.Equal(t, "printer.example.com.", nodata[0].Replies[0].Question[0].Name)
+
+	// Messages without a question don't break logging
+	_, err = run("--stub", "--resolv-conf", nxConf, "--send-wire", "123401000000000000000000", "-v")
+	assert.Nil(t, err)
+
+	// Replies with the wrong ID are skipped like failures, and the bytes received are kept for wire output
+	badID, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	badIDServer := &dns.Server{Listener: badID, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Id++
+		_ = w.WriteMsg(m)
+	})}
+	go func() { _ = badIDServer.ActivateAndServe() }()
+	t.Cleanup(func() { _ = badIDServer.Shutdown() })
+	out, err = run("--stub", "--resolv-conf", conf, "@tcp://"+badID.Addr().String(), "@"+server, "printer.example.com", "A", "--format", "wire")
+	assert.Nil(t, err)
+	assert.Contains(t, out.String(), ";; Response (")
+	assert.Contains(t, out.String(), "192.0.2.10")
+
+	// The whole search is bounded by the timeout
+	silent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = silent.Close() })
+	silentConf := filepath.Join(t.TempDir(), "resolv.conf")
+	assert.Nil(t, os.WriteFile(silentConf, []byte("nameserver "+silent.LocalAddr().String()+"\nsearch a.example b.example\noptions attempts:5\n"), 0600))
+	start := time.Now()
+	_, err = run("--stub", "--resolv-conf", silentConf, "printer", "--timeout", "100ms")
+	assert.ErrorContains(t, err, "timeout after 100ms")
+	assert.Less(t, time.Since(start), time.Second)
+
+	empty := filepath.Join(t.TempDir(), "resolv.conf")
+	assert.Nil(t, os.WriteFile(empty, []byte("search example.com\n"), 0600))
+	_, err = run("--stub", "--resolv-conf", empty, "printer")
+	assert.ErrorContains(t, err, "no nameservers in")
+}
+
+func TestMainSourcePortTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	server := &dns.Server{Listener: listener, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		_ = w.WriteMsg(m)
+	})}
+	go func() { _ = server.ActivateAndServe() }()
+	t.Cleanup(func() { _ = server.Shutdown() })
+
+	free, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	sourcePort := strconv.Itoa(free.Addr().(*net.TCPAddr).Port)
+	assert.Nil(t, free.Close())
+
+	out, err := run("A", "AAAA", "MX", "example.com", "@tcp://"+listener.Addr().String(), "--source-port", sourcePort, "--format", "json")
+	assert.Nil(t, err)
+	var entries []map[string]any
+	assert.Nil(t, json.Unmarshal(out.Bytes(), &entries))
+	assert.Len(t, entries, 1)
+	assert.Len(t, entries[0]["replies"], 3)
+}
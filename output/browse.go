@@ -0,0 +1,76 @@
+package output
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/natesales/q/util"
+)
+
+// Service is a DNS-SD service type and its instances
+type Service struct {
+	Type      string
+	Instances []*Instance
+}
+
+// Instance is a DNS-SD service instance resolved from its SRV, TXT and address records
+type Instance struct {
+	Name      string
+	Host      string   `json:",omitempty" yaml:",omitempty"`
+	Port      uint16   `json:",omitempty" yaml:",omitempty"`
+	TXT       []string `json:",omitempty" yaml:",omitempty"`
+	Addresses []string `json:",omitempty" yaml:",omitempty"`
+}
+
+// Label returns the unescaped instance label without the service type, such as "Office Printer"
+func (i *Instance) Label(serviceType string) string {
+	return string(util.Unescape(strings.TrimSuffix(i.Name, "."+serviceType)))
+}
+
+// treeBranch returns the prefix of a tree node and the indent for its children
+func treeBranch(indent string, last bool) (string, string) {
+	if last {
+		return indent + "└── ", indent + "    "
+	}
+	return indent + "├── ", indent + "│   "
+}
+
+// PrintBrowse prints the DNS-SD services of each entry as a tree
+func (p Printer) PrintBrowse(entries []*Entry) {
+	for _, entry := range entries {
+		root := p.Opts.Name
+		if len(entries) > 1 {
+			root += fmt.Sprintf(" (%s)", entry.Server)
+		}
+		util.MustWriteln(p.Out, util.Color(util.ColorWhite, root))
+		if len(entry.Services) == 0 {
+			util.MustWriteln(p.Out, "└── no services found")
+			continue
+		}
+
+		for i, service := range entry.Services {
+			prefix, indent := treeBranch("", i == len(entry.Services)-1)
+			util.MustWritef(p.Out, "%s%s\n", prefix, util.Color(util.ColorPurple, service.Type))
+
+			for j, instance := range service.Instances {
+				prefix, indent := treeBranch(indent, j == len(service.Instances)-1)
+				util.MustWritef(p.Out, "%s%s\n", prefix, util.Color(util.ColorGreen, instance.Label(service.Type)))
+
+				var details []string
+				if instance.Host != "" {
+					details = append(details, fmt.Sprintf("host %s", util.Color(util.ColorTeal, fmt.Sprintf("%s:%d", instance.Host, instance.Port))))
+				}
+				if len(instance.Addresses) > 0 {
+					details = append(details, fmt.Sprintf("addresses %s", util.Color(util.ColorTeal, strings.Join(instance.Addresses, ", "))))
+				}
+				if len(instance.TXT) > 0 {
+					details = append(details, fmt.Sprintf("txt %s", util.Color(util.ColorMagenta, strings.Join(instance.TXT, " "))))
+				}
+				for k, detail := range details {
+					prefix, _ := treeBranch(indent, k == len(details)-1)
+					util.MustWritef(p.Out, "%s%s\n", prefix, detail)
+				}
+			}
+		}
+	}
+}
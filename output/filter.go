@@ -0,0 +1,233 @@
+package output
+
+import (
+	"encoding/csv"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+	"gopkg.in/yaml.v3"
+
+	"github.com/natesales/q/util"
+	"github.com/natesales/q/util/expr"
+)
+
+// RRFields are the RR fields available to --filter and --select
+var RRFields = []string{"server", "qname", "qtype", "rcode", "section", "owner", "ttl", "class", "type", "rdata"}
+
+// ParseFilter parses a --filter expression over RRFields
+func ParseFilter(s string) (*expr.Expr, error) {
+	e, err := expr.Parse(s, RRFields)
+	if err != nil {
+		return nil, fmt.Errorf("parsing filter: %w", err)
+	}
+	return e, nil
+}
+
+// ParseSelect parses a comma separated --select field list
+func ParseSelect(s string) ([]string, error) {
+	var fields []string
+	for _, f := range strings.Split(s, ",") {
+		f = strings.ToLower(strings.TrimSpace(f))
+		if f == "name" {
+			f = "owner"
+		}
+		if !slices.Contains(RRFields, f) {
+			return nil, fmt.Errorf("unknown select field %q (expected one of %s)", f, strings.Join(RRFields, ", "))
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// rrFields returns the values of RRFields for an RR in a section of a reply
+func rrFields(server string, reply *dns.Msg, section string, rr dns.RR) map[string]any {
+	h := rr.Header()
+	fields := map[string]any{
+		"server":  server,
+		"rcode":   dns.RcodeToString[reply.Rcode],
+		"section": section,
+		"owner":   h.Name,
+		"ttl":     h.Ttl,
+		"class":   dns.Class(h.Class).String(),
+		"type":    dns.Type(h.Rrtype).String(),
+		"rdata":   strings.TrimSpace(rdata(rr)),
+	}
+	if len(reply.Question) > 0 {
+		fields["qname"] = reply.Question[0].Name
+		fields["qtype"] = dns.Type(reply.Question[0].Qtype).String()
+	}
+	return fields
+}
+
+// FilterReply removes the RRs that don't match a filter from the answer, authority and additional sections of a reply.
+// The OPT pseudo-RR is always kept.
+func FilterReply(server string, reply *dns.Msg, filter *expr.Expr) error {
+	keep := func(section string, rrs []dns.RR) ([]dns.RR, error) {
+		var out []dns.RR
+		for _, rr := range rrs {
+			if rr.Header().Rrtype == dns.TypeOPT {
+				out = append(out, rr)
+				continue
+			}
+			ok, err := filter.Match(rrFields(server, reply, section, rr))
+			if err != nil {
+				return nil, fmt.Errorf("evaluating filter: %w", err)
+			}
+			if ok {
+				out = append(out, rr)
+			}
+		}
+		return out, nil
+	}
+
+	var err error
+	if reply.Answer, err = keep("answer", reply.Answer); err != nil {
+		return err
+	}
+	if reply.Ns, err = keep("authority", reply.Ns); err != nil {
+		return err
+	}
+	reply.Extra, err = keep("additional", reply.Extra)
+	return err
+}
+
+// FilterEntries applies a filter to every reply in a slice of entries
+func FilterEntries(entries []*Entry, filter *expr.Expr) error {
+	for _, entry := range entries {
+		for _, reply := range entry.Replies {
+			if err := FilterReply(entry.Server, reply, filter); err != nil {
+				return err
+			}
+		}
+		for _, r := range entry.Responses {
+			if err := FilterReply(entry.Server, r.Reply, filter); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// selectRows returns the selected field values of each RR in the shown sections
+func (p Printer) selectRows(entries []*Entry, fields []string) []map[string]any {
+	var rows []map[string]any
+	for _, entry := range entries {
+		for _, reply := range entry.Replies {
+			sections := []struct {
+				name string
+				show bool
+				rrs  []dns.RR
+			}{
+				{"answer", p.Opts.ShowAnswer, reply.Answer},
+				{"authority", p.Opts.ShowAuthority, reply.Ns},
+				{"additional", p.Opts.ShowAdditional, reply.Extra},
+			}
+			for _, s := range sections {
+				if !s.show {
+					continue
+				}
+				for _, rr := range s.rrs {
+					if rr.Header().Rrtype == dns.TypeOPT {
+						continue
+					}
+					all := rrFields(entry.Server, reply, s.name, rr)
+					row := make(map[string]any, len(fields))
+					for _, f := range fields {
+						row[f] = all[f]
+					}
+					rows = append(rows, row)
+				}
+			}
+		}
+	}
+	return rows
+}
+
+// selectColor returns the pretty output color of a field, or an empty string for no color
+func selectColor(field string) string {
+	switch field {
+	case "owner", "qname":
+		return util.ColorPurple
+	case "ttl":
+		return util.ColorGreen
+	case "type", "qtype":
+		return util.ColorMagenta
+	case "server":
+		return util.ColorTeal
+	}
+	return ""
+}
+
+// PrintSelect prints the --select fields of each RR in the shown sections
+func (p Printer) PrintSelect(entries []*Entry) error {
+	fields, err := ParseSelect(p.Opts.Select)
+	if err != nil {
+		return err
+	}
+	rows := p.selectRows(entries, fields)
+
+	switch p.Opts.Format {
+	case FormatPretty, FormatColumn:
+		// Format values as they appear in pretty output
+		lines := make([][]string, len(rows))
+		widths := make([]int, len(fields))
+		for i, row := range rows {
+			for j, f := range fields {
+				v := fmt.Sprint(row[f])
+				if f == "ttl" {
+					v = formatTTL(row[f].(uint32), p.Opts)
+				}
+				lines[i] = append(lines[i], v)
+				widths[j] = max(widths[j], len(v))
+			}
+		}
+		for _, line := range lines {
+			for j, v := range line {
+				if p.Opts.Format == FormatColumn && j < len(line)-1 {
+					v += strings.Repeat(" ", widths[j]-len(v))
+				}
+				if c := selectColor(fields[j]); c != "" {
+					v = util.Color(c, v)
+				}
+				line[j] = v
+			}
+			util.MustWriteln(p.Out, strings.Join(line, " "))
+		}
+	case FormatJSON, FormatYAML, "yml":
+		var b []byte
+		if p.Opts.Format == FormatJSON {
+			b, err = marshalJSON(rows)
+		} else {
+			b, err = yaml.Marshal(rows)
+		}
+		if err != nil {
+			return fmt.Errorf("marshaling output: %w", err)
+		}
+		util.MustWriteln(p.Out, string(b))
+	case FormatCSV, FormatTSV:
+		w := csv.NewWriter(p.Out)
+		if p.Opts.Format == FormatTSV {
+			w.Comma = '\t'
+		}
+		_ = w.Write(fields)
+		for _, row := range rows {
+			var record []string
+			for _, f := range fields {
+				if ttl, ok := row[f].(uint32); ok {
+					record = append(record, strconv.Itoa(int(ttl)))
+				} else {
+					record = append(record, fmt.Sprint(row[f]))
+				}
+			}
+			_ = w.Write(record)
+		}
+		w.Flush()
+		return w.Error()
+	default:
+		return fmt.Errorf("--select isn't supported with the %s format", p.Opts.Format)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/natesales/q/cli"
+)
+
+// filterEntries returns an entry with answer, authority and additional records
+func filterEntries(t *testing.T) []*Entry {
+	reply := new(dns.Msg).SetQuestion("example.com.", dns.TypeA)
+	reply.Response = true
+	for _, s := range []string{"example.com. 60 IN A 192.0.2.1", "example.com. 3600 IN A 192.0.2.2", "example.com. 300 IN CNAME www.example.com."} {
+		rr, err := dns.NewRR(s)
+		assert.Nil(t, err)
+		reply.Answer = append(reply.Answer, rr)
+	}
+	ns, err := dns.NewRR("example.com. 86400 IN NS ns.example.com.")
+	assert.Nil(t, err)
+	glue, err := dns.NewRR("ns.example.com. 86400 IN A 192.0.2.53")
+	assert.Nil(t, err)
+	reply.Ns = []dns.RR{ns}
+	reply.Extra = []dns.RR{glue}
+	reply.SetEdns0(1232, false)
+	return []*Entry{{Server: "192.0.2.10", Replies: []*dns.Msg{reply}}}
+}
+
+func TestOutputFilterEntries(t *testing.T) {
+	entries := filterEntries(t)
+	filter, err := ParseFilter(`type == "A" && ttl < 300 || section == "additional"`)
+	assert.Nil(t, err)
+	assert.Nil(t, FilterEntries(entries, filter))
+
+	reply := entries[0].Replies[0]
+	assert.Len(t, reply.Answer, 1)
+	assert.Equal(t, "192.0.2.1", reply.Answer[0].(*dns.A).A.String())
+	assert.Empty(t, reply.Ns)
+	assert.Len(t, reply.Extra, 2)
+	assert.NotNil(t, reply.IsEdns0())
+
+	_, err = ParseFilter(`typ == "A"`)
+	assert.NotNil(t, err)
+}
+
+func TestOutputPrintSelect(t *testing.T) {
+	disableColor(t)
+	var buf bytes.Buffer
+	p := Printer{Out: &buf, Opts: &cli.Flags{Format: "pretty", Select: "rdata", ShowAnswer: true}}
+	assert.Nil(t, p.PrintSelect(filterEntries(t)))
+	assert.Equal(t, "192.0.2.1\n192.0.2.2\nwww.example.com.\n", buf.String())
+
+	buf.Reset()
+	p.Opts = &cli.Flags{Format: "column", Select: "type,ttl,rdata", ShowAuthority: true}
+	assert.Nil(t, p.PrintSelect(filterEntries(t)))
+	assert.Equal(t, "NS 86400 ns.example.com.\n", buf.String())
+
+	buf.Reset()
+	p.Opts = &cli.Flags{Format: "json", Select: "name,ttl", ShowAdditional: true}
+	assert.Nil(t, p.PrintSelect(filterEntries(t)))
+	assert.Equal(t, `[{"owner":"ns.example.com.","ttl":86400}]`+"\n", buf.String())
+
+	buf.Reset()
+	p.Opts = &cli.Flags{Format: "csv", Select: "section,type", ShowAnswer: true, ShowAuthority: true}
+	assert.Nil(t, p.PrintSelect(filterEntries(t)))
+	assert.Equal(t, "section,type\nanswer,A\nanswer,A\nanswer,CNAME\nauthority,NS\n", buf.String())
+
+	p.Opts = &cli.Flags{Format: "zone", Select: "rdata"}
+	assert.NotNil(t, p.PrintSelect(filterEntries(t)))
+	p.Opts = &cli.Flags{Format: "pretty", Select: "rdata,bogus"}
+	assert.NotNil(t, p.PrintSelect(filterEntries(t)))
+}
@@ -0,0 +1,75 @@
+package output
+
+import (
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/miekg/dns"
+
+	"github.com/natesales/q/util"
+)
+
+// NDJSONRecord is a line of ndjson output for one exchange
+type NDJSONRecord struct {
+	Server    string        `json:"server"`
+	Timestamp time.Time     `json:"timestamp"`
+	Time      time.Duration `json:"time"` // nanoseconds
+	Query     any           `json:"query,omitempty"`
+	Reply     any           `json:"reply,omitempty"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// ndjsonMsg returns the JSON representation of a message, or nil if there isn't one
+func (p Printer) ndjsonMsg(m *dns.Msg, t time.Time) any {
+	if m == nil {
+		return nil
+	}
+	if p.Opts.RFC8427 {
+		return toRFC8427(m, "", t)
+	}
+	return m
+}
+
+// WriteNDJSON writes an exchange as a single line of JSON
+func (p Printer) WriteNDJSON(server string, query, reply *dns.Msg, t time.Time, rtt time.Duration, err error) {
+	record := NDJSONRecord{
+		Server:    server,
+		Timestamp: t,
+		Time:      rtt,
+		Query:     p.ndjsonMsg(query, t.Add(-rtt)),
+		Reply:     p.ndjsonMsg(reply, t),
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	b, err := marshalJSON(record)
+	if err != nil {
+		log.Warnf("error marshaling output: %s", err)
+		return
+	}
+	util.MustWriteln(p.Out, string(b))
+}
+
+// PrintNDJSON writes each reply in a slice of entries as a line of JSON, or the whole entry for
+// entries without replies such as browse results
+func (p Printer) PrintNDJSON(entries []*Entry) {
+	for _, entry := range entries {
+		if len(entry.Replies) == 0 {
+			b, err := marshalJSON(entry)
+			if err != nil {
+				log.Warnf("error marshaling output: %s", err)
+				continue
+			}
+			util.MustWriteln(p.Out, string(b))
+			continue
+		}
+		for i, reply := range entry.Replies {
+			var query *dns.Msg
+			if i < len(entry.Queries) {
+				query = &entry.Queries[i]
+			}
+			p.WriteNDJSON(entry.Server, query, reply, entry.timestamp(), entry.Time, nil)
+		}
+	}
+}
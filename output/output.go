@@ -1,7 +1,11 @@
 package output
 
 import (
+	"encoding/base64"
+	"fmt"
 	"io"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/natesales/q/transport"
@@ -13,11 +17,17 @@ import (
 )
 
 var (
-	FormatPretty = "pretty"
-	FormatColumn = "column"
-	FormatJSON   = "json"
-	FormatYAML   = "yaml"
-	FormatRAW    = "raw"
+	FormatPretty   = "pretty"
+	FormatColumn   = "column"
+	FormatJSON     = "json"
+	FormatYAML     = "yaml"
+	FormatRAW      = "raw"
+	FormatWire     = "wire"
+	FormatNDJSON   = "ndjson"
+	FormatCSV      = "csv"
+	FormatTSV      = "tsv"
+	FormatZone     = "zone"
+	FormatTemplate = "template"
 )
 
 // Printer stores global options across multiple entries
@@ -39,10 +49,42 @@ type Entry struct {
 	// Time is the total time it took to query this server
 	Time time.Duration
 
+	// Timestamp is when a message read from a capture file was sent
+	Timestamp *time.Time `json:",omitempty" yaml:",omitempty"`
+
+	// ConnState is the connection state reported by the transport
+	ConnState *transport.ConnState `json:",omitempty" yaml:",omitempty"`
+
+	// Responses are the replies from each responder to an mDNS query
+	Responses []transport.MDNSResponse `json:",omitempty" yaml:",omitempty"`
+
+	// Services are the DNS-SD services found in browse mode
+	Services []*Service `json:",omitempty" yaml:",omitempty"`
+
+	// Wire are the packed queries and replies as sent and received, for transports that record them
+	Wire []transport.Wire `json:"-" yaml:"-"`
+
+	// Search are the names tried in stub mode, ending with the one that answered
+	Search []SearchAttempt `json:",omitempty" yaml:",omitempty"`
+
 	PTRs        map[string]string `json:"-"` // IP -> PTR value
 	existingRRs map[string]bool
 }
 
+// SearchAttempt is a candidate name tried by the stub resolver and the response to it
+type SearchAttempt struct {
+	Name string
+
+	// Server is the nameserver that replied, if any
+	Server string `json:",omitempty" yaml:",omitempty"`
+
+	// Rcode is the response code, or the error if no nameserver replied
+	Rcode string
+
+	// Answered is true if the name had answers and ended the search
+	Answered bool
+}
+
 // LoadPTRs populates an entry's PTRs map with PTR values for all A/AAAA records
 func (e *Entry) LoadPTRs(txp *transport.Transport) {
 	// Initialize PTR cache if it doesn't exist
@@ -85,3 +127,82 @@ func (e *Entry) LoadPTRs(txp *transport.Transport) {
 		}
 	}
 }
+
+// rdata returns the presentation format of an RR's data
+func rdata(rr dns.RR) string {
+	return strings.TrimPrefix(rr.String(), rr.Header().String())
+}
+
+// timestamp returns the capture time of an entry read from a file, or the current time
+func (e *Entry) timestamp() time.Time {
+	if e.Timestamp != nil {
+		return *e.Timestamp
+	}
+	return time.Now()
+}
+
+// responders returns the addresses of the mDNS responders that sent a record
+func (e *Entry) responders(rr dns.RR) []string {
+	var out []string
+	for _, r := range e.Responses {
+		if slices.Contains(out, r.From) {
+			continue
+		}
+		for _, sent := range r.Reply.Answer {
+			if dns.IsDuplicate(sent, rr) {
+				out = append(out, r.From)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// responderAddrs returns the unique addresses of the mDNS responders in an entry
+func (e *Entry) responderAddrs() []string {
+	var out []string
+	for _, r := range e.Responses {
+		if !slices.Contains(out, r.From) {
+			out = append(out, r.From)
+		}
+	}
+	return out
+}
+
+// echStatus returns a human readable ECH status for a connection state, or an empty string if ECH wasn't offered
+func echStatus(s *transport.ConnState) string {
+	if s == nil || !s.ECHOffered {
+		return ""
+	}
+	if s.ECHAccepted {
+		return "accepted"
+	}
+	if len(s.ECHRetryConfigs) > 0 {
+		return "rejected (retry configs: " + base64.StdEncoding.EncodeToString(s.ECHRetryConfigs) + ")"
+	}
+	return "rejected"
+}
+
+// handshakeStats returns a summary of full and resumed TLS handshakes for a connection state, or an empty string if there were none
+func handshakeStats(s *transport.ConnState) string {
+	if s == nil || s.FullHandshakes+s.ResumedHandshakes == 0 {
+		return ""
+	}
+
+	out := fmt.Sprintf("%d full", s.FullHandshakes)
+	if s.FullHandshakes > 0 {
+		out += fmt.Sprintf(" (avg %s)", (s.FullHandshakeTime / time.Duration(s.FullHandshakes)).Round(100*time.Microsecond))
+	}
+	out += fmt.Sprintf(", %d resumed", s.ResumedHandshakes)
+	if s.ResumedHandshakes > 0 {
+		out += fmt.Sprintf(" (avg %s", (s.ResumedHandshakeTime / time.Duration(s.ResumedHandshakes)).Round(100*time.Microsecond))
+		if s.ZeroRTTHandshakes > 0 {
+			out += fmt.Sprintf(", %d 0-RTT", s.ZeroRTTHandshakes)
+		}
+		out += ")"
+	}
+	if saved := s.HandshakeTimeSaved(); saved > 0 {
+		out += fmt.Sprintf(", saved %s", saved.Round(100*time.Microsecond))
+	}
+	return out
+}
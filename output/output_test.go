@@ -2,11 +2,21 @@ package output
 
 import (
 	"strings"
+	"testing"
 	"time"
 
 	"github.com/miekg/dns"
+
+	"github.com/natesales/q/util"
 )
 
+// disableColor turns off colored output for the rest of a test
+func disableColor(t *testing.T) {
+	useColor := util.UseColor
+	util.UseColor = false
+	t.Cleanup(func() { util.UseColor = useColor })
+}
+
 // replies returns a slice of example DNS answer messages
 func replies() []*dns.Msg {
 	testZone := `
@@ -53,6 +53,19 @@ func (p Printer) PrettyPrintNSID(entries []*Entry, printPrefix bool) {
 	}
 }
 
+// formatTTL formats a TTL as seconds, or as a duration if pretty TTLs are enabled
+func formatTTL(ttl uint32, opts *cli.Flags) string {
+	if !opts.PrettyTTLs {
+		return fmt.Sprintf("%d", ttl)
+	}
+	s := (time.Duration(ttl) * time.Second).String()
+	if opts.ShortTTLs {
+		s = strings.ReplaceAll(s, "m0s", "m")
+		s = strings.ReplaceAll(s, "h0m", "h")
+	}
+	return s
+}
+
 // parseRR converts an RR into a pretty string and returns the qname, ttl, type, value, and whether to skip printing it because it's a duplicate
 func (e *Entry) parseRR(a dns.RR, opts *cli.Flags) *RR {
 	// Initialize existingRRs map if it doesn't exist
@@ -74,14 +87,7 @@ func (e *Entry) parseRR(a dns.RR, opts *cli.Flags) *RR {
 	}
 	e.existingRRs[rrSignature] = true
 
-	ttl := fmt.Sprintf("%d", a.Header().Ttl)
-	if opts.PrettyTTLs {
-		ttl = (time.Duration(a.Header().Ttl) * time.Second).String()
-		if opts.ShortTTLs {
-			ttl = strings.ReplaceAll(ttl, "m0s", "m")
-			ttl = strings.ReplaceAll(ttl, "h0m", "h")
-		}
-	}
+	ttl := formatTTL(a.Header().Ttl, opts)
 
 	// Copy val now before modifying it with a suffix
 	valCopy := val
@@ -106,6 +112,11 @@ func (e *Entry) parseRR(a dns.RR, opts *cli.Flags) *RR {
 		val += util.Color(util.ColorTeal, fmt.Sprintf(" (%s)", e.Server))
 	}
 
+	// mDNS responder suffix
+	if responders := e.responders(a); len(responders) > 0 {
+		val += util.Color(util.ColorTeal, fmt.Sprintf(" (from %s)", strings.Join(responders, ", ")))
+	}
+
 	return &RR{
 		util.Color(util.ColorPurple, a.Header().Name),
 		util.Color(util.ColorGreen, ttl),
@@ -241,8 +252,26 @@ func flags(m *dns.Msg) string {
 	return strings.TrimSuffix(out, " ")
 }
 
+// printSearch prints the names tried in stub mode and the response to each
+func (p Printer) printSearch(search []SearchAttempt) {
+	util.MustWriteln(p.Out, util.Color(util.ColorWhite, "Search:"))
+	for _, s := range search {
+		line := util.Color(util.ColorPurple, s.Name) + " " + util.Color(util.ColorTeal, s.Rcode)
+		if s.Server != "" {
+			line += " from " + util.Color(util.ColorGreen, s.Server)
+		}
+		if s.Answered {
+			line += " " + util.Color(util.ColorMagenta, "(answered)")
+		}
+		util.MustWriteln(p.Out, line)
+	}
+}
+
 func (p Printer) PrintPretty(entries []*Entry) {
 	for _, entry := range entries {
+		if len(entry.Search) > 0 && !p.Opts.ValueOnly {
+			p.printSearch(entry.Search)
+		}
 		for i, reply := range entry.Replies {
 			if p.Opts.ShowQuestion {
 				util.MustWriteln(p.Out, util.Color(util.ColorWhite, "Question:"))
@@ -254,7 +283,7 @@ func (p Printer) PrintPretty(entries []*Entry) {
 				}
 			}
 			if p.Opts.ShowAnswer && len(reply.Answer) > 0 {
-				if p.Opts.ShowQuestion || p.Opts.ShowAuthority || p.Opts.ShowAdditional {
+				if p.Opts.ShowQuestion || p.Opts.ShowAuthority || p.Opts.ShowAdditional || (len(entry.Search) > 0 && !p.Opts.ValueOnly) {
 					util.MustWriteln(p.Out, util.Color(util.ColorWhite, "Answer:"))
 				}
 				p.printSection(toRRs(reply.Answer, entry, &p))
@@ -295,7 +324,7 @@ func (p Printer) PrintPretty(entries []*Entry) {
 					util.Color(util.ColorPurple, fmt.Sprintf("%d B", reply.Len())),
 					util.Color(util.ColorGreen, entry.Server),
 					util.Color(util.ColorTeal, entry.Time.Round(100*time.Microsecond)),
-					util.Color(util.ColorMagenta, time.Now().Format("15:04:05 01-02-2006 MST")),
+					util.Color(util.ColorMagenta, entry.timestamp().Format("15:04:05 01-02-2006 MST")),
 				)
 
 				util.MustWritef(p.Out, "Opcode: %s Status: %s ID %s: Flags: %s (%s Q %s A %s N %s E)\n",
@@ -308,6 +337,23 @@ func (p Printer) PrintPretty(entries []*Entry) {
 					util.Color(util.ColorTeal, fmt.Sprintf("%d", len(reply.Ns))),
 					util.Color(util.ColorMagenta, fmt.Sprintf("%d", len(reply.Extra))),
 				)
+
+				if entry.ConnState != nil && entry.ConnState.Family() != "" {
+					util.MustWritef(p.Out, "Connected to %s over %s\n",
+						util.Color(util.ColorGreen, entry.ConnState.Peer()),
+						util.Color(util.ColorTeal, entry.ConnState.Family()),
+					)
+				}
+				if ech := echStatus(entry.ConnState); ech != "" {
+					color := util.ColorGreen
+					if !entry.ConnState.ECHAccepted {
+						color = util.ColorRed
+					}
+					util.MustWritef(p.Out, "ECH: %s\n", util.Color(color, ech))
+				}
+				if handshakes := handshakeStats(entry.ConnState); handshakes != "" {
+					util.MustWritef(p.Out, "TLS handshakes: %s\n", util.Color(util.ColorTeal, handshakes))
+				}
 			}
 		}
 	}
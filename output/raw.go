@@ -2,6 +2,7 @@ package output
 
 import (
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/miekg/dns"
@@ -56,8 +57,20 @@ func (p Printer) PrintRaw(entries []*Entry) {
 
 			if p.Opts.ShowStats {
 				util.MustWritef(p.Out, ";; Received %d B\n", reply.Len())
-				util.MustWritef(p.Out, ";; Time %s\n", time.Now().Format("15:04:05 01-02-2006 MST"))
+				util.MustWritef(p.Out, ";; Time %s\n", entry.timestamp().Format("15:04:05 01-02-2006 MST"))
 				util.MustWritef(p.Out, ";; From %s in %s\n", entry.Server, entry.Time.Round(100*time.Microsecond))
+				if responders := entry.responderAddrs(); len(responders) > 0 {
+					util.MustWritef(p.Out, ";; Responders %s\n", strings.Join(responders, ", "))
+				}
+				if entry.ConnState != nil && entry.ConnState.Family() != "" {
+					util.MustWritef(p.Out, ";; Connected to %s over %s\n", entry.ConnState.Peer(), entry.ConnState.Family())
+				}
+				if ech := echStatus(entry.ConnState); ech != "" {
+					util.MustWritef(p.Out, ";; ECH %s\n", ech)
+				}
+				if handshakes := handshakeStats(entry.ConnState); handshakes != "" {
+					util.MustWritef(p.Out, ";; TLS handshakes: %s\n", handshakes)
+				}
 			}
 
 			// Print separator if there is more than one query
@@ -0,0 +1,226 @@
+package output
+
+import (
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/miekg/dns"
+)
+
+// rfc8427Message is the RFC 8427 representation of a DNS message
+// https://www.rfc-editor.org/rfc/rfc8427
+type rfc8427Message struct {
+	Comment     string  `json:"comment,omitempty" yaml:"comment,omitempty"`
+	DateString  string  `json:"dateString,omitempty" yaml:"dateString,omitempty"`
+	DateSeconds float64 `json:"dateSeconds,omitempty" yaml:"dateSeconds,omitempty"`
+
+	ID      uint16 `json:"ID" yaml:"ID"`
+	QR      bool   `json:"QR" yaml:"QR"`
+	Opcode  int    `json:"Opcode" yaml:"Opcode"`
+	AA      bool   `json:"AA" yaml:"AA"`
+	TC      bool   `json:"TC" yaml:"TC"`
+	RD      bool   `json:"RD" yaml:"RD"`
+	RA      bool   `json:"RA" yaml:"RA"`
+	AD      bool   `json:"AD" yaml:"AD"`
+	CD      bool   `json:"CD" yaml:"CD"`
+	RCODE   int    `json:"RCODE" yaml:"RCODE"`
+	QDCOUNT int    `json:"QDCOUNT" yaml:"QDCOUNT"`
+	ANCOUNT int    `json:"ANCOUNT" yaml:"ANCOUNT"`
+	NSCOUNT int    `json:"NSCOUNT" yaml:"NSCOUNT"`
+	ARCOUNT int    `json:"ARCOUNT" yaml:"ARCOUNT"`
+
+	QNAME      string `json:"QNAME,omitempty" yaml:"QNAME,omitempty"`
+	QTYPE      uint16 `json:"QTYPE,omitempty" yaml:"QTYPE,omitempty"`
+	QTYPEname  string `json:"QTYPEname,omitempty" yaml:"QTYPEname,omitempty"`
+	QCLASS     uint16 `json:"QCLASS,omitempty" yaml:"QCLASS,omitempty"`
+	QCLASSname string `json:"QCLASSname,omitempty" yaml:"QCLASSname,omitempty"`
+
+	QuestionRRs   []map[string]any `json:"questionRRs,omitempty" yaml:"questionRRs,omitempty"`
+	AnswerRRs     []map[string]any `json:"answerRRs,omitempty" yaml:"answerRRs,omitempty"`
+	AuthorityRRs  []map[string]any `json:"authorityRRs,omitempty" yaml:"authorityRRs,omitempty"`
+	AdditionalRRs []map[string]any `json:"additionalRRs,omitempty" yaml:"additionalRRs,omitempty"`
+
+	MessageOctetsHEX string `json:"messageOctetsHEX,omitempty" yaml:"messageOctetsHEX,omitempty"`
+}
+
+// toRFC8427 converts a message to its RFC 8427 representation
+func toRFC8427(m *dns.Msg, comment string, t time.Time) *rfc8427Message {
+	out := &rfc8427Message{
+		Comment:     comment,
+		DateString:  t.UTC().Format(time.RFC3339Nano),
+		DateSeconds: float64(t.UnixNano()) / 1e9,
+		ID:          m.Id,
+		QR:          m.Response,
+		Opcode:      m.Opcode,
+		AA:          m.Authoritative,
+		TC:          m.Truncated,
+		RD:          m.RecursionDesired,
+		RA:          m.RecursionAvailable,
+		AD:          m.AuthenticatedData,
+		CD:          m.CheckingDisabled,
+		RCODE:       m.Rcode & 0xF, // the rest of an extended rcode is in the OPT RR
+		QDCOUNT:     len(m.Question),
+		ANCOUNT:     len(m.Answer),
+		NSCOUNT:     len(m.Ns),
+		ARCOUNT:     len(m.Extra),
+	}
+
+	if len(m.Question) == 1 {
+		q := m.Question[0]
+		out.QNAME = q.Name
+		out.QTYPE = q.Qtype
+		out.QTYPEname = dns.Type(q.Qtype).String()
+		out.QCLASS = q.Qclass
+		out.QCLASSname = dns.Class(q.Qclass).String()
+	} else {
+		for _, q := range m.Question {
+			out.QuestionRRs = append(out.QuestionRRs, map[string]any{
+				"NAME":      q.Name,
+				"TYPE":      q.Qtype,
+				"TYPEname":  dns.Type(q.Qtype).String(),
+				"CLASS":     q.Qclass,
+				"CLASSname": dns.Class(q.Qclass).String(),
+			})
+		}
+	}
+
+	for _, rr := range m.Answer {
+		out.AnswerRRs = append(out.AnswerRRs, rfc8427RR(rr))
+	}
+	for _, rr := range m.Ns {
+		out.AuthorityRRs = append(out.AuthorityRRs, rfc8427RR(rr))
+	}
+	for _, rr := range m.Extra {
+		out.AdditionalRRs = append(out.AdditionalRRs, rfc8427RR(rr))
+	}
+
+	if b, err := m.Pack(); err == nil {
+		out.MessageOctetsHEX = strings.ToUpper(hex.EncodeToString(b))
+	} else {
+		log.Warnf("error packing message: %s", err)
+	}
+
+	return out
+}
+
+// rfc8427RR converts an RR to an RFC 8427 RR object with typed rdata
+func rfc8427RR(rr dns.RR) map[string]any {
+	h := rr.Header()
+	typeName := dns.Type(h.Rrtype).String()
+	out := map[string]any{
+		"NAME":      h.Name,
+		"TYPE":      h.Rrtype,
+		"TYPEname":  typeName,
+		"CLASS":     h.Class,
+		"CLASSname": dns.Class(h.Class).String(),
+		"TTL":       h.Ttl,
+	}
+
+	// Pack the RR alone to get its uncompressed RDATA
+	buf := make([]byte, dns.Len(rr)+1)
+	end, err := dns.PackRR(rr, buf, 0, nil, false)
+	if err != nil {
+		log.Warnf("error packing %s record: %s", typeName, err)
+		return out
+	}
+	nameBuf := make([]byte, 256)
+	nameLen, err := dns.PackDomainName(h.Name, nameBuf, 0, nil, false)
+	if err == nil && nameLen+10 <= end {
+		rdata := buf[nameLen+10 : end]
+		out["RDLENGTH"] = len(rdata)
+		out["RDATAHEX"] = strings.ToUpper(hex.EncodeToString(rdata))
+	}
+
+	if rdata := rfc8427Rdata(rr); rdata != nil {
+		out["rdata"+typeName] = rdata
+	}
+	return out
+}
+
+// rfc8427Rdata returns the typed rdata of an RR, falling back to its presentation format
+func rfc8427Rdata(rr dns.RR) any {
+	switch r := rr.(type) {
+	case *dns.A:
+		return r.A.String()
+	case *dns.AAAA:
+		return r.AAAA.String()
+	case *dns.CNAME:
+		return r.Target
+	case *dns.DNAME:
+		return r.Target
+	case *dns.NS:
+		return r.Ns
+	case *dns.PTR:
+		return r.Ptr
+	case *dns.MX:
+		return map[string]any{"preference": r.Preference, "exchange": r.Mx}
+	case *dns.SOA:
+		return map[string]any{
+			"mname":   r.Ns,
+			"rname":   r.Mbox,
+			"serial":  r.Serial,
+			"refresh": r.Refresh,
+			"retry":   r.Retry,
+			"expire":  r.Expire,
+			"minimum": r.Minttl,
+		}
+	case *dns.SRV:
+		return map[string]any{"priority": r.Priority, "weight": r.Weight, "port": r.Port, "target": r.Target}
+	case *dns.CAA:
+		return map[string]any{"flags": r.Flag, "tag": r.Tag, "value": r.Value}
+	case *dns.DS:
+		return map[string]any{"keyTag": r.KeyTag, "algorithm": r.Algorithm, "digestType": r.DigestType, "digest": r.Digest}
+	case *dns.DNSKEY:
+		return map[string]any{"flags": r.Flags, "protocol": r.Protocol, "algorithm": r.Algorithm, "publicKey": r.PublicKey}
+	case *dns.RRSIG:
+		return map[string]any{
+			"typeCovered": dns.Type(r.TypeCovered).String(),
+			"algorithm":   r.Algorithm,
+			"labels":      r.Labels,
+			"originalTTL": r.OrigTtl,
+			"expiration":  dns.TimeToString(r.Expiration),
+			"inception":   dns.TimeToString(r.Inception),
+			"keyTag":      r.KeyTag,
+			"signerName":  r.SignerName,
+			"signature":   r.Signature,
+		}
+	case *dns.TLSA:
+		return map[string]any{"usage": r.Usage, "selector": r.Selector, "matchingType": r.MatchingType, "certificate": r.Certificate}
+	case *dns.SVCB:
+		return svcbRdata(r)
+	case *dns.HTTPS:
+		return svcbRdata(&r.SVCB)
+	case *dns.OPT:
+		return nil // the OPT pseudo-RR has no presentation format
+	}
+	return rdata(rr)
+}
+
+// svcbRdata returns the typed rdata of an SVCB or HTTPS RR
+func svcbRdata(r *dns.SVCB) map[string]any {
+	params := make(map[string]string, len(r.Value))
+	for _, kv := range r.Value {
+		params[kv.Key().String()] = kv.String()
+	}
+	return map[string]any{"priority": r.Priority, "target": r.Target, "params": params}
+}
+
+// rfc8427Messages converts the queries and replies of entries to RFC 8427 messages
+func rfc8427Messages(entries []*Entry) []*rfc8427Message {
+	out := []*rfc8427Message{}
+	for _, entry := range entries {
+		for i, reply := range entry.Replies {
+			if i < len(entry.Queries) {
+				out = append(out, toRFC8427(&entry.Queries[i], "Query to "+entry.Server, entry.timestamp()))
+			}
+			comment := entry.Server
+			if reply.Response {
+				comment = "Response from " + entry.Server
+			}
+			out = append(out, toRFC8427(reply, comment, entry.timestamp()))
+		}
+	}
+	return out
+}
@@ -0,0 +1,70 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/natesales/q/cli"
+)
+
+func TestOutputPrintRFC8427(t *testing.T) {
+	query := new(dns.Msg).SetQuestion("example.com.", dns.TypeMX)
+	query.Id = 1
+	query.SetEdns0(1232, true)
+	reply := new(dns.Msg).SetRcode(query, dns.RcodeSuccess)
+	for _, s := range []string{
+		"example.com. 300 IN MX 10 mail.example.com.",
+		"example.com. 300 IN TXT \"v=spf1\" \"-all\"",
+	} {
+		rr, err := dns.NewRR(s)
+		assert.Nil(t, err)
+		reply.Answer = append(reply.Answer, rr)
+	}
+	soa, err := dns.NewRR("example.com. 60 IN SOA ns.example.com. admin.example.com. 1 2 3 4 5")
+	assert.Nil(t, err)
+	reply.Ns = []dns.RR{soa}
+	reply.SetEdns0(4096, false)
+
+	var buf bytes.Buffer
+	p := Printer{Out: &buf, Opts: &cli.Flags{Format: "json", RFC8427: true}}
+	p.PrintStructured([]*Entry{{Queries: []dns.Msg{*query}, Replies: []*dns.Msg{reply}, Server: "192.0.2.53:53"}})
+
+	var msgs []map[string]any
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &msgs))
+	assert.Len(t, msgs, 2)
+
+	assert.Equal(t, "Query to 192.0.2.53:53", msgs[0]["comment"])
+	assert.Equal(t, false, msgs[0]["QR"])
+	assert.Equal(t, true, msgs[0]["RD"])
+	assert.Equal(t, "example.com.", msgs[0]["QNAME"])
+	assert.Equal(t, "MX", msgs[0]["QTYPEname"])
+	assert.Equal(t, float64(15), msgs[0]["QTYPE"])
+	assert.Equal(t, float64(1), msgs[0]["ARCOUNT"])
+
+	assert.Equal(t, "Response from 192.0.2.53:53", msgs[1]["comment"])
+	assert.Equal(t, true, msgs[1]["QR"])
+	answers := msgs[1]["answerRRs"].([]any)
+	assert.Equal(t, map[string]any{
+		"NAME":      "example.com.",
+		"TYPE":      float64(15),
+		"TYPEname":  "MX",
+		"CLASS":     float64(1),
+		"CLASSname": "IN",
+		"TTL":       float64(300),
+		"RDLENGTH":  float64(20),
+		"RDATAHEX":  "000A046D61696C076578616D706C6503636F6D00",
+		"rdataMX":   map[string]any{"preference": float64(10), "exchange": "mail.example.com."},
+	}, answers[0])
+	assert.Equal(t, `"v=spf1" "-all"`, answers[1].(map[string]any)["rdataTXT"])
+	soaRdata := msgs[1]["authorityRRs"].([]any)[0].(map[string]any)["rdataSOA"].(map[string]any)
+	assert.Equal(t, "admin.example.com.", soaRdata["rname"])
+	assert.Equal(t, float64(5), soaRdata["minimum"])
+	opt := msgs[1]["additionalRRs"].([]any)[0].(map[string]any)
+	assert.Equal(t, "OPT", opt["TYPEname"])
+	assert.NotContains(t, opt, "rdataOPT")
+	assert.NotEmpty(t, msgs[1]["messageOctetsHEX"])
+}
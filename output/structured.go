@@ -2,6 +2,7 @@ package output
 
 import (
 	"strings"
+	"sync"
 
 	"github.com/charmbracelet/log"
 	jsoniter "github.com/json-iterator/go"
@@ -11,17 +12,30 @@ import (
 	"github.com/natesales/q/util"
 )
 
+var namingStrategyOnce sync.Once
+
+// marshalJSON marshals v to JSON with lower case field names
+func marshalJSON(v any) ([]byte, error) {
+	namingStrategyOnce.Do(func() {
+		extra.SetNamingStrategy(strings.ToLower)
+	})
+	return jsoniter.ConfigCompatibleWithStandardLibrary.Marshal(v)
+}
+
 func (p Printer) PrintStructured(entries []*Entry) {
 	var marshaler func(any) ([]byte, error)
 	if p.Opts.Format == "json" {
-		extra.SetNamingStrategy(strings.ToLower)
-		json := jsoniter.ConfigCompatibleWithStandardLibrary
-		marshaler = json.Marshal
+		marshaler = marshalJSON
 	} else { // yaml
 		marshaler = yaml.Marshal
 	}
 
-	b, err := marshaler(entries)
+	var v any = entries
+	if p.Opts.RFC8427 {
+		v = rfc8427Messages(entries)
+	}
+
+	b, err := marshaler(v)
 	if err != nil {
 		log.Fatalf("error marshaling output: %s", err)
 	}
@@ -0,0 +1,89 @@
+package output
+
+import (
+	"encoding/csv"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/miekg/dns"
+
+	"github.com/natesales/q/util"
+)
+
+// tabularHeader is the header row of CSV and TSV output
+var tabularHeader = []string{"server", "qname", "qtype", "rcode", "owner", "ttl", "class", "type", "rdata"}
+
+// tabularRdata returns the rdata of an RR as a field, with TXT strings unquoted and joined since the writer quotes the
+// field itself
+func tabularRdata(rr dns.RR) string {
+	var txt []string
+	switch rr := rr.(type) {
+	case *dns.TXT:
+		txt = rr.Txt
+	case *dns.SPF:
+		txt = rr.Txt
+	default:
+		return rdata(rr)
+	}
+	var b strings.Builder
+	for _, s := range txt {
+		b.Write(util.Unescape(s))
+	}
+	return b.String()
+}
+
+// PrintTabular prints one CSV or TSV row per RR in the shown sections, or a row without an RR for empty replies
+func (p Printer) PrintTabular(entries []*Entry) {
+	w := csv.NewWriter(p.Out)
+	if p.Opts.Format == FormatTSV {
+		w.Comma = '\t'
+	}
+
+	_ = w.Write(tabularHeader)
+	for _, entry := range entries {
+		for _, reply := range entry.Replies {
+			var qname, qtype string
+			if len(reply.Question) > 0 {
+				qname = reply.Question[0].Name
+				qtype = dns.Type(reply.Question[0].Qtype).String()
+			}
+			prefix := []string{entry.Server, qname, qtype, dns.RcodeToString[reply.Rcode]}
+
+			var rrs []dns.RR
+			if p.Opts.ShowAnswer {
+				rrs = append(rrs, reply.Answer...)
+			}
+			if p.Opts.ShowAuthority {
+				rrs = append(rrs, reply.Ns...)
+			}
+			if p.Opts.ShowAdditional {
+				for _, rr := range reply.Extra {
+					if rr.Header().Rrtype != dns.TypeOPT {
+						rrs = append(rrs, rr)
+					}
+				}
+			}
+
+			if len(rrs) == 0 {
+				_ = w.Write(append(prefix, "", "", "", "", ""))
+				continue
+			}
+			for _, rr := range rrs {
+				h := rr.Header()
+				_ = w.Write(append(prefix,
+					h.Name,
+					strconv.Itoa(int(h.Ttl)),
+					dns.Class(h.Class).String(),
+					dns.Type(h.Rrtype).String(),
+					tabularRdata(rr),
+				))
+			}
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		log.Fatalf("error writing output: %s", err)
+	}
+}
@@ -0,0 +1,53 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/natesales/q/cli"
+)
+
+func TestOutputPrintCSV(t *testing.T) {
+	var buf bytes.Buffer
+	p := Printer{Out: &buf, Opts: &cli.Flags{Format: "csv", ShowAnswer: true}}
+	p.PrintTabular(entries)
+	assert.Equal(t, `server,qname,qtype,rcode,owner,ttl,class,type,rdata
+192.0.2.10,,,NOERROR,example.com.,86400,IN,A,192.0.2.1
+192.0.2.10,,,NOERROR,example.com.,86400,IN,A,192.0.2.2
+192.0.2.10,,,NOERROR,example.com.,86400,IN,NS,b.iana-servers.net.
+192.0.2.10,,,NOERROR,example.com.,86400,IN,NS,a.iana-servers.net.
+192.0.2.10,,,NOERROR,example.com.,86400,IN,MX,0 .
+192.0.2.10,,,NOERROR,example.com.,86400,IN,TXT,v=spf1 -all
+`, buf.String())
+
+	// Multiple TXT strings are joined and escapes are decoded before the field is quoted
+	txt, err := dns.NewRR(`example.com. 60 IN TXT "v=DKIM1; k=rsa; " "p=\"abc\"" "\229\165\189"`)
+	assert.Nil(t, err)
+	reply := new(dns.Msg)
+	reply.Answer = []dns.RR{txt}
+	buf.Reset()
+	p.PrintTabular([]*Entry{{Server: "192.0.2.10", Replies: []*dns.Msg{reply}}})
+	assert.Contains(t, buf.String(), `,TXT,"v=DKIM1; k=rsa; p=""abc""好"`+"\n")
+}
+
+func TestOutputPrintTSV(t *testing.T) {
+	query := new(dns.Msg).SetQuestion("missing.example.com.", dns.TypeTXT)
+	reply := new(dns.Msg).SetRcode(query, dns.RcodeNameError)
+	soa, err := dns.NewRR("example.com. 60 IN SOA ns.example.com. admin.example.com. 1 2 3 4 5")
+	assert.Nil(t, err)
+	reply.Ns = []dns.RR{soa}
+
+	var buf bytes.Buffer
+	p := Printer{Out: &buf, Opts: &cli.Flags{Format: "tsv", ShowAnswer: true}}
+	p.PrintTabular([]*Entry{{Server: "192.0.2.53:53", Replies: []*dns.Msg{reply}}})
+	assert.Equal(t, "server\tqname\tqtype\trcode\towner\tttl\tclass\ttype\trdata\n"+
+		"192.0.2.53:53\tmissing.example.com.\tTXT\tNXDOMAIN\t\t\t\t\t\n", buf.String())
+
+	buf.Reset()
+	p.Opts.ShowAuthority = true
+	p.PrintTabular([]*Entry{{Server: "192.0.2.53:53", Replies: []*dns.Msg{reply}}})
+	assert.Contains(t, buf.String(), "\tNXDOMAIN\texample.com.\t60\tIN\tSOA\tns.example.com. admin.example.com. 1 2 3 4 5\n")
+}
@@ -0,0 +1,60 @@
+package output
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/miekg/dns"
+
+	"github.com/natesales/q/util"
+)
+
+// templateFuncs returns the helper functions available to --template
+func (p Printer) templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"typeName":  func(t uint16) string { return dns.Type(t).String() },
+		"className": func(c uint16) string { return dns.Class(c).String() },
+		"rcodeName": func(rcode int) string { return dns.RcodeToString[rcode] },
+		"ttl":       func(ttl uint32) string { return formatTTL(ttl, p.Opts) },
+		"rdata":     rdata,
+		"trimDot":   func(s string) string { return strings.TrimSuffix(s, ".") },
+		"join":      strings.Join,
+		"color":     func(color string, a ...any) string { return util.Color(color, a...) },
+	}
+}
+
+// templateText returns the contents of the --template file, or the flag value itself if it isn't a file
+func templateText(s string) (string, error) {
+	if info, err := os.Stat(s); err == nil && !info.IsDir() {
+		b, err := os.ReadFile(s)
+		if err != nil {
+			return "", fmt.Errorf("reading template file %s: %s", s, err)
+		}
+		return string(b), nil
+	}
+	return s, nil
+}
+
+// PrintTemplate executes the --template for each entry
+func (p Printer) PrintTemplate(entries []*Entry) error {
+	text, err := templateText(p.Opts.Template)
+	if err != nil {
+		return err
+	}
+	if text == "" {
+		return fmt.Errorf("--template is required for the template format")
+	}
+	tmpl, err := template.New("output").Funcs(p.templateFuncs()).Parse(text)
+	if err != nil {
+		return fmt.Errorf("parsing template: %s", err)
+	}
+
+	for _, entry := range entries {
+		if err := tmpl.Execute(p.Out, entry); err != nil {
+			return fmt.Errorf("executing template: %s", err)
+		}
+	}
+	return nil
+}
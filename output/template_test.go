@@ -0,0 +1,48 @@
+package output
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/natesales/q/cli"
+)
+
+func TestOutputPrintTemplate(t *testing.T) {
+	disableColor(t)
+	var buf bytes.Buffer
+	p := Printer{Out: &buf, Opts: &cli.Flags{
+		Format:     "template",
+		PrettyTTLs: true,
+		ShortTTLs:  true,
+		Template: `{{range .Replies}}{{range .Answer}}{{if eq (typeName .Header.Rrtype) "A"}}` +
+			`{{rdata .}} {{trimDot .Header.Name}} # {{ttl .Header.Ttl}} {{className .Header.Class}} {{rcodeName 3}} {{color "red" "x"}}` + "\n" +
+			`{{end}}{{end}}{{end}}`,
+	}}
+	assert.Nil(t, p.PrintTemplate(entries))
+	assert.Equal(t, "192.0.2.1 example.com # 24h IN NXDOMAIN x\n192.0.2.2 example.com # 24h IN NXDOMAIN x\n", buf.String())
+}
+
+func TestOutputPrintTemplateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.tmpl")
+	assert.Nil(t, os.WriteFile(path, []byte(`{{.Server}} {{len .Replies}}`), 0644))
+
+	var buf bytes.Buffer
+	p := Printer{Out: &buf, Opts: &cli.Flags{Format: "template", Template: path}}
+	assert.Nil(t, p.PrintTemplate(entries))
+	assert.Equal(t, "192.0.2.10 6", buf.String())
+}
+
+func TestOutputPrintTemplateErrors(t *testing.T) {
+	p := Printer{Out: &bytes.Buffer{}, Opts: &cli.Flags{Format: "template"}}
+	assert.ErrorContains(t, p.PrintTemplate(entries), "--template is required")
+
+	p.Opts.Template = "{{.Server"
+	assert.ErrorContains(t, p.PrintTemplate(entries), "parsing template")
+
+	p.Opts.Template = "{{.Missing}}"
+	assert.ErrorContains(t, p.PrintTemplate(entries), "executing template")
+}
@@ -0,0 +1,283 @@
+package output
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/miekg/dns"
+
+	"github.com/natesales/q/transport"
+	"github.com/natesales/q/util"
+)
+
+// wireBytesPerLine is the number of bytes on each line of a wire dump
+const wireBytesPerLine = 8
+
+// wireField is a span of a packed message and what it encodes, or a heading if length is 0
+type wireField struct {
+	offset, length int
+	note           string
+}
+
+// wireDump annotates the fields of a packed message
+type wireDump struct {
+	b      []byte
+	fields []wireField
+	err    error
+}
+
+// heading adds a section heading
+func (d *wireDump) heading(format string, a ...any) {
+	d.fields = append(d.fields, wireField{note: fmt.Sprintf(format, a...)})
+}
+
+// add annotates n bytes at off and returns the offset after them
+func (d *wireDump) add(off, n int, format string, a ...any) int {
+	if d.err != nil {
+		return off
+	}
+	if off+n > len(d.b) {
+		d.err = fmt.Errorf("message truncated at offset %d", off)
+		return len(d.b)
+	}
+	d.fields = append(d.fields, wireField{off, n, fmt.Sprintf(format, a...)})
+	return off + n
+}
+
+// uint16 returns the 16 bit value at off, or 0 if the message is too short
+func (d *wireDump) uint16(off int) uint16 {
+	if off+2 > len(d.b) {
+		return 0
+	}
+	return binary.BigEndian.Uint16(d.b[off:])
+}
+
+// uint32 returns the 32 bit value at off, or 0 if the message is too short
+func (d *wireDump) uint32(off int) uint32 {
+	if off+4 > len(d.b) {
+		return 0
+	}
+	return binary.BigEndian.Uint32(d.b[off:])
+}
+
+// name annotates the labels and compression pointer of a domain name at off and returns the offset after it
+func (d *wireDump) name(off int) int {
+	for d.err == nil {
+		if off >= len(d.b) {
+			d.err = fmt.Errorf("message truncated at offset %d", off)
+			return off
+		}
+		length := int(d.b[off])
+		switch {
+		case length == 0:
+			return d.add(off, 1, "root")
+		case length&0xC0 == 0xC0:
+			target := int(d.uint16(off) & 0x3FFF)
+			targetName, _, err := dns.UnpackDomainName(d.b, target)
+			if err != nil {
+				targetName = "invalid: " + err.Error()
+			}
+			return d.add(off, 2, "pointer to 0x%04x (%s)", target, targetName)
+		case length&0xC0 != 0:
+			d.err = fmt.Errorf("unsupported label type 0x%02x at offset %d", length, off)
+			return off
+		}
+		if off+1+length > len(d.b) {
+			d.err = fmt.Errorf("message truncated at offset %d", off)
+			return len(d.b)
+		}
+		off = d.add(off, 1+length, "label %q", d.b[off+1:off+1+length])
+	}
+	return off
+}
+
+// rr annotates a resource record at off and returns the offset after it
+func (d *wireDump) rr(off int, rr dns.RR) int {
+	off = d.name(off)
+	rrType := d.uint16(off)
+	off = d.add(off, 2, "TYPE %s", dns.Type(rrType))
+	if rrType == dns.TypeOPT {
+		off = d.add(off, 2, "UDP payload size %d", d.uint16(off))
+		ttl := d.uint32(off)
+		ednsFlags := "none"
+		if ttl&0x8000 != 0 {
+			ednsFlags = "do"
+		}
+		off = d.add(off, 4, "extended rcode %d, version %d, flags %s", ttl>>24, ttl>>16&0xFF, ednsFlags)
+	} else {
+		off = d.add(off, 2, "CLASS %s", dns.Class(d.uint16(off)))
+		off = d.add(off, 4, "TTL %d", d.uint32(off))
+	}
+	rdLength := int(d.uint16(off))
+	off = d.add(off, 2, "RDLENGTH %d", rdLength)
+	if d.err != nil || rdLength == 0 {
+		return off
+	}
+
+	end := off + rdLength
+	switch rrType {
+	case dns.TypeNS, dns.TypeCNAME, dns.TypePTR, dns.TypeDNAME:
+		d.name(off)
+	case dns.TypeMX:
+		d.name(d.add(off, 2, "preference %d", d.uint16(off)))
+	case dns.TypeSRV:
+		off = d.add(off, 2, "priority %d", d.uint16(off))
+		off = d.add(off, 2, "weight %d", d.uint16(off))
+		off = d.add(off, 2, "port %d", d.uint16(off))
+		d.name(off)
+	case dns.TypeSOA:
+		off = d.name(d.name(off))
+		for _, field := range []string{"serial", "refresh", "retry", "expire", "minimum"} {
+			off = d.add(off, 4, "%s %d", field, d.uint32(off))
+		}
+	case dns.TypeOPT:
+		for off < end && d.err == nil {
+			code, length := d.uint16(off), int(d.uint16(off+2))
+			off = d.add(off, 2, "option %s", ednsOptionName(code))
+			off = d.add(off, 2, "option length %d", length)
+			if length > 0 {
+				off = d.add(off, length, "option data")
+			}
+		}
+	default:
+		note := "RDATA"
+		if rr != nil {
+			note += " " + rdata(rr)
+		}
+		d.add(off, rdLength, "%s", note)
+	}
+	return end
+}
+
+// ednsOptionName returns the name of an EDNS0 option code
+func ednsOptionName(code uint16) string {
+	names := map[uint16]string{
+		dns.EDNS0NSID:         "NSID",
+		dns.EDNS0SUBNET:       "CLIENT-SUBNET",
+		dns.EDNS0EXPIRE:       "EXPIRE",
+		dns.EDNS0COOKIE:       "COOKIE",
+		dns.EDNS0TCPKEEPALIVE: "TCP-KEEPALIVE",
+		dns.EDNS0PADDING:      "PADDING",
+		dns.EDNS0EDE:          "EDE",
+	}
+	if name, ok := names[code]; ok {
+		return name
+	}
+	return fmt.Sprintf("%d", code)
+}
+
+// dumpWire annotates every field of a packed message
+func dumpWire(b []byte, msg *dns.Msg) *wireDump {
+	d := &wireDump{b: b}
+
+	d.heading("HEADER")
+	d.add(0, 2, "ID %d", d.uint16(0))
+	headerFlags := flags(msg)
+	if headerFlags == "" {
+		headerFlags = "none"
+	}
+	d.add(2, 2, "opcode %s, rcode %s, flags %s", dns.OpcodeToString[msg.Opcode], dns.RcodeToString[msg.Rcode&0xF], headerFlags)
+	counts := make([]int, 4)
+	for i, name := range []string{"QDCOUNT", "ANCOUNT", "NSCOUNT", "ARCOUNT"} {
+		counts[i] = int(d.uint16(4 + 2*i))
+		d.add(4+2*i, 2, "%s %d", name, counts[i])
+	}
+
+	off := 12
+	for i := 0; i < counts[0] && d.err == nil; i++ {
+		d.heading("QUESTION %d", i+1)
+		off = d.name(off)
+		off = d.add(off, 2, "QTYPE %s", dns.Type(d.uint16(off)))
+		off = d.add(off, 2, "QCLASS %s", dns.Class(d.uint16(off)))
+	}
+
+	for s, section := range [][]dns.RR{msg.Answer, msg.Ns, msg.Extra} {
+		for i := 0; i < counts[s+1] && d.err == nil; i++ {
+			var rr dns.RR
+			if i < len(section) {
+				rr = section[i]
+			}
+			d.heading("%s %d", []string{"ANSWER", "AUTHORITY", "ADDITIONAL"}[s], i+1)
+			off = d.rr(off, rr)
+		}
+	}
+
+	if d.err == nil && off < len(b) {
+		d.add(off, len(b)-off, "trailing data")
+	}
+	return d
+}
+
+// printWireMsg prints a message as an annotated hex dump of the bytes sent or received, or of its packed form if
+// the transport didn't record them
+func (p Printer) printWireMsg(msg *dns.Msg, b []byte) {
+	if b == nil {
+		// Pack a copy with name compression like servers send
+		packed := msg.Copy()
+		packed.Compress = true
+		var err error
+		b, err = packed.Pack()
+		if err != nil {
+			log.Warnf("error packing message: %s", err)
+			return
+		}
+	} else if unpacked := new(dns.Msg); unpacked.Unpack(b) == nil {
+		// Annotate the fields as received, since the transport may have changed the message after sending it
+		msg = unpacked
+	}
+
+	title := "Query"
+	if msg.Response {
+		title = "Response"
+	}
+	util.MustWriteln(p.Out, util.Color(util.ColorWhite, fmt.Sprintf(";; %s (%d bytes)", title, len(b))))
+
+	d := dumpWire(b, msg)
+	for _, f := range d.fields {
+		if f.length == 0 {
+			util.MustWriteln(p.Out, util.Color(util.ColorWhite, ";; "+f.note))
+			continue
+		}
+		for i := 0; i < f.length; i += wireBytesPerLine {
+			var hexBytes []string
+			for _, c := range b[f.offset+i : f.offset+min(f.length, i+wireBytesPerLine)] {
+				hexBytes = append(hexBytes, fmt.Sprintf("%02x", c))
+			}
+			line := fmt.Sprintf("%s  %-*s", util.Color(util.ColorTeal, fmt.Sprintf("%04x", f.offset+i)), wireBytesPerLine*3-1, strings.Join(hexBytes, " "))
+			if i == 0 {
+				line += "  " + util.Color(util.ColorGreen, f.note)
+			}
+			util.MustWriteln(p.Out, strings.TrimRight(line, " "))
+		}
+	}
+	if d.err != nil {
+		util.MustWriteln(p.Out, util.Color(util.ColorRed, ";; "+d.err.Error()))
+	}
+}
+
+// PrintWire prints each query and reply as an annotated hex dump
+func (p Printer) PrintWire(entries []*Entry) {
+	first := true
+	for _, entry := range entries {
+		for i, reply := range entry.Replies {
+			var wire transport.Wire
+			if i < len(entry.Wire) {
+				wire = entry.Wire[i]
+			}
+			if i < len(entry.Queries) {
+				if !first {
+					util.MustWriteln(p.Out, "")
+				}
+				p.printWireMsg(&entry.Queries[i], wire.Query)
+				first = false
+			}
+			if !first {
+				util.MustWriteln(p.Out, "")
+			}
+			p.printWireMsg(reply, wire.Reply)
+			first = false
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/natesales/q/cli"
+	"github.com/natesales/q/transport"
+)
+
+func TestOutputPrintWire(t *testing.T) {
+	query := new(dns.Msg).SetQuestion("example.com.", dns.TypeMX)
+	query.Id = 1
+	reply := new(dns.Msg).SetReply(query)
+	mx, err := dns.NewRR("example.com. 300 IN MX 10 mail.example.com.")
+	assert.Nil(t, err)
+	a, err := dns.NewRR("mail.example.com. 60 IN A 192.0.2.25")
+	assert.Nil(t, err)
+	reply.Answer = []dns.RR{mx}
+	reply.Extra = []dns.RR{a}
+
+	var buf bytes.Buffer
+	disableColor(t)
+	p := Printer{Out: &buf, Opts: &cli.Flags{Format: "wire"}}
+	p.PrintWire([]*Entry{{Queries: []dns.Msg{*query}, Replies: []*dns.Msg{reply}}})
+
+	assert.Contains(t, buf.String(), ";; Query (29 bytes)\n;; HEADER\n0000  00 01                    ID 1\n0002  01 00                    opcode QUERY, rcode NOERROR, flags rd\n")
+	assert.Contains(t, buf.String(), "\n\n;; Response (")
+	assert.Contains(t, buf.String(), `;; ANSWER 1
+001d  c0 0c                    pointer to 0x000c (example.com.)
+001f  00 0f                    TYPE MX
+0021  00 01                    CLASS IN
+0023  00 00 01 2c              TTL 300
+0027  00 09                    RDLENGTH 9
+0029  00 0a                    preference 10
+002b  04 6d 61 69 6c           label "mail"
+0030  c0 0c                    pointer to 0x000c (example.com.)
+;; ADDITIONAL 1
+0032  c0 2b                    pointer to 0x002b (mail.example.com.)
+0034  00 01                    TYPE A
+0036  00 01                    CLASS IN
+0038  00 00 00 3c              TTL 60
+003c  00 04                    RDLENGTH 4
+003e  c0 00 02 19              RDATA 192.0.2.25
+`)
+}
+
+func TestOutputPrintWireRecorded(t *testing.T) {
+	// Names are dumped as received, without compression and with their original case
+	reply := new(dns.Msg).SetQuestion("Example.COM.", dns.TypeA)
+	reply.Response = true
+	a, err := dns.NewRR("Example.COM. 60 IN A 192.0.2.1")
+	assert.Nil(t, err)
+	reply.Answer = []dns.RR{a}
+	b, err := reply.Pack()
+	assert.Nil(t, err)
+
+	var buf bytes.Buffer
+	disableColor(t)
+	p := Printer{Out: &buf, Opts: &cli.Flags{Format: "wire"}}
+	p.PrintWire([]*Entry{{Replies: []*dns.Msg{reply}, Wire: []transport.Wire{{Reply: b}}}})
+
+	assert.Contains(t, buf.String(), ";; Response (56 bytes)\n")
+	assert.Contains(t, buf.String(), ";; ANSWER 1\n001d  07 45 78 61 6d 70 6c 65  label \"Example\"\n0025  03 43 4f 4d              label \"COM\"\n")
+}
+
+func TestOutputDumpWireTruncated(t *testing.T) {
+	msg := new(dns.Msg).SetQuestion("example.com.", dns.TypeA)
+	b, err := msg.Pack()
+	assert.Nil(t, err)
+
+	d := dumpWire(b[:20], msg)
+	assert.EqualError(t, d.err, "message truncated at offset 20")
+}
@@ -0,0 +1,127 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/miekg/dns"
+)
+
+// canonicalCompare compares two names in DNSSEC canonical order (RFC 4034 section 6.1)
+func canonicalCompare(a, b string) int {
+	aLabels, bLabels := dns.SplitDomainName(strings.ToLower(a)), dns.SplitDomainName(strings.ToLower(b))
+	for i := 1; i <= len(aLabels) && i <= len(bLabels); i++ {
+		if c := strings.Compare(aLabels[len(aLabels)-i], bLabels[len(bLabels)-i]); c != 0 {
+			return c
+		}
+	}
+	return len(aLabels) - len(bLabels)
+}
+
+// relativeName returns name relative to origin, @ for the origin itself, or name if it's outside origin
+func relativeName(name, origin string) string {
+	if origin == "." {
+		return name
+	}
+	if strings.EqualFold(name, origin) {
+		return "@"
+	}
+	if dns.IsSubDomain(origin, name) {
+		return name[:len(name)-len(origin)-1]
+	}
+	return name
+}
+
+// commonTTL returns the most common TTL in a slice of RRs, preferring the lower TTL on ties
+func commonTTL(rrs []dns.RR) uint32 {
+	counts := make(map[uint32]int)
+	var ttl uint32
+	for _, rr := range rrs {
+		t := rr.Header().Ttl
+		counts[t]++
+		if counts[t] > counts[ttl] || (counts[t] == counts[ttl] && t < ttl) {
+			ttl = t
+		}
+	}
+	return ttl
+}
+
+// WriteZone writes RRs as an RFC 1035 master file with names relative to origin, sorted by owner and type with the
+// SOA first. If defaultTTL is set, a $TTL directive is written with the most common TTL, which records then omit.
+func WriteZone(w io.Writer, origin string, rrs []dns.RR, defaultTTL bool) error {
+	origin = dns.Fqdn(origin)
+
+	// Remove duplicates, such as the SOA that ends an AXFR
+	var unique []dns.RR
+	seen := make(map[string]bool)
+	for _, rr := range rrs {
+		if rr.Header().Rrtype == dns.TypeOPT {
+			continue
+		}
+		key := dns.Copy(rr)
+		key.Header().Name = dns.CanonicalName(key.Header().Name)
+		key.Header().Ttl = 0
+		if seen[key.String()] {
+			continue
+		}
+		seen[key.String()] = true
+		unique = append(unique, rr)
+	}
+
+	sort.SliceStable(unique, func(i, j int) bool {
+		a, b := unique[i].Header(), unique[j].Header()
+		if (a.Rrtype == dns.TypeSOA) != (b.Rrtype == dns.TypeSOA) {
+			return a.Rrtype == dns.TypeSOA
+		}
+		if c := canonicalCompare(a.Name, b.Name); c != 0 {
+			return c < 0
+		}
+		return a.Rrtype < b.Rrtype
+	})
+
+	var b strings.Builder
+	b.WriteString("$ORIGIN " + origin + "\n")
+	ttl := commonTTL(unique)
+	if defaultTTL && len(unique) > 0 {
+		b.WriteString(fmt.Sprintf("$TTL %d\n", ttl))
+	}
+	for _, rr := range unique {
+		h := rr.Header()
+		rrTTL := fmt.Sprintf("%d", h.Ttl)
+		if defaultTTL && h.Ttl == ttl {
+			rrTTL = ""
+		}
+		b.WriteString(fmt.Sprintf("%s\t%s\t%s\t%s\t%s\n",
+			relativeName(h.Name, origin),
+			rrTTL,
+			dns.Class(h.Class),
+			dns.Type(h.Rrtype),
+			rdata(rr),
+		))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// PrintZone prints the answer and authority RRs of all entries as a master file with the query name as the origin
+func (p Printer) PrintZone(entries []*Entry) {
+	var rrs []dns.RR
+	origin := p.Opts.Name
+	for _, entry := range entries {
+		for _, reply := range entry.Replies {
+			if origin == "" && len(reply.Question) > 0 {
+				origin = reply.Question[0].Name
+			}
+			rrs = append(rrs, reply.Answer...)
+			rrs = append(rrs, reply.Ns...)
+		}
+	}
+
+	if err := WriteZone(p.Out, origin, rrs, p.Opts.ZoneTTL); err != nil {
+		log.Fatalf("error writing output: %s", err)
+	}
+}
@@ -0,0 +1,77 @@
+package output
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/natesales/q/cli"
+)
+
+func TestOutputWriteZone(t *testing.T) {
+	var rrs []dns.RR
+	for _, s := range []string{
+		"www.example.com. 300 IN A 192.0.2.80",
+		"example.com. 3600 IN SOA ns.example.com. admin.example.com. 1 2 3 4 5",
+		"example.com. 300 IN MX 10 mail.example.com.",
+		"mail.example.com. 300 IN A 192.0.2.25",
+		"example.com. 300 IN A 192.0.2.1",
+		"example.net. 60 IN NS ns.example.net.",
+		"WWW.example.com. 60 IN A 192.0.2.80",
+		"example.com. 3600 IN SOA ns.example.com. admin.example.com. 1 2 3 4 5",
+	} {
+		rr, err := dns.NewRR(s)
+		assert.Nil(t, err)
+		rrs = append(rrs, rr)
+	}
+
+	var buf bytes.Buffer
+	assert.Nil(t, WriteZone(&buf, "example.com", rrs, true))
+	assert.Equal(t, `$ORIGIN example.com.
+$TTL 300
+@	3600	IN	SOA	ns.example.com. admin.example.com. 1 2 3 4 5
+@		IN	A	192.0.2.1
+@		IN	MX	10 mail.example.com.
+mail		IN	A	192.0.2.25
+www		IN	A	192.0.2.80
+example.net.	60	IN	NS	ns.example.net.
+`, buf.String())
+
+	// The output loads back to the same records
+	zp := dns.NewZoneParser(strings.NewReader(buf.String()), "", "")
+	var parsed []dns.RR
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		parsed = append(parsed, rr)
+	}
+	assert.Nil(t, zp.Err())
+	assert.Len(t, parsed, 6)
+	for _, rr := range parsed {
+		assert.True(t, containsRR(rrs, rr), rr.String())
+	}
+}
+
+func containsRR(rrs []dns.RR, rr dns.RR) bool {
+	for _, r := range rrs {
+		if dns.IsDuplicate(r, rr) && r.Header().Ttl == rr.Header().Ttl {
+			return true
+		}
+	}
+	return false
+}
+
+func TestOutputPrintZone(t *testing.T) {
+	var buf bytes.Buffer
+	p := Printer{Out: &buf, Opts: &cli.Flags{Format: "zone", Name: "example.com"}}
+	p.PrintZone(entries)
+	assert.Equal(t, `$ORIGIN example.com.
+@	86400	IN	A	192.0.2.1
+@	86400	IN	A	192.0.2.2
+@	86400	IN	NS	b.iana-servers.net.
+@	86400	IN	NS	a.iana-servers.net.
+@	86400	IN	MX	0 .
+@	86400	IN	TXT	"v=spf1 -all"
+`, buf.String())
+}
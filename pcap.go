@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/netip"
+	"time"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/natesales/q/transport"
+	"github.com/natesales/q/util/dnstap"
+	"github.com/natesales/q/util/pcap"
+)
+
+// pcapWriter is the pcap output for all transports, or nil if disabled
+var pcapWriter *pcap.Writer
+
+// pcapAddrs returns the client and server addresses to use in synthetic packets, falling back to
+// unspecified addresses when the connection state doesn't have them
+func (c *captureTransport) pcapAddrs() (netip.AddrPort, netip.AddrPort) {
+	server, err := netip.ParseAddrPort(c.ConnState().RemoteAddr)
+	if err != nil {
+		server = netip.AddrPortFrom(netip.IPv4Unspecified(), 53)
+	}
+	server = netip.AddrPortFrom(server.Addr().Unmap().WithZone(""), server.Port())
+
+	client, err := netip.ParseAddrPort(c.ConnState().LocalAddr)
+	if err != nil || client.Addr().Unmap().Is4() != server.Addr().Is4() {
+		unspecified := netip.IPv4Unspecified()
+		if server.Addr().Is6() {
+			unspecified = netip.IPv6Unspecified()
+		}
+		client = netip.AddrPortFrom(unspecified, 0)
+	}
+	client = netip.AddrPortFrom(client.Addr().Unmap().WithZone(""), client.Port())
+
+	return client, server
+}
+
+// writePcap writes the query and response as packets. Plain DNS is written with its UDP or TCP framing,
+// and decrypted payloads from encrypted transports as UDP to port 53 with a comment naming the transport.
+func (c *captureTransport) writePcap(query, response []byte, queryTime, responseTime time.Time) {
+	client, server := c.pcapAddrs()
+
+	write := pcapWriter.WriteUDP
+	var comment string
+	switch tapProtocol(c.transportType) {
+	case dnstap.ProtocolUDP:
+	case dnstap.ProtocolTCP:
+		write = pcapWriter.WriteTCP
+		query = prefixLength(query)
+		response = prefixLength(response)
+	default:
+		comment = "Decrypted DNS payload from " + serverString(c.server, c.transportType)
+		server = netip.AddrPortFrom(server.Addr(), 53)
+	}
+
+	if err := write(queryTime, client, server, query, comment); err != nil {
+		log.Warnf("Writing pcap packet: %s", err)
+	}
+	if response != nil {
+		if err := write(responseTime, server, client, response, comment); err != nil {
+			log.Warnf("Writing pcap packet: %s", err)
+		}
+	}
+}
+
+// prefixLength adds the 2 byte length prefix used for DNS over TCP
+func prefixLength(msg []byte) []byte {
+	if msg == nil {
+		return nil
+	}
+	return append([]byte{byte(len(msg) >> 8), byte(len(msg))}, msg...)
+}
+
+// serverString returns a server address for capture comments
+func serverString(server string, transportType transport.Type) string {
+	if transportType == transport.TypeHTTP {
+		return server
+	}
+	return string(transportType) + "://" + server
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/miekg/dns"
+
+	"github.com/natesales/q/cli"
+	"github.com/natesales/q/output"
+	"github.com/natesales/q/util/dnstap"
+	"github.com/natesales/q/util/pcap"
+)
+
+// capturedMsg is a DNS message read from a capture file
+type capturedMsg struct {
+	time     time.Time
+	src, dst string
+	msg      *dns.Msg
+	rtt      time.Duration // time since the matching query, for responses
+}
+
+// readCapture prints the DNS messages in a pcap, pcapng or dnstap file that match the --read filters
+func readCapture(out io.Writer) error {
+	match, err := captureFilter()
+	if err != nil {
+		return err
+	}
+
+	isDnstap, err := isDnstapFile(opts.Read)
+	if err != nil {
+		return err
+	}
+	// ndjson output is written as messages are read instead of collecting them
+	printer := output.Printer{Out: out, Opts: &opts}
+	streaming := opts.Format == output.FormatNDJSON
+	entries := []*output.Entry{}
+	var read, matched int
+	emit := func(c *capturedMsg) {
+		read++
+		if !match(c.msg) {
+			return
+		}
+		matched++
+		if streaming {
+			if rrFilter != nil {
+				if err := output.FilterReply(c.src+" > "+c.dst, c.msg, rrFilter); err != nil {
+					log.Warnf("Filtering message from %s: %s", c.src, err)
+				}
+			}
+			if c.msg.Response {
+				printer.WriteNDJSON(c.src+" > "+c.dst, nil, c.msg, c.time, c.rtt, nil)
+			} else {
+				printer.WriteNDJSON(c.src+" > "+c.dst, c.msg, nil, c.time, 0, nil)
+			}
+			return
+		}
+		entries = append(entries, &output.Entry{
+			Replies:   []*dns.Msg{c.msg},
+			Server:    c.src + " > " + c.dst,
+			Time:      c.rtt,
+			Timestamp: &c.time,
+		})
+	}
+
+	if isDnstap {
+		err = readDnstap(opts.Read, emit)
+	} else {
+		err = readPcap(opts.Read, emit)
+	}
+	if err != nil {
+		return err
+	}
+	log.Debugf("Read %d DNS messages from %s, %d matched", read, opts.Read, matched)
+	if streaming {
+		return nil
+	}
+
+	// Queries have no answers, so always show the question
+	opts.ShowQuestion = true
+	return printEntries(printer, entries)
+}
+
+// captureFilter returns a function that reports whether a message matches the --read-qname, --read-qtype and --read-rcode filters
+func captureFilter() (func(*dns.Msg) bool, error) {
+	qtypes, err := cli.ParseRRTypes(opts.ReadQtype)
+	if err != nil {
+		return nil, err
+	}
+	rcodes := make(map[int]bool)
+	for _, s := range opts.ReadRcode {
+		rcode, ok := dns.StringToRcode[strings.ToUpper(s)]
+		if !ok {
+			rcode, err = strconv.Atoi(s)
+			if err != nil {
+				return nil, fmt.Errorf("%s is not a valid rcode", s)
+			}
+		}
+		rcodes[rcode] = true
+	}
+	qname := dns.Fqdn(opts.ReadQname)
+
+	return func(m *dns.Msg) bool {
+		if opts.ReadQname != "" && (len(m.Question) == 0 || !dns.IsSubDomain(qname, m.Question[0].Name)) {
+			return false
+		}
+		if len(qtypes) > 0 && (len(m.Question) == 0 || !qtypes[m.Question[0].Qtype]) {
+			return false
+		}
+		if len(rcodes) > 0 && (!m.Response || !rcodes[m.Rcode]) {
+			return false
+		}
+		return true
+	}, nil
+}
+
+// isDnstapFile returns true if a file starts with a Frame Streams control frame instead of a pcap header
+func isDnstapFile(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("opening %s: %s", path, err)
+	}
+	defer file.Close()
+
+	var magic [4]byte
+	if _, err := io.ReadFull(file, magic[:]); err != nil {
+		return false, fmt.Errorf("reading %s: %s", path, err)
+	}
+	return binary.BigEndian.Uint32(magic[:]) == 0, nil
+}
+
+// readPcap calls emit with each DNS message sent over UDP and TCP to or from the --read-port ports in a pcap or pcapng file
+func readPcap(path string, emit func(*capturedMsg)) error {
+	r, err := pcap.Open(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	streams := make(map[string][]byte)       // unread TCP data by flow
+	queryTimes := make(map[string]time.Time) // query times by ID and flow, to find response times
+	for {
+		p, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading %s: %s", path, err)
+		}
+		if !slices.Contains(opts.ReadPort, p.Src.Port()) && !slices.Contains(opts.ReadPort, p.Dst.Port()) {
+			continue
+		}
+
+		payloads := [][]byte{p.Payload}
+		if p.TCP {
+			// Split length prefixed messages out of the flow, keeping partial messages for later segments
+			flow := p.Src.String() + ">" + p.Dst.String()
+			buf := append(streams[flow], p.Payload...)
+			payloads = nil
+			for len(buf) >= 2 && len(buf) >= 2+int(binary.BigEndian.Uint16(buf)) {
+				length := int(binary.BigEndian.Uint16(buf))
+				payloads = append(payloads, buf[2:2+length])
+				buf = buf[2+length:]
+			}
+			streams[flow] = buf
+		}
+
+		for _, payload := range payloads {
+			msg := new(dns.Msg)
+			if err := msg.Unpack(payload); err != nil {
+				log.Debugf("Skipping undecodable DNS message from %s: %s", p.Src, err)
+				continue
+			}
+
+			c := &capturedMsg{time: p.Time, src: p.Src.String(), dst: p.Dst.String(), msg: msg}
+			if !msg.Response {
+				queryTimes[fmt.Sprintf("%d %s %s", msg.Id, c.src, c.dst)] = c.time
+			} else if key := fmt.Sprintf("%d %s %s", msg.Id, c.dst, c.src); !queryTimes[key].IsZero() {
+				c.rtt = c.time.Sub(queryTimes[key])
+				delete(queryTimes, key)
+			}
+			emit(c)
+		}
+	}
+	return nil
+}
+
+// readDnstap calls emit with each DNS message in a dnstap file
+func readDnstap(path string, emit func(*capturedMsg)) error {
+	r, err := dnstap.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for {
+		m, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading %s: %s", path, err)
+		}
+
+		client, server := tapAddr(m.ClientIP, m.ClientPort), tapAddr(m.ServerIP, m.ServerPort)
+		c := &capturedMsg{time: m.QueryTime, src: client, dst: server}
+		wire := m.Query
+		if m.Type.IsResponse() {
+			c.time, c.src, c.dst = m.ResponseTime, server, client
+			wire = m.Response
+			if !m.QueryTime.IsZero() && !m.ResponseTime.IsZero() {
+				c.rtt = m.ResponseTime.Sub(m.QueryTime)
+			}
+		}
+		if wire == nil {
+			continue
+		}
+
+		c.msg = new(dns.Msg)
+		if err := c.msg.Unpack(wire); err != nil {
+			log.Debugf("Skipping undecodable DNS message from %s: %s", c.src, err)
+			continue
+		}
+		emit(c)
+	}
+	return nil
+}
+
+// tapAddr formats a dnstap address and port
+func tapAddr(ip net.IP, port uint16) string {
+	if ip == nil {
+		return "unknown"
+	}
+	return net.JoinHostPort(ip.String(), strconv.Itoa(int(port)))
+}
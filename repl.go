@@ -0,0 +1,342 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/jessevdk/go-flags"
+	"github.com/miekg/dns"
+
+	"github.com/natesales/q/cli"
+	"github.com/natesales/q/util"
+	"github.com/natesales/q/util/lineedit"
+	"github.com/natesales/q/util/resolvers"
+)
+
+// stdin is the input read by the interactive prompt
+var stdin io.Reader = os.Stdin
+
+// inREPL is true while the interactive prompt runs
+var inREPL bool
+
+// replCommands are the commands available at the interactive prompt
+var replCommands = map[string]string{
+	":server":  "Show or replace the servers to query (:server 1.1.1.1 tls://dns.quad9.net)",
+	":set":     "Add flags to every following query (:set --format json +short)",
+	":unset":   "Remove flags added with :set (:unset format short)",
+	":flags":   "Show the flags and servers used for every query",
+	":reset":   "Restore the flags and servers q was started with",
+	":history": "Show the query history",
+	":help":    "Show this help",
+	":quit":    "Close connections and exit (or Ctrl-D)",
+}
+
+// interactive reads queries in q's argument syntax from a prompt and runs them, keeping transports open between queries
+func interactive(in io.Reader, out io.Writer, args []string) error {
+	editor := lineedit.New(in, out)
+	editor.Prompt = "q> "
+	editor.Complete = replCompleter()
+
+	var historyPath string
+	if home, err := os.UserHomeDir(); err == nil {
+		historyPath = filepath.Join(home, ".q_history")
+		if err := editor.LoadHistory(historyPath); err != nil {
+			log.Warnf("Loading history from %s: %s", historyPath, err)
+		}
+	}
+
+	inREPL = true
+	startTransportCache()
+	defer func() {
+		stopTransportCache()
+		inREPL = false
+
+		if historyPath != "" {
+			if err := editor.SaveHistory(historyPath); err != nil {
+				log.Warnf("Saving history to %s: %s", historyPath, err)
+			}
+		}
+	}()
+
+	session := slices.Clone(args)
+	for {
+		line, err := editor.ReadLine()
+		if errors.Is(err, lineedit.ErrInterrupted) {
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		editor.AddHistory(line)
+
+		lineArgs, err := splitArgs(line)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+
+		if strings.HasPrefix(lineArgs[0], ":") {
+			var quit bool
+			session, quit = replCommand(out, editor, lineArgs, session, args)
+			if quit {
+				return nil
+			}
+			continue
+		}
+
+		// Servers given on the line replace the session's servers
+		queryArgs := session
+		if slices.ContainsFunc(lineArgs, isServerArg) {
+			queryArgs = slices.DeleteFunc(slices.Clone(session), isServerArg)
+		}
+		queryArgs = append(slices.Clone(queryArgs), lineArgs...)
+
+		if !validArgs(out, queryArgs) {
+			continue
+		}
+		transportFlags = flagKey(queryArgs)
+		clearOpts()
+		log.SetLevel(log.InfoLevel)
+		if err := driver(queryArgs, out); err != nil && !errors.Is(err, errHelp) {
+			log.Error(err)
+		}
+	}
+}
+
+// replCommand runs a prompt command and returns the new session flags and whether to exit
+func replCommand(out io.Writer, editor *lineedit.Editor, args, session, initial []string) ([]string, bool) {
+	switch args[0] {
+	case ":quit", ":exit", ":q":
+		return session, true
+	case ":server":
+		if len(args) == 1 {
+			for _, arg := range session {
+				if isServerArg(arg) {
+					util.MustWriteln(out, arg)
+				}
+			}
+			break
+		}
+		session = slices.DeleteFunc(session, isServerArg)
+		for _, server := range args[1:] {
+			session = append(session, "@"+strings.TrimPrefix(server, "@"))
+		}
+	case ":set":
+		if validArgs(out, append(slices.Clone(session), args[1:]...)) {
+			session = append(session, args[1:]...)
+		}
+	case ":unset":
+		for _, name := range args[1:] {
+			session = unsetFlag(session, name)
+		}
+	case ":flags":
+		util.MustWriteln(out, strings.Join(session, " "))
+	case ":reset":
+		session = slices.Clone(initial)
+	case ":history":
+		for i, line := range editor.History {
+			util.MustWritef(out, "%4d  %s\n", i+1, line)
+		}
+	case ":help":
+		var names []string
+		for name := range replCommands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		util.MustWriteln(out, "Enter a query as q arguments (e.g. example.com MX @1.1.1.1 +short), or a command:")
+		for _, name := range names {
+			util.MustWritef(out, "  %-9s %s\n", name, replCommands[name])
+		}
+	default:
+		log.Errorf("Unknown command %s (try :help)", args[0])
+	}
+	return session, false
+}
+
+// isServerArg returns true if an argument sets a server with the @ notation
+func isServerArg(arg string) bool {
+	return strings.HasPrefix(arg, "@")
+}
+
+// flagParser returns a parser for q's flags that returns errors instead of printing them and exiting
+func flagParser() *flags.Parser {
+	return flags.NewParser(&cli.Flags{}, flags.HelpFlag|flags.PassDoubleDash)
+}
+
+// validArgs parses arguments with a separate parser so bad flags don't exit the prompt. It logs parse errors and
+// prints the help text if requested, returning false if the arguments shouldn't be run.
+func validArgs(out io.Writer, args []string) bool {
+	args = cli.AddEqualSigns(cli.SetFalseBooleans(&cli.Flags{}, slices.Clone(args)))
+	_, err := flagParser().ParseArgs(args)
+	var flagsErr *flags.Error
+	if errors.As(err, &flagsErr) && flagsErr.Type == flags.ErrHelp {
+		util.MustWriteln(out, flagsErr.Message)
+		return false
+	}
+	if err != nil {
+		log.Error(err)
+		return false
+	}
+	return true
+}
+
+// flagKey returns the flags in a list of arguments, for telling apart transports created with different settings
+func flagKey(args []string) string {
+	var out []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") || strings.HasPrefix(arg, "+") {
+			out = append(out, arg)
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+// unsetFlag removes a flag by long or short name, in -, -- or + notation, along with its separate value
+func unsetFlag(args []string, name string) []string {
+	name = strings.TrimLeft(name, "-+")
+	names := []string{name}
+	opt := flagParser().FindOptionByLongName(name)
+	if opt == nil && len(name) == 1 {
+		opt = flagParser().FindOptionByShortName(rune(name[0]))
+	}
+	if opt != nil {
+		names = append(names, opt.LongName, string(opt.ShortName))
+	}
+	takesValue := opt != nil && reflect.TypeOf(opt.Value()).Kind() != reflect.Bool
+
+	var out []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		dash, plus := strings.HasPrefix(arg, "-"), strings.HasPrefix(arg, "+")
+		flag, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-+"), "=")
+		if plus {
+			flag = strings.TrimPrefix(flag, "no")
+		}
+		if !(dash || plus) || !slices.Contains(names, flag) {
+			out = append(out, arg)
+			continue
+		}
+		// Skip the value of a flag given as --flag value
+		if dash && takesValue && !hasValue {
+			i++
+		}
+	}
+	return out
+}
+
+// splitArgs splits a line into arguments like a shell, with single and double quotes and backslash escapes
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	var cur strings.Builder
+	var quote rune
+	inArg := false
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
+
+// replCompleter returns a completion function for commands, --flags, +flags, public resolver names and RR types
+func replCompleter() func(string) []string {
+	var longFlags, plusFlags, rrTypes []string
+	for _, group := range flagParser().Groups() {
+		for _, opt := range group.Options() {
+			if opt.LongName == "" {
+				continue
+			}
+			longFlags = append(longFlags, "--"+opt.LongName)
+			if reflect.TypeOf(opt.Value()).Kind() == reflect.Bool {
+				plusFlags = append(plusFlags, "+"+opt.LongName, "+no"+opt.LongName)
+			}
+		}
+	}
+	for rrType := range dns.StringToType {
+		rrTypes = append(rrTypes, rrType)
+	}
+	var commands []string
+	for name := range replCommands {
+		commands = append(commands, name)
+	}
+	var servers []string
+	for _, r := range resolvers.Catalog {
+		servers = append(servers, "@"+r.Name)
+		for _, t := range r.Supported() {
+			servers = append(servers, "@"+r.Name+"/"+t)
+		}
+	}
+
+	return func(word string) []string {
+		var candidates []string
+		switch {
+		case strings.HasPrefix(word, ":"):
+			candidates = commands
+		case strings.HasPrefix(word, "-"):
+			candidates = longFlags
+		case strings.HasPrefix(word, "+"):
+			candidates = plusFlags
+		case strings.HasPrefix(word, "@"):
+			candidates = servers
+		case word == "":
+			return nil
+		default:
+			candidates = rrTypes
+		}
+
+		var out []string
+		for _, c := range candidates {
+			if strings.HasPrefix(strings.ToLower(c), strings.ToLower(word)) {
+				out = append(out, c)
+			}
+		}
+		sort.Strings(out)
+		return out
+	}
+}
@@ -3,7 +3,9 @@ package main
 import (
 	"crypto/tls"
 	"fmt"
+	"io"
 	"net"
+	"sort"
 	"strings"
 
 	"github.com/charmbracelet/log"
@@ -11,6 +13,9 @@ import (
 
 	"github.com/natesales/q/cli"
 	"github.com/natesales/q/transport"
+	"github.com/natesales/q/util"
+	"github.com/natesales/q/util/expr"
+	"github.com/natesales/q/util/resolvers"
 )
 
 // createQuery creates a slice of DNS queries
@@ -73,10 +78,7 @@ func createQuery(opts cli.Flags, rrTypes []uint16) []dns.Msg {
 			}
 
 			if opts.ClientSubnet != "" {
-				ip, ipNet, err := net.ParseCIDR(opts.ClientSubnet)
-				if err != nil {
-					log.Fatalf("parsing subnet %s", opts.ClientSubnet)
-				}
+				ip, ipNet, _ := net.ParseCIDR(opts.ClientSubnet) // validated by driver
 				mask, _ := ipNet.Mask.Size()
 				log.Debugf("EDNS0 client subnet %s/%d", ip, mask)
 
@@ -118,13 +120,60 @@ func createQuery(opts cli.Flags, rrTypes []uint16) []dns.Msg {
 	return queries
 }
 
+// newDialer creates a transport dialer based on local options
+func newDialer() (*transport.Dialer, error) {
+	dialer := &transport.Dialer{}
+	if opts.Proxy != "" {
+		proxyURL, err := transport.ParseProxy(opts.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		dialer.Proxy = proxyURL
+	}
+	switch {
+	case opts.IPv4 && opts.IPv6:
+		return nil, fmt.Errorf("-4 and -6 are mutually exclusive")
+	case opts.IPv4:
+		dialer.Family = 4
+	case opts.IPv6:
+		dialer.Family = 6
+	}
+	if opts.SourceIP != "" {
+		dialer.LocalIP = net.ParseIP(opts.SourceIP)
+		if dialer.LocalIP == nil {
+			return nil, fmt.Errorf("invalid source IP %s", opts.SourceIP)
+		}
+	}
+	if opts.SourcePort < 0 || opts.SourcePort > 65535 {
+		return nil, fmt.Errorf("invalid source port %d", opts.SourcePort)
+	}
+	dialer.LocalPort = opts.SourcePort
+	dialer.Timeout = opts.Timeout
+	if opts.Interface != "" {
+		if _, err := net.InterfaceByName(opts.Interface); err != nil {
+			return nil, fmt.Errorf("interface %s: %s", opts.Interface, err)
+		}
+		dialer.Interface = opts.Interface
+	}
+	return dialer, nil
+}
+
 // newTransport creates a new transport based on local options
 func newTransport(server string, transportType transport.Type, tlsConfig *tls.Config) (*transport.Transport, error) {
 	var ts transport.Transport
 
+	dialer, err := newDialer()
+	if err != nil {
+		return nil, err
+	}
+	if dialer.Proxy != nil && (transportType == transport.TypeQUIC || transportType == transport.TypeDNSCrypt) {
+		return nil, fmt.Errorf("proxies are not supported with the %s transport", transportType)
+	}
+
 	common := transport.Common{
 		Server:    server,
 		ReuseConn: opts.ReuseConn,
+		Dialer:    dialer,
 	}
 
 	switch transportType {
@@ -162,6 +211,7 @@ func newTransport(server string, transportType transport.Type, tlsConfig *tls.Co
 				HTTP3:     opts.HTTP3,
 				NoPMTUd:   !opts.PMTUD,
 				Headers:   headers,
+				JSON:      opts.HTTPJSON,
 			}
 		}
 	case transport.TypeDNSCrypt:
@@ -173,6 +223,7 @@ func newTransport(server string, transportType transport.Type, tlsConfig *tls.Co
 				ServerStamp: server,
 				TCP:         opts.DNSCryptTCP,
 				UDPSize:     opts.DNSCryptUDPSize,
+				Timeout:     opts.Timeout,
 			}
 		} else {
 			log.Debug("Using manual DNSCrypt configuration")
@@ -180,6 +231,7 @@ func newTransport(server string, transportType transport.Type, tlsConfig *tls.Co
 
 				TCP:          opts.DNSCryptTCP,
 				UDPSize:      opts.DNSCryptUDPSize,
+				Timeout:      opts.Timeout,
 				PublicKey:    opts.DNSCryptPublicKey,
 				ProviderName: opts.DNSCryptProvider,
 			}
@@ -195,6 +247,7 @@ func newTransport(server string, transportType transport.Type, tlsConfig *tls.Co
 			TLSConfig:       tc,
 			PMTUD:           opts.PMTUD,
 			AddLengthPrefix: opts.QUICLengthPrefix,
+			ZeroRTT:         opts.QUIC0RTT,
 		}
 	case transport.TypeTLS:
 		log.Debugf("Using TLS transport: %s", server)
@@ -212,6 +265,16 @@ func newTransport(server string, transportType transport.Type, tlsConfig *tls.Co
 			Timeout:   opts.Timeout,
 		}
 	case transport.TypePlain:
+		if transport.IsMulticast(server) {
+			log.Debugf("Using mDNS transport: %s", server)
+			ts = &transport.MDNS{
+				Common:    common,
+				UDPBuffer: opts.UDPBuffer,
+				Timeout:   opts.MDNSTimeout,
+				Unicast:   opts.MDNSUnicast,
+			}
+			break
+		}
 		log.Debugf("Using UDP with TCP fallback: %s", server)
 		ts = &transport.Plain{
 			Common:    common,
@@ -224,5 +287,144 @@ func newTransport(server string, transportType transport.Type, tlsConfig *tls.Co
 		return nil, fmt.Errorf("unknown transport protocol %s", transportType)
 	}
 
+	if capturing() {
+		ts = &captureTransport{Transport: ts, transportType: transportType, server: server}
+	}
+
 	return &ts, nil
 }
+
+// loadResolverList loads the --resolver-list file, or returns nil if there isn't one
+func loadResolverList() ([]resolvers.ListEntry, error) {
+	if opts.ResolverList == "" {
+		return nil, nil
+	}
+	list, err := resolvers.LoadList(opts.ResolverList)
+	if err != nil {
+		return nil, fmt.Errorf("loading resolver list: %s", err)
+	}
+	log.Debugf("Loaded %d resolvers from %s", len(list), opts.ResolverList)
+	return list, nil
+}
+
+// matchResolvers returns the resolver list entries matching --resolver-match, or all entries if it isn't set
+func matchResolvers(list []resolvers.ListEntry) ([]resolvers.ListEntry, error) {
+	if opts.ResolverMatch == "" {
+		return list, nil
+	}
+	match, err := expr.Parse(opts.ResolverMatch, resolvers.ListFields)
+	if err != nil {
+		return nil, fmt.Errorf("parsing resolver match: %s", err)
+	}
+
+	var out []resolvers.ListEntry
+	for _, e := range list {
+		ok, err := match.Match(e.Fields())
+		if err != nil {
+			return nil, fmt.Errorf("evaluating resolver match: %s", err)
+		}
+		if ok {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+// publicServers returns the servers added with --all-public and --resolver-match
+func publicServers(list []resolvers.ListEntry) ([]string, error) {
+	var servers []string
+	if opts.AllPublic {
+		for _, r := range resolvers.Catalog {
+			servers = append(servers, r.Default())
+		}
+	}
+
+	if opts.ResolverMatch != "" {
+		if opts.ResolverList == "" {
+			return nil, fmt.Errorf("--resolver-match requires --resolver-list")
+		}
+		matches, err := matchResolvers(list)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range matches {
+			if !e.Queryable() {
+				log.Debugf("Skipping %s resolver %s", e.Protocol, e.Name)
+				continue
+			}
+			servers = append(servers, e.Stamps[0])
+		}
+		if len(servers) == 0 {
+			return nil, fmt.Errorf("no resolvers in %s match %s", opts.ResolverList, opts.ResolverMatch)
+		}
+		log.Debugf("Querying %d resolvers matching %s", len(servers), opts.ResolverMatch)
+	}
+	return servers, nil
+}
+
+// expandServer returns the server for a --resolver-list entry or public resolver catalog name, or s if it isn't one
+func expandServer(s string, list []resolvers.ListEntry) (string, error) {
+	if e := resolvers.FindEntry(list, s); e != nil {
+		if !e.Queryable() {
+			return "", fmt.Errorf("%s is a %s server and can't be queried directly", e.Name, e.Protocol)
+		}
+		log.Debugf("Using %s for resolver list entry %s", e.Stamps[0], s)
+		return e.Stamps[0], nil
+	}
+
+	server, ok, err := resolvers.Lookup(s)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return s, nil
+	}
+	log.Debugf("Using %s for public resolver %s", server, s)
+	return server, nil
+}
+
+// listResolvers prints the --resolver-list entries matching --resolver-match with their protocol and properties,
+// or the public resolver catalog with the server used for each transport
+func listResolvers(out io.Writer) error {
+	if opts.ResolverList != "" {
+		list, err := loadResolverList()
+		if err != nil {
+			return err
+		}
+		matches, err := matchResolvers(list)
+		if err != nil {
+			return err
+		}
+
+		var longestName int
+		for _, e := range matches {
+			longestName = max(longestName, len(e.Name))
+		}
+		for _, e := range matches {
+			var props []string
+			for prop, set := range map[string]bool{"dnssec": e.DNSSEC, "no-log": e.NoLog, "no-filter": e.NoFilter} {
+				if set {
+					props = append(props, prop)
+				}
+			}
+			sort.Strings(props)
+			line := util.Color(util.ColorPurple, fmt.Sprintf("%-*s", longestName, e.Name)) + " " + util.Color(util.ColorMagenta, e.Protocol)
+			if len(props) > 0 {
+				line += strings.Repeat(" ", 9-len(e.Protocol)) + util.Color(util.ColorTeal, strings.Join(props, " "))
+			}
+			util.MustWriteln(out, line)
+		}
+		return nil
+	}
+
+	for i, r := range resolvers.Catalog {
+		if i > 0 {
+			util.MustWriteln(out, "")
+		}
+		util.MustWritef(out, "%s %s\n", util.Color(util.ColorPurple, r.Name), r.Description)
+		for _, t := range r.Supported() {
+			util.MustWritef(out, "  %s %s\n", util.Color(util.ColorMagenta, fmt.Sprintf("%-8s", t)), r.Servers[t])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/miekg/dns"
+
+	"github.com/natesales/q/transport"
+)
+
+// upstream is a transport to a server, locked so only one query uses its connection at a time
+type upstream struct {
+	sync.Mutex
+	server string
+	txp    transport.Transport
+}
+
+// exchange sends a copy of a query to the upstream, since transports may modify the message. A query that fails
+// for any reason but a timeout is retried once, since a reused connection may have been closed by the server while
+// idle and transports reconnect after a failure.
+func (u *upstream) exchange(r *dns.Msg) (*dns.Msg, error) {
+	u.Lock()
+	defer u.Unlock()
+	reply, err := u.txp.Exchange(r.Copy())
+	var netErr net.Error
+	if err != nil && !(errors.As(err, &netErr) && netErr.Timeout()) {
+		log.Debugf("Upstream %s failed: %s, retrying on a new connection", u.server, err)
+		reply, err = u.txp.Exchange(r.Copy())
+	}
+	return reply, err
+}
+
+// cacheEntry is a cached reply and the time it was stored and expires
+type cacheEntry struct {
+	reply   *dns.Msg
+	stored  time.Time
+	expires time.Time
+}
+
+// maxCacheEntries is the number of replies the cache holds before evicting entries to make room
+const maxCacheEntries = 10000
+
+// cacheSweepInterval is how often expired entries are removed from the cache
+const cacheSweepInterval = time.Minute
+
+// cache stores replies until their lowest TTL expires
+type cache struct {
+	sync.Mutex
+	entries   map[cacheKey]cacheEntry
+	nextSweep time.Time
+}
+
+// cacheKey identifies a cached reply by its question and the query options that change the answer
+type cacheKey struct {
+	question dns.Question
+	do       bool
+	cd       bool
+	subnet   string // EDNS client subnet
+}
+
+// newCacheKey returns the cache key for a query
+func newCacheKey(r *dns.Msg) cacheKey {
+	key := cacheKey{question: r.Question[0], cd: r.CheckingDisabled}
+	key.question.Name = strings.ToLower(key.question.Name)
+	if opt := r.IsEdns0(); opt != nil {
+		key.do = opt.Do()
+		for _, o := range opt.Option {
+			if subnet, ok := o.(*dns.EDNS0_SUBNET); ok {
+				key.subnet = subnet.String()
+			}
+		}
+	}
+	return key
+}
+
+// minTTL returns the lowest TTL in a reply, using the SOA minimum for negative answers
+func minTTL(m *dns.Msg) uint32 {
+	var ttl uint32
+	first := true
+	for _, section := range [][]dns.RR{m.Answer, m.Ns, m.Extra} {
+		for _, rr := range section {
+			if rr.Header().Rrtype == dns.TypeOPT {
+				continue
+			}
+			rrTTL := rr.Header().Ttl
+			if soa, ok := rr.(*dns.SOA); ok && soa.Minttl < rrTTL {
+				rrTTL = soa.Minttl
+			}
+			if first || rrTTL < ttl {
+				ttl = rrTTL
+				first = false
+			}
+		}
+	}
+	return ttl
+}
+
+// get returns a copy of a cached reply with TTLs reduced by its age, or nil if there isn't one
+func (c *cache) get(r *dns.Msg) *dns.Msg {
+	c.Lock()
+	defer c.Unlock()
+
+	key := newCacheKey(r)
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil
+	}
+
+	reply := entry.reply.Copy()
+	age := uint32(time.Since(entry.stored).Seconds())
+	for _, section := range [][]dns.RR{reply.Answer, reply.Ns, reply.Extra} {
+		for _, rr := range section {
+			if rr.Header().Rrtype != dns.TypeOPT {
+				rr.Header().Ttl -= min(age, rr.Header().Ttl)
+			}
+		}
+	}
+	return reply
+}
+
+// set caches a successful or NXDOMAIN reply for its lowest TTL
+func (c *cache) set(r, reply *dns.Msg) {
+	if reply.Truncated || (reply.Rcode != dns.RcodeSuccess && reply.Rcode != dns.RcodeNameError) {
+		return
+	}
+	ttl := minTTL(reply)
+	if ttl == 0 {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	now := time.Now()
+	c.evict(now)
+	c.entries[newCacheKey(r)] = cacheEntry{
+		reply:   reply.Copy(),
+		stored:  now,
+		expires: now.Add(time.Duration(ttl) * time.Second),
+	}
+}
+
+// evict removes expired entries periodically, and an arbitrary entry if the cache is still full so there's room for
+// another
+func (c *cache) evict(now time.Time) {
+	if now.After(c.nextSweep) {
+		for key, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, key)
+			}
+		}
+		c.nextSweep = now.Add(cacheSweepInterval)
+	}
+	for key := range c.entries {
+		if len(c.entries) < maxCacheEntries {
+			break
+		}
+		delete(c.entries, key)
+	}
+}
+
+// forwarder is a DNS handler that forwards queries to the first upstream that answers
+type forwarder struct {
+	upstreams  []*upstream
+	cache      *cache // nil if caching is disabled
+	logQueries bool
+}
+
+// resolve answers a query from the cache or an upstream and returns the reply and where it came from
+func (f *forwarder) resolve(r *dns.Msg) (*dns.Msg, string, error) {
+	if len(r.Question) != 1 {
+		return nil, "", fmt.Errorf("expected 1 question, got %d", len(r.Question))
+	}
+	if f.cache != nil {
+		if reply := f.cache.get(r); reply != nil {
+			return reply, "cache", nil
+		}
+	}
+
+	var lastErr error
+	for _, u := range f.upstreams {
+		reply, err := u.exchange(r)
+		if err != nil {
+			log.Debugf("Upstream %s failed: %s", u.server, err)
+			lastErr = fmt.Errorf("%s: %s", u.server, err)
+			continue
+		}
+		if f.cache != nil {
+			f.cache.set(r, reply)
+		}
+		return reply, u.server, nil
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no upstreams")
+	}
+	return nil, "", lastErr
+}
+
+func (f *forwarder) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	start := time.Now()
+	reply, source, err := f.resolve(r)
+	if err != nil {
+		log.Warnf("Forwarding query from %s: %s", w.RemoteAddr(), err)
+		reply = new(dns.Msg)
+		reply.SetRcode(r, dns.RcodeServerFailure)
+		source = "no upstream"
+	}
+	reply.Id = r.Id
+
+	// Truncate replies that don't fit in the client's UDP buffer
+	if _, ok := w.RemoteAddr().(*net.UDPAddr); ok {
+		size := dns.MinMsgSize
+		if opt := r.IsEdns0(); opt != nil {
+			size = int(opt.UDPSize())
+		}
+		reply.Truncate(size)
+	}
+
+	if f.logQueries && len(r.Question) > 0 {
+		log.Infof("%s %s %s from %s: %s with %d answers from %s in %s",
+			r.Question[0].Name,
+			dns.ClassToString[r.Question[0].Qclass],
+			dns.TypeToString[r.Question[0].Qtype],
+			w.RemoteAddr(),
+			dns.RcodeToString[reply.Rcode],
+			len(reply.Answer),
+			source,
+			time.Since(start).Round(100*time.Microsecond),
+		)
+	}
+
+	if err := w.WriteMsg(reply); err != nil {
+		log.Warnf("Writing reply to %s: %s", w.RemoteAddr(), err)
+	}
+}
+
+// serve runs a local stub forwarder on the listen address until interrupted
+func serve(tlsConfig *tls.Config) error {
+	f := &forwarder{logQueries: opts.ServeLog}
+	if opts.ServeCache {
+		f.cache = &cache{entries: make(map[cacheKey]cacheEntry)}
+	}
+
+	for _, serverStr := range opts.Server {
+		server, transportType, err := parseServer(serverStr)
+		if err != nil {
+			return fmt.Errorf("parsing server %s: %s", serverStr, err)
+		}
+
+		serverTLSConfig := tlsConfig
+		if opts.ECH || opts.ECHConfig != "" {
+			serverTLSConfig, err = echTLSConfig(tlsConfig, server, transportType)
+			if err != nil {
+				return fmt.Errorf("configuring ECH for %s: %s", server, err)
+			}
+		}
+
+		if server == opts.ServeListen && (transportType == transport.TypePlain || transportType == transport.TypeTCP) {
+			return fmt.Errorf("upstream %s is the listen address", server)
+		}
+
+		txp, err := newTransport(server, transportType, serverTLSConfig)
+		if err != nil {
+			return fmt.Errorf("creating transport for %s: %s", server, err)
+		}
+		f.upstreams = append(f.upstreams, &upstream{server: server, txp: *txp})
+	}
+	if len(f.upstreams) == 0 {
+		return fmt.Errorf("no upstream servers to forward to, give them as @server")
+	}
+	defer func() {
+		for _, u := range f.upstreams {
+			_ = u.txp.Close()
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errChan := make(chan error, 2)
+	var servers []*dns.Server
+	for _, network := range []string{"udp", "tcp"} {
+		server := &dns.Server{Addr: opts.ServeListen, Net: network, Handler: f}
+		servers = append(servers, server)
+		go func() {
+			errChan <- server.ListenAndServe()
+		}()
+	}
+	log.Infof("Forwarding queries on %s to %s", opts.ServeListen, strings.Join(opts.Server, ", "))
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-errChan:
+		err = fmt.Errorf("listening on %s: %s", opts.ServeListen, err)
+	}
+	for _, server := range servers {
+		_ = server.Shutdown()
+	}
+	return err
+}
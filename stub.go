@@ -0,0 +1,231 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/miekg/dns"
+
+	"github.com/natesales/q/output"
+	"github.com/natesales/q/transport"
+	"github.com/natesales/q/util/resolvconf"
+)
+
+// stubResolver sends queries to a list of nameservers like the system stub resolver
+type stubResolver struct {
+	conf       *resolvconf.Config
+	servers    []string
+	tlsConfig  *tls.Config
+	transports map[string]stubTransport
+	next       int // nameserver to start the next query at when rotating
+}
+
+// stubTransport is an open transport to a nameserver
+type stubTransport struct {
+	txp           *transport.Transport
+	transportType transport.Type
+}
+
+// newStubResolver loads the resolv.conf options and nameservers, using the resolv.conf timeout unless one was given
+func newStubResolver(tlsConfig *tls.Config, timeoutSet bool) (*stubResolver, error) {
+	conf, err := resolvconf.Load(opts.ResolvConf)
+	if err != nil {
+		if len(opts.Server) == 0 {
+			return nil, fmt.Errorf("loading %s: %s", opts.ResolvConf, err)
+		}
+		log.Debugf("Loading %s: %s, using default options", opts.ResolvConf, err)
+		conf, _ = resolvconf.Parse(strings.NewReader(""))
+	}
+
+	// Servers given on the command line replace the nameservers
+	s := &stubResolver{
+		conf:       conf,
+		servers:    conf.Nameservers,
+		tlsConfig:  tlsConfig,
+		transports: make(map[string]stubTransport),
+	}
+	if len(opts.Server) > 0 {
+		s.servers = opts.Server
+	}
+	if len(s.servers) == 0 {
+		return nil, fmt.Errorf("no nameservers in %s", opts.ResolvConf)
+	}
+	if !timeoutSet {
+		opts.Timeout = conf.Timeout
+	}
+	return s, nil
+}
+
+// resolve resolves like the system stub resolver, trying each candidate name from the resolv.conf search list
+// against every nameserver in turn until one has answers
+func (s *stubResolver) resolve(out io.Writer, msgs []dns.Msg) error {
+	defer s.close()
+
+	// Messages sent as is keep their own name
+	candidates := []string{dns.Fqdn(opts.Name)}
+	switch {
+	case sendWire != nil:
+		candidates = []string{questionName(&msgs[0])}
+	case opts.Name != "" && !opts.Reverse:
+		candidates = s.conf.Candidates(opts.Name)
+	}
+	log.Debugf("Stub resolving %s with candidates %v, nameservers %v, ndots %d, attempts %d, timeout %s, rotate %t",
+		opts.Name, candidates, s.servers, s.conf.Ndots, s.conf.Attempts, opts.Timeout, s.conf.Rotate)
+
+	startTime := time.Now()
+	var entry *output.Entry
+	var nodata bool // entry holds a reply without answers for a name that exists
+	var search []output.SearchAttempt
+	for _, candidate := range candidates {
+		queries := make([]dns.Msg, len(msgs))
+		for i := range msgs {
+			msgs[i].CopyTo(&queries[i])
+			if len(queries[i].Question) > 0 && sendWire == nil {
+				queries[i].Question[0].Name = candidate
+			}
+		}
+
+		attempt := output.SearchAttempt{Name: candidate}
+		var replies []*dns.Msg
+		var wires []transport.Wire
+		for i := range queries {
+			reply, wire, server, err := s.exchange(&queries[i])
+			if err != nil {
+				attempt.Server, attempt.Rcode, replies = "", err.Error(), nil
+				break
+			}
+			attempt.Server = server
+			if !attempt.Answered {
+				attempt.Rcode = dns.RcodeToString[reply.Rcode]
+			}
+			if reply.Rcode == dns.RcodeSuccess && len(reply.Answer) > 0 {
+				attempt.Answered = true
+				attempt.Rcode = dns.RcodeToString[reply.Rcode]
+			}
+			replies = append(replies, reply)
+			wires = append(wires, wire)
+		}
+		search = append(search, attempt)
+
+		// Without answers, the first name that exists is shown, or else the last name that got replies
+		if replies != nil && (attempt.Answered || !nodata) {
+			entry = &output.Entry{
+				Queries: queries,
+				Replies: replies,
+				Wire:    wires,
+				Server:  attempt.Server,
+			}
+			nodata = attempt.Rcode == dns.RcodeToString[dns.RcodeSuccess]
+		}
+		if attempt.Answered {
+			break
+		}
+	}
+	if entry == nil {
+		return fmt.Errorf("no nameserver replied for %s", strings.Join(candidates, ", "))
+	}
+	entry.Time = time.Since(startTime)
+	entry.Search = search
+
+	if st, ok := s.transports[entry.Server]; ok {
+		entry.ConnState = (*st.txp).ConnState()
+		if opts.ResolveIPs {
+			entry.LoadPTRs(st.txp)
+		}
+	}
+
+	return printQueryEntries(output.Printer{Out: out, Opts: &opts}, []*output.Entry{entry})
+}
+
+// exchange sends a query to each nameserver in turn for the configured number of attempts, returning the first reply
+// that isn't a server failure along with the nameserver that sent it
+func (s *stubResolver) exchange(msg *dns.Msg) (*dns.Msg, transport.Wire, string, error) {
+	start := s.next
+	if s.conf.Rotate {
+		s.next = (s.next + 1) % len(s.servers)
+	}
+	name := questionName(msg)
+
+	var failed *dns.Msg
+	var failedWire transport.Wire
+	var failedServer string
+	var lastErr error
+	for attempt := 0; attempt < s.conf.Attempts; attempt++ {
+		for i := range s.servers {
+			server := s.servers[(start+i)%len(s.servers)]
+			reply, wire, err := s.exchangeWith(server, msg)
+			if err != nil {
+				log.Debugf("Query for %s to %s failed: %s", name, server, err)
+				lastErr = err
+				continue
+			}
+			switch reply.Rcode {
+			case dns.RcodeServerFailure, dns.RcodeRefused, dns.RcodeNotImplemented:
+				log.Debugf("Query for %s to %s returned %s", name, server, dns.RcodeToString[reply.Rcode])
+				failed, failedWire, failedServer = reply, wire, server
+				continue
+			}
+			return reply, wire, server, nil
+		}
+	}
+
+	// Every nameserver failed, so show the last failure reply if there was one
+	if failed != nil {
+		return failed, failedWire, failedServer, nil
+	}
+	return nil, transport.Wire{}, "", lastErr
+}
+
+// exchangeWith sends a query to a nameserver, reusing its transport from earlier queries, and checks and processes
+// the reply like queries to each server
+func (s *stubResolver) exchangeWith(serverStr string, msg *dns.Msg) (*dns.Msg, transport.Wire, error) {
+	st, ok := s.transports[serverStr]
+	if !ok {
+		server, transportType, err := parseServer(serverStr)
+		if err != nil {
+			return nil, transport.Wire{}, fmt.Errorf("parsing server %s: %s", serverStr, err)
+		}
+		txp, err := openTransport(server, transportType, s.tlsConfig)
+		if err != nil {
+			return nil, transport.Wire{}, fmt.Errorf("creating transport: %s", err)
+		}
+		st = stubTransport{txp: txp, transportType: transportType}
+		s.transports[serverStr] = st
+	}
+
+	reply, wire, err := exchange(*st.txp, msg)
+	if err == nil && reply == nil {
+		err = fmt.Errorf("no reply from server")
+	}
+	if err == nil {
+		err = checkReply(msg, reply, st.transportType)
+	}
+	if err != nil {
+		delete(s.transports, serverStr)
+		_ = closeTransport(st.txp, true)
+		return nil, wire, err
+	}
+	processReply(reply)
+	return reply, wire, nil
+}
+
+// close releases the transports opened for each nameserver
+func (s *stubResolver) close() {
+	for server, st := range s.transports {
+		if err := closeTransport(st.txp, false); err != nil {
+			log.Debugf("Closing transport for %s: %s", server, err)
+		}
+	}
+}
+
+// questionName returns the name of the first question in a message for logging
+func questionName(msg *dns.Msg) string {
+	if len(msg.Question) == 0 {
+		return "<no question>"
+	}
+	return msg.Question[0].Name
+}
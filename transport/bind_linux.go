@@ -0,0 +1,18 @@
+//go:build linux
+
+package transport
+
+import "syscall"
+
+// bindToInterface returns a socket control function that binds sockets to a network interface with SO_BINDTODEVICE
+func bindToInterface(iface string) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		var bindErr error
+		if err := c.Control(func(fd uintptr) {
+			bindErr = syscall.BindToDevice(int(fd), iface)
+		}); err != nil {
+			return err
+		}
+		return bindErr
+	}
+}
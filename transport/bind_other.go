@@ -0,0 +1,15 @@
+//go:build !linux
+
+package transport
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// bindToInterface returns a socket control function that fails, as binding to an interface is only supported on Linux
+func bindToInterface(iface string) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		return fmt.Errorf("binding to interface %s is only supported on Linux, set a source IP instead", iface)
+	}
+}
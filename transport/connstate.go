@@ -0,0 +1,136 @@
+package transport
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// ConnState stores connection details observed by a transport across exchanges
+type ConnState struct {
+	// LocalAddr and RemoteAddr are the addresses of the most recent connection to the server
+	LocalAddr  string `json:",omitempty" yaml:",omitempty"`
+	RemoteAddr string `json:",omitempty" yaml:",omitempty"`
+	// Proxied is true if the most recent connection went through a proxy, so RemoteAddr is the proxy's address
+	Proxied bool `json:",omitempty" yaml:",omitempty"`
+
+	// ECHOffered is true if an ECH config list was sent in the ClientHello
+	ECHOffered bool `json:",omitempty" yaml:",omitempty"`
+	// ECHAccepted is true if the server accepted ECH on the last handshake
+	ECHAccepted bool `json:",omitempty" yaml:",omitempty"`
+	// ECHRetryConfigs is the ECH config list the server suggested after rejecting ECH
+	ECHRetryConfigs []byte `json:",omitempty" yaml:",omitempty"`
+
+	// FullHandshakes and ResumedHandshakes count completed TLS handshakes by whether a session was resumed
+	FullHandshakes    int `json:",omitempty" yaml:",omitempty"`
+	ResumedHandshakes int `json:",omitempty" yaml:",omitempty"`
+	// ZeroRTTHandshakes counts resumed handshakes that carried the query as 0-RTT data
+	ZeroRTTHandshakes int `json:",omitempty" yaml:",omitempty"`
+	// FullHandshakeTime and ResumedHandshakeTime are the total time spent in each kind of handshake
+	FullHandshakeTime    time.Duration `json:",omitempty" yaml:",omitempty"`
+	ResumedHandshakeTime time.Duration `json:",omitempty" yaml:",omitempty"`
+}
+
+// ConnState returns the connection state of the transport
+func (c *Common) ConnState() *ConnState {
+	return &c.connState
+}
+
+// Family returns the IP version of the most recent connection, or an empty string if unknown
+func (s *ConnState) Family() string {
+	host, _, err := net.SplitHostPort(s.RemoteAddr)
+	if err != nil {
+		return ""
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return ""
+	}
+	if ip.To4() != nil {
+		return "IPv4"
+	}
+	return "IPv6"
+}
+
+// Peer returns the remote address of the most recent connection, labeled if it's the address of a proxy
+func (s *ConnState) Peer() string {
+	if s.Proxied {
+		return "proxy " + s.RemoteAddr
+	}
+	return s.RemoteAddr
+}
+
+// recordConn records the addresses of a new connection of the transport, noting if it went through the proxy. Only
+// TCP connections are proxied.
+func (c *Common) recordConn(conn interface {
+	LocalAddr() net.Addr
+	RemoteAddr() net.Addr
+}) {
+	c.connState.recordConn(conn)
+	_, udp := conn.LocalAddr().(*net.UDPAddr)
+	c.connState.Proxied = c.dialer().Proxy != nil && !udp
+}
+
+// recordConn records the addresses of a new connection
+func (s *ConnState) recordConn(conn interface {
+	LocalAddr() net.Addr
+	RemoteAddr() net.Addr
+}) {
+	if addr := conn.LocalAddr(); addr != nil {
+		s.LocalAddr = addr.String()
+	}
+	if addr := conn.RemoteAddr(); addr != nil {
+		s.RemoteAddr = addr.String()
+	}
+}
+
+// recordTLS updates the connection state from a completed TLS handshake
+func (s *ConnState) recordTLS(config *tls.Config, cs tls.ConnectionState) {
+	if config != nil && len(config.EncryptedClientHelloConfigList) > 0 {
+		s.ECHOffered = true
+		s.ECHAccepted = cs.ECHAccepted
+	}
+}
+
+// recordHandshake counts a completed TLS handshake that took d
+func (s *ConnState) recordHandshake(cs tls.ConnectionState, used0RTT bool, d time.Duration) {
+	if cs.DidResume {
+		s.ResumedHandshakes++
+		s.ResumedHandshakeTime += d
+		if used0RTT {
+			s.ZeroRTTHandshakes++
+		}
+	} else {
+		s.FullHandshakes++
+		s.FullHandshakeTime += d
+	}
+}
+
+// HandshakeTimeSaved estimates the time saved by resumed handshakes compared to the average full handshake
+func (s *ConnState) HandshakeTimeSaved() time.Duration {
+	if s.FullHandshakes == 0 || s.ResumedHandshakes == 0 {
+		return 0
+	}
+	avgFull := s.FullHandshakeTime / time.Duration(s.FullHandshakes)
+	avgResumed := s.ResumedHandshakeTime / time.Duration(s.ResumedHandshakes)
+	return (avgFull - avgResumed) * time.Duration(s.ResumedHandshakes)
+}
+
+// recordError updates the connection state from a failed TLS handshake and annotates ECH rejections with the server's retry configs
+func (s *ConnState) recordError(err error) error {
+	var echErr *tls.ECHRejectionError
+	if !errors.As(err, &echErr) {
+		return err
+	}
+
+	s.ECHOffered = true
+	s.ECHAccepted = false
+	s.ECHRetryConfigs = echErr.RetryConfigList
+	if len(echErr.RetryConfigList) == 0 {
+		return fmt.Errorf("%w (no retry configs)", err)
+	}
+	return fmt.Errorf("%w (retry configs: %s)", err, base64.StdEncoding.EncodeToString(echErr.RetryConfigList))
+}
@@ -0,0 +1,315 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/quic-go/quic-go"
+	"golang.org/x/net/proxy"
+)
+
+// Dialer opens connections to servers for transports
+type Dialer struct {
+	// Proxy is an optional http://, https://, socks5:// or socks5h:// proxy for TCP connections.
+	// socks5:// resolves names locally, socks5h:// lets the proxy resolve them.
+	Proxy *url.URL
+
+	// LocalIP and LocalPort set the source address of outgoing connections
+	LocalIP   net.IP
+	LocalPort int
+
+	// Interface binds outgoing connections to a network interface
+	Interface string
+
+	// Family limits connections to IPv4 (4) or IPv6 (6) addresses, or races both if 0
+	Family int
+
+	// Timeout bounds proxy handshakes when the context has no deadline
+	Timeout time.Duration
+}
+
+// dialer returns the transport's dialer, or a direct dialer if unset
+func (c *Common) dialer() *Dialer {
+	if c.Dialer == nil {
+		return &Dialer{}
+	}
+	return c.Dialer
+}
+
+// ParseProxy parses and validates a proxy URL
+func ParseProxy(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("parsing proxy URL %s: %w", s, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q, expected http, https, socks5 or socks5h", u.Scheme)
+	}
+	if u.Port() == "" {
+		port := "1080"
+		switch u.Scheme {
+		case "http":
+			port = "80"
+		case "https":
+			port = "443"
+		}
+		u.Host = net.JoinHostPort(u.Hostname(), port)
+	}
+	return u, nil
+}
+
+// localAddr returns the source address for a network, or nil to let the system choose
+func (d *Dialer) localAddr(network string) net.Addr {
+	if d.LocalIP == nil && d.LocalPort == 0 {
+		return nil
+	}
+	if strings.HasPrefix(network, "udp") {
+		return &net.UDPAddr{IP: d.LocalIP, Port: d.LocalPort}
+	}
+	return &net.TCPAddr{IP: d.LocalIP, Port: d.LocalPort}
+}
+
+// control returns the socket control function that binds sockets to the interface, if set
+func (d *Dialer) control() func(network, address string, c syscall.RawConn) error {
+	if d.Interface == "" {
+		return nil
+	}
+	return bindToInterface(d.Interface)
+}
+
+// netDialer returns a net.Dialer for network with the source address and interface applied
+func (d *Dialer) netDialer(network string) *net.Dialer {
+	return &net.Dialer{
+		LocalAddr: d.localAddr(network),
+		Control:   d.control(),
+	}
+}
+
+// listenPacket opens a UDP socket with the source address and interface applied
+func (d *Dialer) listenPacket(ctx context.Context, network string) (net.PacketConn, error) {
+	address := ":0"
+	if addr := d.localAddr(network); addr != nil {
+		address = addr.String()
+	}
+	lc := net.ListenConfig{Control: d.control()}
+	return lc.ListenPacket(ctx, network, address)
+}
+
+// dialDirect opens a connection without a proxy, racing addresses of both families for TCP
+func (d *Dialer) dialDirect(ctx context.Context, network, address string) (net.Conn, error) {
+	addrs, err := d.resolve(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	dial := func(ctx context.Context, addr string) (net.Conn, error) {
+		conn, err := d.netDialer(network).DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		// Reset TCP connections from a fixed source port on close instead of leaving them in TIME_WAIT, which
+		// would stop the next connection to the same server from using the port
+		if tcpConn, ok := conn.(*net.TCPConn); ok && d.LocalPort != 0 {
+			_ = tcpConn.SetLinger(0)
+		}
+		return conn, nil
+	}
+
+	// UDP has no handshake to race, so use the first address that can be dialed
+	if strings.HasPrefix(network, "udp") {
+		return dialInOrder(ctx, addrs, dial)
+	}
+	return happyEyeballs(ctx, addrs, dial, func(conn net.Conn) { _ = conn.Close() })
+}
+
+// dialQUIC opens a QUIC connection, racing handshakes to addresses of both families and sending early data if early is set and a session can be resumed
+func (d *Dialer) dialQUIC(ctx context.Context, address string, tlsConfig *tls.Config, quicConfig *quic.Config, early bool) (*quic.Conn, error) {
+	addrs, err := d.resolve(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	dial := func(ctx context.Context, addr string) (*quic.Conn, error) {
+		return d.dialQUICAddr(ctx, addr, tlsConfig, quicConfig, early)
+	}
+	return happyEyeballs(ctx, addrs, dial, func(conn *quic.Conn) { _ = conn.CloseWithError(0, "") })
+}
+
+// dialQUICAddr opens a QUIC connection to a single address
+func (d *Dialer) dialQUICAddr(ctx context.Context, address string, tlsConfig *tls.Config, quicConfig *quic.Config, early bool) (*quic.Conn, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	pc, err := d.listenPacket(ctx, "udp")
+	if err != nil {
+		return nil, err
+	}
+
+	dial := quic.Dial
+	if early {
+		dial = quic.DialEarly
+	}
+	conn, err := dial(ctx, pc, udpAddr, tlsConfig, quicConfig)
+	if err != nil {
+		_ = pc.Close()
+		return nil, err
+	}
+
+	// quic-go doesn't close packet conns it didn't create
+	go func() {
+		<-conn.Context().Done()
+		_ = pc.Close()
+	}()
+	return conn, nil
+}
+
+// DialContext opens a connection to address, through the proxy if set
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if d.Proxy == nil {
+		return d.dialDirect(ctx, network, address)
+	}
+
+	log.Debugf("Dialing %s through %s proxy %s", address, d.Proxy.Scheme, d.Proxy.Host)
+	switch d.Proxy.Scheme {
+	case "socks5", "socks5h":
+		return d.dialSOCKS5(ctx, network, address)
+	default:
+		return d.dialConnect(ctx, address)
+	}
+}
+
+// dialSOCKS5 opens a connection through a SOCKS5 proxy
+func (d *Dialer) dialSOCKS5(ctx context.Context, network, address string) (net.Conn, error) {
+	var auth *proxy.Auth
+	if d.Proxy.User != nil {
+		password, _ := d.Proxy.User.Password()
+		auth = &proxy.Auth{User: d.Proxy.User.Username(), Password: password}
+	}
+
+	// Resolve the server name locally unless the proxy should resolve it
+	if d.Proxy.Scheme == "socks5" {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		if net.ParseIP(host) == nil {
+			addrs, err := d.resolve(ctx, net.JoinHostPort(host, port))
+			if err != nil {
+				return nil, err
+			}
+			address = addrs[0]
+		}
+	}
+
+	socksDialer, err := proxy.SOCKS5("tcp", d.Proxy.Host, auth, dialerFunc(d.dialDirect))
+	if err != nil {
+		return nil, fmt.Errorf("creating SOCKS5 dialer: %w", err)
+	}
+	return socksDialer.(proxy.ContextDialer).DialContext(ctx, network, address)
+}
+
+// dialConnect opens a tunnel through an HTTP(S) proxy with the CONNECT method
+func (d *Dialer) dialConnect(ctx context.Context, address string) (net.Conn, error) {
+	conn, err := d.dialDirect(ctx, "tcp", d.Proxy.Host)
+	if err != nil {
+		return nil, fmt.Errorf("dialing proxy %s: %w", d.Proxy.Host, err)
+	}
+
+	// Bound the handshake so a proxy that never answers doesn't hang the query
+	deadline, ok := ctx.Deadline()
+	if !ok && d.Timeout > 0 {
+		deadline = time.Now().Add(d.Timeout)
+	}
+	_ = conn.SetDeadline(deadline)
+
+	if d.Proxy.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: d.Proxy.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("proxy TLS handshake: %w", err)
+		}
+		conn = tlsConn
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if d.Proxy.User != nil {
+		password, _ := d.Proxy.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(d.Proxy.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("writing CONNECT request: %w", err)
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("reading CONNECT response: %w", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_ = conn.Close()
+		return nil, fmt.Errorf("proxy %s responded to CONNECT with %s", d.Proxy.Host, resp.Status)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// httpProxy returns the proxy function for an http.Transport, handling HTTP(S) proxies natively and SOCKS5 proxies in DialContext
+func (d *Dialer) httpProxy() func(*http.Request) (*url.URL, error) {
+	if d.Proxy == nil || d.Proxy.Scheme == "socks5" || d.Proxy.Scheme == "socks5h" {
+		return nil
+	}
+	return http.ProxyURL(d.Proxy)
+}
+
+// httpDialContext returns the dial function for an http.Transport
+func (d *Dialer) httpDialContext() func(ctx context.Context, network, address string) (net.Conn, error) {
+	if d.httpProxy() != nil {
+		return d.dialDirect
+	}
+	return d.DialContext
+}
+
+// dialerFunc adapts a dial function to proxy.Dialer
+type dialerFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+func (f dialerFunc) Dial(network, address string) (net.Conn, error) {
+	return f(context.Background(), network, address)
+}
+
+func (f dialerFunc) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return f(ctx, network, address)
+}
+
+// bufferedConn is a net.Conn that reads data buffered while reading the CONNECT response first
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
@@ -1,10 +1,21 @@
 package transport
 
 import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/ameshkov/dnscrypt/v2"
+	"github.com/ameshkov/dnscrypt/v2/xsecretbox"
 	"github.com/charmbracelet/log"
 	"github.com/jedisct1/go-dnsstamps"
 	"github.com/miekg/dns"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/nacl/box"
+
+	"github.com/natesales/q/util"
 )
 
 type DNSCrypt struct {
@@ -12,6 +23,7 @@ type DNSCrypt struct {
 	ServerStamp string
 	TCP         bool // default false (UDP)
 	UDPSize     int
+	Timeout     time.Duration
 
 	// ServerStamp takes precedence if set
 	PublicKey    string
@@ -21,25 +33,33 @@ type DNSCrypt struct {
 	client   *dnscrypt.Client
 }
 
-func (d *DNSCrypt) setup() {
+func (d *DNSCrypt) setup() error {
 	if d.client == nil || d.resolver == nil || !d.ReuseConn {
 		d.client = &dnscrypt.Client{
 			UDPSize: d.UDPSize,
+			Timeout: d.Timeout,
 		}
 
 		if d.ServerStamp == "" {
 			stamp, err := dnsstamps.NewDNSCryptServerStampFromLegacy(d.Server, d.PublicKey, d.ProviderName, 0)
 			if err != nil {
-				log.Fatalf("failed to create stamp from provider information: %s", err)
+				return fmt.Errorf("creating stamp from provider information: %w", err)
 			}
 			d.ServerStamp = stamp.String()
 			log.Debugf("Created DNS stamp from manual DNSCrypt configuration: %s", d.ServerStamp)
 		}
 
 		// Resolve server DNS stamp
-		ro, err := d.client.Dial(d.ServerStamp)
+		stamp, err := dnsstamps.NewServerStampFromString(d.ServerStamp)
+		if err != nil {
+			return fmt.Errorf("parsing DNS stamp: %w", err)
+		}
+		if stamp.Proto != dnsstamps.StampProtoTypeDNSCrypt {
+			return fmt.Errorf("DNS stamp is not a DNSCrypt stamp")
+		}
+		ro, err := d.dialStamp(stamp)
 		if err != nil {
-			log.Fatalf("failed to dial DNSCrypt server: %s", err)
+			return fmt.Errorf("dialing DNSCrypt server: %w", err)
 		}
 		d.resolver = ro
 	}
@@ -48,11 +68,107 @@ func (d *DNSCrypt) setup() {
 	} else {
 		d.client.Net = "udp"
 	}
+	return nil
+}
+
+// dialStamp fetches and validates the resolver certificate like dnscrypt.Client.DialStamp, but through the
+// transport's dialer so the source address, interface and timeout apply to it
+func (d *DNSCrypt) dialStamp(stamp dnsstamps.ServerStamp) (*dnscrypt.ResolverInfo, error) {
+	ri := &dnscrypt.ResolverInfo{
+		ServerPublicKey: stamp.ServerPk,
+		ServerAddress:   stamp.ServerAddrStr,
+		ProviderName:    stamp.ProviderName,
+	}
+	if _, err := rand.Read(ri.SecretKey[:]); err != nil {
+		return nil, err
+	}
+	curve25519.ScalarBaseMult(&ri.PublicKey, &ri.SecretKey)
+
+	cert, err := d.fetchCert(stamp)
+	if err != nil {
+		return nil, err
+	}
+	ri.ResolverCert = cert
+
+	switch cert.EsVersion {
+	case dnscrypt.XChacha20Poly1305:
+		ri.SharedKey, err = xsecretbox.SharedKey(ri.SecretKey, cert.ResolverPk)
+		if err != nil {
+			return nil, fmt.Errorf("computing shared key: %w", err)
+		}
+	case dnscrypt.XSalsa20Poly1305:
+		box.Precompute(&ri.SharedKey, &cert.ResolverPk, &ri.SecretKey)
+	default:
+		return nil, fmt.Errorf("unsupported encryption system %s", cert.EsVersion)
+	}
+	return ri, nil
+}
+
+// fetchCert queries the provider's certificates and returns the valid one with the highest serial, preferring
+// XChacha20Poly1305 for the same serial
+func (d *DNSCrypt) fetchCert(stamp dnsstamps.ServerStamp) (*dnscrypt.Cert, error) {
+	providerName := dns.Fqdn(stamp.ProviderName)
+	query := new(dns.Msg)
+	query.SetQuestion(providerName, dns.TypeTXT)
+
+	plain := &Plain{
+		Common:    Common{Server: stamp.ServerAddrStr, Dialer: d.Dialer},
+		PreferTCP: d.TCP,
+		UDPBuffer: 1252,
+		Timeout:   d.Timeout,
+	}
+	reply, err := plain.Exchange(query)
+	if err != nil {
+		return nil, fmt.Errorf("fetching certificate: %w", err)
+	}
+	if reply.Rcode != dns.RcodeSuccess {
+		return nil, fmt.Errorf("fetching certificate: %s", dns.RcodeToString[reply.Rcode])
+	}
+
+	var best *dnscrypt.Cert
+	for _, rr := range reply.Answer {
+		txt, ok := rr.(*dns.TXT)
+		if !ok {
+			continue
+		}
+		cert := &dnscrypt.Cert{}
+		if err := cert.Deserialize(util.Unescape(strings.Join(txt.Txt, ""))); err != nil {
+			log.Debugf("Skipping invalid certificate from %s: %s", providerName, err)
+			continue
+		}
+		if !cert.VerifyDate() || !cert.VerifySignature(stamp.ServerPk) {
+			log.Debugf("Skipping expired or unsigned certificate %d from %s", cert.Serial, providerName)
+			continue
+		}
+		if best == nil || cert.Serial > best.Serial || (cert.Serial == best.Serial && cert.EsVersion > best.EsVersion) {
+			best = cert
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("no valid certificates for provider %s", providerName)
+	}
+	return best, nil
 }
 
 func (d *DNSCrypt) Exchange(msg *dns.Msg) (*dns.Msg, error) {
-	d.setup()
-	return d.client.Exchange(msg, d.resolver)
+	if err := d.setup(); err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	if d.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+		defer cancel()
+	}
+	conn, err := d.dialer().dialDirect(ctx, d.client.Net, d.resolver.ServerAddress)
+	if err != nil {
+		return nil, fmt.Errorf("dialing %s: %w", d.resolver.ServerAddress, err)
+	}
+	defer conn.Close()
+	d.recordConn(conn)
+
+	return d.client.ExchangeConn(conn, msg, d.resolver)
 }
 
 func (d *DNSCrypt) Close() error {
@@ -1,7 +1,88 @@
 package transport
 
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ameshkov/dnscrypt/v2"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
 func dnscryptTransport() *DNSCrypt {
 	return &DNSCrypt{
 		ServerStamp: "sdns://AQMAAAAAAAAAETk0LjE0MC4xNC4xNDo1NDQzINErR_JS3PLCu_iZEIbq95zkSV2LFsigxDIuUso_OQhzIjIuZG5zY3J5cHQuZGVmYXVsdC5uczEuYWRndWFyZC5jb20",
 	}
 }
+
+// emptyReplyHandler is a DNSCrypt handler that answers every query with an empty reply
+type emptyReplyHandler struct{}
+
+func (emptyReplyHandler) ServeDNS(rw dnscrypt.ResponseWriter, r *dns.Msg) error {
+	return rw.WriteMsg(new(dns.Msg).SetReply(r))
+}
+
+// localDNSCryptServer starts a DNSCrypt server on random local UDP and TCP ports that answers every query with an
+// empty reply, and returns its stamp
+func localDNSCryptServer(t *testing.T) string {
+	rc, err := dnscrypt.GenerateResolverConfig("example.org", nil)
+	assert.Nil(t, err)
+	cert, err := rc.CreateCert()
+	assert.Nil(t, err)
+	s := &dnscrypt.Server{
+		ProviderName: rc.ProviderName,
+		ResolverCert: cert,
+		Handler:      emptyReplyHandler{},
+	}
+
+	udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	assert.Nil(t, err)
+	tcpListener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: udpConn.LocalAddr().(*net.UDPAddr).Port})
+	assert.Nil(t, err)
+	go func() { _ = s.ServeUDP(udpConn) }()
+	go func() { _ = s.ServeTCP(tcpListener) }()
+	t.Cleanup(func() {
+		_ = udpConn.Close()
+		_ = tcpListener.Close()
+	})
+
+	stamp, err := rc.CreateStamp(udpConn.LocalAddr().String())
+	assert.Nil(t, err)
+	return stamp.String()
+}
+
+func TestTransportDNSCryptLocal(t *testing.T) {
+	stamp := localDNSCryptServer(t)
+	for _, tcp := range []bool{false, true} {
+		d := &DNSCrypt{
+			Common:      Common{Dialer: &Dialer{LocalIP: net.ParseIP("127.0.0.1")}},
+			ServerStamp: stamp,
+			TCP:         tcp,
+			Timeout:     2 * time.Second,
+		}
+		query := validQuery()
+		reply, err := d.Exchange(query)
+		assert.Nil(t, err)
+		assert.Equal(t, query.Id, reply.Id)
+		assert.Equal(t, "IPv4", d.ConnState().Family())
+	}
+}
+
+func TestTransportDNSCryptTimeout(t *testing.T) {
+	// The server never replies, so fetching the certificate should time out instead of hanging
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	d := &DNSCrypt{
+		Common:       Common{Server: conn.LocalAddr().String()},
+		PublicKey:    "2FE3:1C1B:2B49:C9B8:9C56:5A5E:1D5B:6B8E:2E8B:0A31:5A9F:8F02:8C1A:0C4E:0E4A:7F1E",
+		ProviderName: "2.dnscrypt-cert.example.org",
+		Timeout:      200 * time.Millisecond,
+	}
+	start := time.Now()
+	_, err = d.Exchange(validQuery())
+	assert.NotNil(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
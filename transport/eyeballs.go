@@ -0,0 +1,148 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// attemptDelay is the time to wait for a connection attempt before starting the next one
+// https://datatracker.ietf.org/doc/html/rfc8305#section-5
+const attemptDelay = 250 * time.Millisecond
+
+// resolve returns the addresses for a host:port, limited to the dialer's address family and interleaved with IPv6 first
+func (d *Dialer) resolve(ctx context.Context, address string) ([]string, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	// Addresses are used as given, the family only applies to hostnames
+	if net.ParseIP(host) != nil {
+		return []string{address}, nil
+	}
+
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: %w", host, err)
+	}
+
+	var v4, v6 []string
+	for _, ip := range ips {
+		if ip.IP.To4() != nil {
+			v4 = append(v4, net.JoinHostPort(ip.String(), port))
+		} else {
+			v6 = append(v6, net.JoinHostPort(ip.String(), port))
+		}
+	}
+	switch d.Family {
+	case 4:
+		v6 = nil
+	case 6:
+		v4 = nil
+	}
+
+	// Interleave address families so a broken family only delays each attempt once
+	// https://datatracker.ietf.org/doc/html/rfc8305#section-4
+	var out []string
+	for i := 0; i < len(v4) || i < len(v6); i++ {
+		if i < len(v6) {
+			out = append(out, v6[i])
+		}
+		if i < len(v4) {
+			out = append(out, v4[i])
+		}
+	}
+	if len(out) == 0 {
+		if d.Family != 0 {
+			return nil, fmt.Errorf("no IPv%d addresses found for %s", d.Family, host)
+		}
+		return nil, fmt.Errorf("no addresses found for %s", host)
+	}
+	return out, nil
+}
+
+// dialInOrder dials addresses one at a time and returns the first connection to succeed, or the first error
+func dialInOrder[T any](ctx context.Context, addrs []string, dial func(context.Context, string) (T, error)) (T, error) {
+	var firstErr error
+	for _, addr := range addrs {
+		conn, err := dial(ctx, addr)
+		if err == nil {
+			return conn, nil
+		}
+		log.Debugf("Connecting to %s: %s", addr, err)
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	var zero T
+	return zero, firstErr
+}
+
+// happyEyeballs dials addresses in order, starting the next attempt when the previous one fails or after attemptDelay,
+// and returns the first connection to succeed. Connections that lose the race are closed.
+func happyEyeballs[T any](ctx context.Context, addrs []string, dial func(context.Context, string) (T, error), closeConn func(T)) (T, error) {
+	type result struct {
+		conn T
+		addr string
+		err  error
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan result, len(addrs))
+	next, pending := 0, 0
+	start := func() {
+		addr := addrs[next]
+		next++
+		pending++
+		log.Debugf("Connecting to %s", addr)
+		go func() {
+			conn, err := dial(ctx, addr)
+			results <- result{conn, addr, err}
+		}()
+	}
+
+	start()
+	timer := time.NewTimer(attemptDelay)
+	defer timer.Stop()
+
+	var firstErr error
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			if next < len(addrs) {
+				start()
+				timer.Reset(attemptDelay)
+			}
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				log.Debugf("Connected to %s", r.addr)
+				go func(n int) {
+					for ; n > 0; n-- {
+						if lost := <-results; lost.err == nil {
+							closeConn(lost.conn)
+						}
+					}
+				}(pending)
+				return r.conn, nil
+			}
+			log.Debugf("Connecting to %s: %s", r.addr, r.err)
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			if next < len(addrs) {
+				start()
+				timer.Reset(attemptDelay)
+			}
+		}
+	}
+
+	var zero T
+	return zero, firstErr
+}
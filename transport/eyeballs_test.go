@@ -0,0 +1,75 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHappyEyeballsFallback(t *testing.T) {
+	// The first address hangs, so the second attempt should start after attemptDelay and win
+	dial := func(ctx context.Context, addr string) (string, error) {
+		if addr == "[2001:db8::1]:53" {
+			<-ctx.Done()
+			return "", ctx.Err()
+		}
+		return addr, nil
+	}
+	start := time.Now()
+	conn, err := happyEyeballs(context.Background(), []string{"[2001:db8::1]:53", "192.0.2.1:53"}, dial, func(string) {})
+	assert.Nil(t, err)
+	assert.Equal(t, "192.0.2.1:53", conn)
+	assert.GreaterOrEqual(t, time.Since(start), attemptDelay)
+}
+
+func TestHappyEyeballsFailFast(t *testing.T) {
+	// A failed attempt should start the next one without waiting
+	dial := func(ctx context.Context, addr string) (string, error) {
+		if addr == "[2001:db8::1]:53" {
+			return "", errors.New("network unreachable")
+		}
+		return addr, nil
+	}
+	start := time.Now()
+	conn, err := happyEyeballs(context.Background(), []string{"[2001:db8::1]:53", "192.0.2.1:53"}, dial, func(string) {})
+	assert.Nil(t, err)
+	assert.Equal(t, "192.0.2.1:53", conn)
+	assert.Less(t, time.Since(start), attemptDelay)
+}
+
+func TestHappyEyeballsAllFail(t *testing.T) {
+	dial := func(ctx context.Context, addr string) (string, error) {
+		return "", errors.New("connection refused " + addr)
+	}
+	_, err := happyEyeballs(context.Background(), []string{"[2001:db8::1]:53", "192.0.2.1:53"}, dial, func(string) {})
+	assert.EqualError(t, err, "connection refused [2001:db8::1]:53")
+}
+
+func TestDialInOrder(t *testing.T) {
+	// An unreachable IPv6 address shouldn't stop UDP from using the IPv4 address
+	var tried []string
+	dial := func(ctx context.Context, addr string) (string, error) {
+		tried = append(tried, addr)
+		if addr == "[2001:db8::1]:53" {
+			return "", errors.New("network unreachable")
+		}
+		return addr, nil
+	}
+	conn, err := dialInOrder(context.Background(), []string{"[2001:db8::1]:53", "192.0.2.1:53", "192.0.2.2:53"}, dial)
+	assert.Nil(t, err)
+	assert.Equal(t, "192.0.2.1:53", conn)
+	assert.Equal(t, []string{"[2001:db8::1]:53", "192.0.2.1:53"}, tried)
+
+	_, err = dialInOrder(context.Background(), []string{"[2001:db8::1]:53"}, dial)
+	assert.EqualError(t, err, "network unreachable")
+}
+
+func TestDialerResolveLiteral(t *testing.T) {
+	d := &Dialer{Family: 6}
+	addrs, err := d.resolve(context.Background(), "192.0.2.1:53")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"192.0.2.1:53"}, addrs)
+}
@@ -2,11 +2,15 @@ package transport
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/base64"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/http/httptrace"
+	"time"
 
 	"github.com/charmbracelet/log"
 	"github.com/miekg/dns"
@@ -24,14 +28,19 @@ type HTTP struct {
 	HTTP2, HTTP3 bool
 	NoPMTUd      bool
 	Headers      map[string][]string
+	JSON         bool // Use the JSON API instead of RFC 8484 wire format
 
 	conn *http.Client
 }
 
-func (h *HTTP) Exchange(m *dns.Msg) (*dns.Msg, error) {
+// setup creates the HTTP client if it doesn't exist or connections shouldn't be reused
+func (h *HTTP) setup() {
 	if h.conn == nil || !h.ReuseConn {
-		transport := http.DefaultTransport.(*http.Transport)
+		dialer := h.dialer()
+		transport := http.DefaultTransport.(*http.Transport).Clone()
 		transport.TLSClientConfig = h.TLSConfig
+		transport.Proxy = dialer.httpProxy()
+		transport.DialContext = h.recordDial(dialer.httpDialContext())
 		h.conn = &http.Client{
 			Transport: transport,
 		}
@@ -40,6 +49,18 @@ func (h *HTTP) Exchange(m *dns.Msg) (*dns.Msg, error) {
 			h.conn.Transport = &http2.Transport{
 				TLSClientConfig: h.TLSConfig,
 				AllowHTTP:       true,
+				DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+					conn, err := h.recordDial(dialer.DialContext)(ctx, network, addr)
+					if err != nil {
+						return nil, err
+					}
+					tlsConn := tls.Client(conn, cfg)
+					if err := tlsConn.HandshakeContext(ctx); err != nil {
+						_ = conn.Close()
+						return nil, err
+					}
+					return tlsConn, nil
+				},
 			}
 		} else if h.HTTP3 {
 			log.Debug("Using HTTP/3")
@@ -48,15 +69,94 @@ func (h *HTTP) Exchange(m *dns.Msg) (*dns.Msg, error) {
 				QUICConfig: &quic.Config{
 					DisablePathMTUDiscovery: h.NoPMTUd,
 				},
+				Dial: func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+					conn, err := dialer.dialQUIC(ctx, addr, tlsCfg, cfg, true)
+					if err == nil {
+						h.recordConn(conn)
+					}
+					return conn, err
+				},
 			}
 		}
 	}
+}
+
+// recordDial wraps a dial function to record the remote address of new connections
+func (h *HTTP) recordDial(dial func(ctx context.Context, network, address string) (net.Conn, error)) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := dial(ctx, network, address)
+		if err == nil {
+			h.recordConn(conn)
+		}
+		return conn, err
+	}
+}
 
-	buf, err := m.Pack()
+// setHeaders sets the user agent and custom headers on a request
+func (h *HTTP) setHeaders(req *http.Request) {
+	if h.UserAgent != "" {
+		log.Debugf("Setting User-Agent to %s", h.UserAgent)
+		req.Header.Set("User-Agent", h.UserAgent)
+	}
+
+	// Set custom headers if provided
+	if h.Headers != nil {
+		for name, values := range h.Headers {
+			for _, value := range values {
+				log.Debugf("Setting custom header %s: %s", name, value)
+				req.Header.Add(name, value)
+			}
+		}
+	}
+}
+
+// do sends a request, counting TLS handshakes for new connections
+func (h *HTTP) do(req *http.Request) (*http.Response, error) {
+	var handshakeStart time.Time
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		TLSHandshakeStart: func() {
+			handshakeStart = time.Now()
+		},
+		TLSHandshakeDone: func(cs tls.ConnectionState, err error) {
+			if err == nil {
+				h.connState.recordHandshake(cs, false, time.Since(handshakeStart))
+			}
+		},
+	}))
+
+	resp, err := h.conn.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("packing message: %w", err)
+		return resp, h.connState.recordError(err)
 	}
+	if resp.TLS != nil {
+		h.connState.recordTLS(h.TLSConfig, *resp.TLS)
+	}
+	return resp, nil
+}
+
+func (h *HTTP) Exchange(m *dns.Msg) (*dns.Msg, error) {
+	if h.HTTP3 && h.dialer().Proxy != nil {
+		return nil, fmt.Errorf("proxies are not supported with HTTP/3")
+	}
+	if h.JSON {
+		h.setup()
+		return h.exchangeJSON(m)
+	}
+	return exchangePacked(h, h.Server, m)
+}
 
+// ExchangeWire sends a packed query as is and returns the packed reply
+func (h *HTTP) ExchangeWire(buf []byte) ([]byte, error) {
+	if h.JSON {
+		return nil, ErrWireUnsupported
+	}
+	if h.HTTP3 && h.dialer().Proxy != nil {
+		return nil, fmt.Errorf("proxies are not supported with HTTP/3")
+	}
+	h.setup()
+	h.wire = Wire{Query: buf}
+
+	var err error
 	var queryURL string
 	var req *http.Request
 	switch h.Method {
@@ -78,23 +178,10 @@ func (h *HTTP) Exchange(m *dns.Msg) (*dns.Msg, error) {
 	}
 
 	req.Header.Set("Accept", "application/dns-message")
-	if h.UserAgent != "" {
-		log.Debugf("Setting User-Agent to %s", h.UserAgent)
-		req.Header.Set("User-Agent", h.UserAgent)
-	}
-
-	// Set custom headers if provided
-	if h.Headers != nil {
-		for name, values := range h.Headers {
-			for _, value := range values {
-				log.Debugf("Setting custom header %s: %s", name, value)
-				req.Header.Add(name, value)
-			}
-		}
-	}
+	h.setHeaders(req)
 
 	log.Debugf("[http] sending %s request to %s", h.Method, queryURL)
-	resp, err := h.conn.Do(req)
+	resp, err := h.do(req)
 	if resp != nil && resp.Body != nil {
 		defer resp.Body.Close()
 	}
@@ -111,12 +198,8 @@ func (h *HTTP) Exchange(m *dns.Msg) (*dns.Msg, error) {
 		return nil, fmt.Errorf("got status code %d from %s", resp.StatusCode, queryURL)
 	}
 
-	var response dns.Msg
-	if err := response.Unpack(body); err != nil {
-		return nil, fmt.Errorf("unpacking DNS response from %s: %w", queryURL, err)
-	}
-
-	return &response, nil
+	h.wire.Reply = body
+	return body, nil
 }
 
 func (h *HTTP) Close() error {
@@ -0,0 +1,191 @@
+package transport
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/miekg/dns"
+)
+
+const JSONContentType = "application/dns-json"
+
+// jsonMessage is a DNS message in the Google/Cloudflare DoH JSON format
+type jsonMessage struct {
+	Status     int            `json:"Status"`
+	TC         bool           `json:"TC"`
+	RD         bool           `json:"RD"`
+	RA         bool           `json:"RA"`
+	AD         bool           `json:"AD"`
+	CD         bool           `json:"CD"`
+	Question   []jsonQuestion `json:"Question"`
+	Answer     []jsonRR       `json:"Answer"`
+	Authority  []jsonRR       `json:"Authority"`
+	Additional []jsonRR       `json:"Additional"`
+	Comment    any            `json:"Comment"`
+}
+
+type jsonQuestion struct {
+	Name string `json:"name"`
+	Type uint16 `json:"type"`
+}
+
+type jsonRR struct {
+	Name string `json:"name"`
+	Type uint16 `json:"type"`
+	TTL  uint32 `json:"TTL"`
+	Data string `json:"data"`
+}
+
+// jsonQueryURL builds a JSON API query URL from a DNS message
+func jsonQueryURL(server string, m *dns.Msg) (string, error) {
+	if len(m.Question) != 1 {
+		return "", fmt.Errorf("JSON API requires exactly one question, got %d", len(m.Question))
+	}
+
+	u, err := url.Parse(server)
+	if err != nil {
+		return "", fmt.Errorf("parsing server URL %s: %w", server, err)
+	}
+
+	q := u.Query()
+	q.Set("name", m.Question[0].Name)
+	q.Set("type", strconv.Itoa(int(m.Question[0].Qtype)))
+	if m.CheckingDisabled {
+		q.Set("cd", "1")
+	}
+	if opt := m.IsEdns0(); opt != nil {
+		if opt.Do() {
+			q.Set("do", "1")
+		}
+		for _, o := range opt.Option {
+			if subnet, ok := o.(*dns.EDNS0_SUBNET); ok {
+				q.Set("edns_client_subnet", fmt.Sprintf("%s/%d", subnet.Address, subnet.SourceNetmask))
+			}
+		}
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// toRR converts a JSON record into a dns.RR, keeping records that don't parse as RFC 3597 opaque rdata so a single
+// unknown or malformed record doesn't fail the whole reply
+func (r jsonRR) toRR() dns.RR {
+	rrType, ok := dns.TypeToString[r.Type]
+	if !ok {
+		rrType = fmt.Sprintf("TYPE%d", r.Type)
+	}
+
+	data := r.Data
+	if r.Type == dns.TypeTXT && !strings.HasPrefix(data, `"`) {
+		// Some servers return unquoted TXT data
+		data = strconv.Quote(data)
+	}
+
+	rr, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", dns.Fqdn(r.Name), r.TTL, rrType, data))
+	if err != nil {
+		log.Debugf("[http] Parsing %s record %s: %s, keeping it as unknown rdata", rrType, r.Data, err)
+		return &dns.RFC3597{
+			Hdr: dns.RR_Header{
+				Name:   dns.Fqdn(r.Name),
+				Rrtype: r.Type,
+				Class:  dns.ClassINET,
+				Ttl:    r.TTL,
+			},
+			Rdata: hex.EncodeToString([]byte(r.Data)),
+		}
+	}
+	return rr
+}
+
+// toRRs converts a slice of JSON records into dns.RRs
+func toRRs(records []jsonRR) []dns.RR {
+	var rrs []dns.RR
+	for _, r := range records {
+		rrs = append(rrs, r.toRR())
+	}
+	return rrs
+}
+
+// toMsg converts a JSON message into a reply to query m
+func (j *jsonMessage) toMsg(m *dns.Msg) *dns.Msg {
+	reply := new(dns.Msg)
+	reply.SetReply(m)
+	reply.Rcode = j.Status
+	reply.Truncated = j.TC
+	reply.RecursionDesired = j.RD
+	reply.RecursionAvailable = j.RA
+	reply.AuthenticatedData = j.AD
+	reply.CheckingDisabled = j.CD
+
+	if len(j.Question) > 0 {
+		reply.Question = nil
+		for _, q := range j.Question {
+			reply.Question = append(reply.Question, dns.Question{
+				Name:   dns.Fqdn(q.Name),
+				Qtype:  q.Type,
+				Qclass: dns.ClassINET,
+			})
+		}
+	}
+
+	reply.Answer = toRRs(j.Answer)
+	reply.Ns = toRRs(j.Authority)
+	reply.Extra = toRRs(j.Additional)
+
+	return reply
+}
+
+// exchangeJSON makes a DNS query with the DoH JSON API
+func (h *HTTP) exchangeJSON(m *dns.Msg) (*dns.Msg, error) {
+	if h.Method != http.MethodGet {
+		return nil, fmt.Errorf("the JSON API only supports GET requests, not %s", h.Method)
+	}
+
+	queryURL, err := jsonQueryURL(h.Server, m)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, queryURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating http request to %s: %w", queryURL, err)
+	}
+	req.Header.Set("Accept", JSONContentType)
+	h.setHeaders(req)
+
+	log.Debugf("[http] sending JSON API request to %s", queryURL)
+	resp, err := h.do(req)
+	if resp != nil && resp.Body != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("requesting %s: %w", queryURL, err)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", queryURL, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("got status code %d from %s", resp.StatusCode, queryURL)
+	}
+
+	var j jsonMessage
+	if err := json.Unmarshal(body, &j); err != nil {
+		return nil, fmt.Errorf("decoding JSON response from %s: %w", queryURL, err)
+	}
+	if j.Comment != nil {
+		log.Debugf("[http] JSON API comment: %v", j.Comment)
+	}
+
+	return j.toMsg(m), nil
+}
@@ -1,7 +1,10 @@
 package transport
 
 import (
+	"crypto/tls"
+	"encoding/base64"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -88,3 +91,64 @@ func TestTransportHTTPIDMismatch(t *testing.T) {
 	assert.Equal(t, uint16(1), reply.Id)
 	assert.NotEqual(t, 1, query.Id)
 }
+
+func TestTransportHTTPJSON(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, JSONContentType, r.Header.Get("Accept"))
+		assert.Equal(t, "example.com.", r.URL.Query().Get("name"))
+		assert.Equal(t, "1", r.URL.Query().Get("type"))
+		assert.Equal(t, "1", r.URL.Query().Get("do"))
+		w.Header().Set("Content-Type", JSONContentType)
+		_, _ = w.Write([]byte(`{"Status":0,"TC":false,"RD":true,"RA":true,"AD":true,"CD":false,
+			"Question":[{"name":"example.com.","type":1}],
+			"Answer":[{"name":"example.com.","type":1,"TTL":300,"data":"192.0.2.1"},
+				{"name":"example.com.","type":16,"TTL":300,"data":"v=spf1 -all"},
+				{"name":"example.com.","type":65534,"TTL":300,"data":"not rdata"}]}`))
+	}))
+	defer server.Close()
+
+	tp := httpTransport()
+	tp.Server = server.URL + "/resolve"
+	tp.JSON = true
+	query := validQuery()
+	query.SetEdns0(1232, true)
+	reply, err := tp.Exchange(query)
+	assert.Nil(t, err)
+	assert.Equal(t, query.Id, reply.Id)
+	assert.True(t, reply.AuthenticatedData)
+	assert.Len(t, reply.Answer, 3)
+	assert.Equal(t, "192.0.2.1", reply.Answer[0].(*dns.A).A.String())
+	assert.Equal(t, []string{"v=spf1 -all"}, reply.Answer[1].(*dns.TXT).Txt)
+	assert.Equal(t, uint16(65534), reply.Answer[2].Header().Rrtype)
+	assert.Equal(t, "6e6f74207264617461", reply.Answer[2].(*dns.RFC3597).Rdata)
+
+	tp.Method = http.MethodPost
+	_, err = tp.Exchange(query)
+	assert.ErrorContains(t, err, "the JSON API only supports GET requests, not POST")
+}
+
+func TestTransportHTTPProxyConnState(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := new(dns.Msg)
+		b, err := base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		assert.Nil(t, err)
+		assert.Nil(t, query.Unpack(b))
+		reply := new(dns.Msg)
+		reply.SetReply(query)
+		buf, err := reply.Pack()
+		assert.Nil(t, err)
+		w.Header().Set("Content-Type", "application/dns-message")
+		_, _ = w.Write(buf)
+	}))
+	defer server.Close()
+
+	proxyURL := localConnectProxy(t)
+	tp := httpTransport()
+	tp.Server = server.URL + "/dns-query"
+	tp.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+	tp.Dialer = &Dialer{Proxy: proxyURL}
+	_, err := tp.Exchange(validQuery())
+	assert.Nil(t, err)
+	assert.True(t, tp.ConnState().Proxied)
+	assert.Equal(t, "proxy "+proxyURL.Host, tp.ConnState().Peer())
+}
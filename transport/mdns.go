@@ -0,0 +1,167 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/miekg/dns"
+)
+
+// mDNS class bits
+// https://datatracker.ietf.org/doc/html/rfc6762#section-18.12
+const (
+	mdnsUnicastResponse = 1 << 15 // QU bit in the question class
+	mdnsCacheFlush      = 1 << 15 // Cache flush bit in the record class
+)
+
+// MDNS makes a multicast DNS query and collects replies from every responder until the timeout. Queries are one-shot
+// and carry no known answers, so known-answer suppression (RFC 6762 section 7.1) is out of scope.
+type MDNS struct {
+	Common
+	UDPBuffer uint16
+	Timeout   time.Duration
+	Unicast   bool // Set the QU bit to request unicast responses
+
+	responses []MDNSResponse
+}
+
+// MDNSResponse is a reply from a single mDNS responder
+type MDNSResponse struct {
+	From  string
+	Reply *dns.Msg
+}
+
+// IsMulticast returns true if a server address is a multicast address
+func IsMulticast(server string) bool {
+	host, _, err := net.SplitHostPort(server)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsMulticast()
+}
+
+// Responses returns the replies collected from each responder across all exchanges
+func (t *MDNS) Responses() []MDNSResponse {
+	return t.responses
+}
+
+func (t *MDNS) Exchange(m *dns.Msg) (*dns.Msg, error) {
+	conn, err := t.dialer().listenPacket(context.Background(), "udp")
+	if err != nil {
+		return nil, fmt.Errorf("mdns listen: %w", err)
+	}
+	defer conn.Close()
+
+	query := m.Copy()
+	if t.Unicast {
+		for i := range query.Question {
+			query.Question[i].Qclass |= mdnsUnicastResponse
+		}
+	}
+	buf, err := query.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("mdns pack: %w", err)
+	}
+
+	dstAddr, err := net.ResolveUDPAddr("udp", t.Server)
+	if err != nil {
+		return nil, fmt.Errorf("mdns resolve: %w", err)
+	}
+	if err := conn.SetDeadline(time.Now().Add(t.Timeout)); err != nil {
+		return nil, fmt.Errorf("mdns set deadline: %w", err)
+	}
+	log.Debugf("Sending mDNS query to %s, listening for %s", dstAddr, t.Timeout)
+	if _, err := conn.WriteTo(buf, dstAddr); err != nil {
+		return nil, fmt.Errorf("mdns write: %w", err)
+	}
+
+	// Collect responses until the deadline
+	var responses []MDNSResponse
+	recvBuf := make([]byte, dns.MaxMsgSize)
+	for {
+		n, from, err := conn.ReadFrom(recvBuf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				break
+			}
+			return nil, fmt.Errorf("mdns read: %w", err)
+		}
+
+		reply := new(dns.Msg)
+		if err := reply.Unpack(recvBuf[:n]); err != nil {
+			log.Debugf("Ignoring invalid mDNS message from %s: %s", from, err)
+			continue
+		}
+		if !reply.Response {
+			continue
+		}
+
+		responder := from.String()
+		if udpAddr, ok := from.(*net.UDPAddr); ok {
+			responder = udpAddr.IP.String()
+		}
+		log.Debugf("Received mDNS response from %s with %d answers", responder, len(reply.Answer))
+		clearCacheFlush(reply)
+		responses = append(responses, MDNSResponse{From: responder, Reply: reply})
+	}
+
+	if len(responses) == 0 {
+		return nil, fmt.Errorf("no mDNS responses from %s within %s", t.Server, t.Timeout)
+	}
+	t.responses = append(t.responses, responses...)
+
+	return mergeResponses(m, responses), nil
+}
+
+// clearCacheFlush removes the cache flush bit from the class of each record
+func clearCacheFlush(m *dns.Msg) {
+	for _, section := range [][]dns.RR{m.Answer, m.Ns, m.Extra} {
+		for _, rr := range section {
+			if rr.Header().Rrtype != dns.TypeOPT {
+				rr.Header().Class &^= mdnsCacheFlush
+			}
+		}
+	}
+}
+
+// mergeResponses combines responses into a single reply to m, keeping one copy of records that more than one
+// responder sent
+func mergeResponses(m *dns.Msg, responses []MDNSResponse) *dns.Msg {
+	reply := new(dns.Msg)
+	reply.SetReply(m)
+	reply.Authoritative = true
+
+	merge := func(merged []dns.RR, rrs []dns.RR) []dns.RR {
+	next:
+		for _, rr := range rrs {
+			if rr.Header().Rrtype == dns.TypeOPT {
+				continue
+			}
+			for _, existing := range merged {
+				if dns.IsDuplicate(existing, rr) {
+					continue next
+				}
+			}
+			merged = append(merged, rr)
+		}
+		return merged
+	}
+
+	for _, r := range responses {
+		reply.Answer = merge(reply.Answer, r.Reply.Answer)
+		reply.Ns = merge(reply.Ns, r.Reply.Ns)
+		reply.Extra = merge(reply.Extra, r.Reply.Extra)
+	}
+	return reply
+}
+
+// Close is a no-op for the mDNS transport
+func (t *MDNS) Close() error {
+	return nil
+}
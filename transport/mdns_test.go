@@ -0,0 +1,99 @@
+package transport
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+// localMDNSResponders starts a UDP listener that answers each query from two responder addresses
+// with one shared record and one record unique to each responder, and returns the listener address
+// and a channel of received queries
+func localMDNSResponders(t *testing.T) (string, chan *dns.Msg) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	other, err := net.ListenPacket("udp", "127.0.0.2:0")
+	if err != nil {
+		t.Skipf("127.0.0.2 not available: %s", err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+		_ = other.Close()
+	})
+
+	queries := make(chan *dns.Msg, 1)
+	go func() {
+		buf := make([]byte, dns.MaxMsgSize)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			query := new(dns.Msg)
+			if err := query.Unpack(buf[:n]); err != nil {
+				continue
+			}
+			queries <- query
+
+			for i, responder := range []net.PacketConn{conn, other} {
+				reply := new(dns.Msg)
+				reply.SetReply(query)
+				shared, _ := dns.NewRR("_printer._tcp.local. 120 IN PTR shared._printer._tcp.local.")
+				shared.Header().Class |= mdnsCacheFlush
+				unique, _ := dns.NewRR("_printer._tcp.local. 120 IN PTR printer" + string(rune('a'+i)) + "._printer._tcp.local.")
+				reply.Answer = []dns.RR{shared, unique}
+				out, _ := reply.Pack()
+				_, _ = responder.WriteTo(out, from)
+			}
+		}
+	}()
+	return conn.LocalAddr().String(), queries
+}
+
+func TestTransportMDNS(t *testing.T) {
+	server, queries := localMDNSResponders(t)
+	tp := &MDNS{
+		Common:    Common{Server: server},
+		UDPBuffer: 1232,
+		Timeout:   500 * time.Millisecond,
+		Unicast:   true,
+	}
+
+	query := new(dns.Msg)
+	query.SetQuestion("_printer._tcp.local.", dns.TypePTR)
+	reply, err := tp.Exchange(query)
+	assert.Nil(t, err)
+
+	// QU bit is set on the wire but not on the caller's query
+	assert.Equal(t, uint16(dns.ClassINET|mdnsUnicastResponse), (<-queries).Question[0].Qclass)
+	assert.Equal(t, uint16(dns.ClassINET), query.Question[0].Qclass)
+
+	var responders []string
+	for _, r := range tp.Responses() {
+		responders = append(responders, r.From)
+	}
+	assert.ElementsMatch(t, []string{"127.0.0.1", "127.0.0.2"}, responders)
+
+	// The shared record is merged, and cache flush bits are cleared
+	assert.Equal(t, query.Id, reply.Id)
+	assert.Len(t, reply.Answer, 3)
+	for _, rr := range reply.Answer {
+		assert.Equal(t, uint16(dns.ClassINET), rr.Header().Class)
+	}
+}
+
+func TestTransportMDNSNoResponses(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	tp := &MDNS{
+		Common:  Common{Server: conn.LocalAddr().String()},
+		Timeout: 100 * time.Millisecond,
+	}
+	_, err = tp.Exchange(validQuery())
+	assert.ErrorContains(t, err, "no mDNS responses")
+}
@@ -80,9 +80,12 @@ func (o *ODoH) Exchange(m *dns.Msg) (*dns.Msg, error) {
 	}
 
 	if o.conn == nil || !o.ReuseConn {
+		dialer := o.dialer()
 		o.conn = &http.Client{
 			Transport: &http.Transport{
 				TLSClientConfig: o.TLSConfig,
+				Proxy:           dialer.httpProxy(),
+				DialContext:     dialer.httpDialContext(),
 			},
 		}
 	}
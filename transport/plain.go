@@ -1,8 +1,8 @@
 package transport
 
 import (
+	"context"
 	"fmt"
-	"net"
 	"time"
 
 	"github.com/charmbracelet/log"
@@ -19,59 +19,16 @@ type Plain struct {
 }
 
 func (p *Plain) Exchange(m *dns.Msg) (*dns.Msg, error) {
-	host, _, err := net.SplitHostPort(p.Server)
-	if err == nil {
-		ip := net.ParseIP(host)
-		if ip != nil && ip.IsMulticast() {
-			log.Debugf("Detected multicast server %s, using relaxed mDNS exchange logic", p.Server)
-
-			conn, err := net.ListenPacket("udp", ":0")
-			if err != nil {
-				return nil, fmt.Errorf("mdns listen: %w", err)
-			}
-			defer conn.Close()
-
-			if err := conn.SetDeadline(time.Now().Add(p.Timeout)); err != nil {
-				return nil, fmt.Errorf("mdns set deadline: %w", err)
-			}
-
-			buf, err := m.Pack()
-			if err != nil {
-				return nil, fmt.Errorf("mdns pack: %w", err)
-			}
-
-			dstAddr, err := net.ResolveUDPAddr("udp", p.Server)
-			if err != nil {
-				return nil, fmt.Errorf("mdns resolve: %w", err)
-			}
-			if _, err := conn.WriteTo(buf, dstAddr); err != nil {
-				return nil, fmt.Errorf("mdns write: %w", err)
-			}
-
-			recvBuf := make([]byte, p.UDPBuffer)
-			n, _, err := conn.ReadFrom(recvBuf)
-			if err != nil {
-				return nil, fmt.Errorf("mdns read: %w", err)
-			}
-
-			reply := new(dns.Msg)
-			if err := reply.Unpack(recvBuf[:n]); err != nil {
-				return nil, fmt.Errorf("mdns unpack: %w", err)
-			}
-
-			return reply, nil
-		}
-	}
-
-	tcpClient := dns.Client{Net: "tcp", Timeout: p.Timeout}
-	if p.PreferTCP {
-		reply, _, tcpErr := tcpClient.Exchange(m, p.Server)
-		return reply, tcpErr
+	if IsMulticast(p.Server) {
+		log.Debugf("Detected multicast server %s, using mDNS exchange logic", p.Server)
+		mdns := &MDNS{Common: p.Common, UDPBuffer: p.UDPBuffer, Timeout: p.Timeout}
+		return mdns.Exchange(m)
 	}
 
 	// Ensure an EDNS0 OPT record is present (if enabled) and advertises our UDP buffer size
 	// so large UDP responses are either sized appropriately or marked truncated, allowing TCP retry.
-	if p.EDNS {
+	// UDP can't be proxied, so TCP is always used through a proxy.
+	if p.EDNS && !p.PreferTCP && p.dialer().Proxy == nil {
 		if opt := m.IsEdns0(); opt == nil {
 			m.Extra = append(m.Extra, &dns.OPT{
 				Hdr: dns.RR_Header{
@@ -85,15 +42,68 @@ func (p *Plain) Exchange(m *dns.Msg) (*dns.Msg, error) {
 		}
 	}
 
-	client := dns.Client{UDPSize: p.UDPBuffer, Timeout: p.Timeout}
-	reply, _, err := client.Exchange(m, p.Server)
+	return exchangePacked(p, p.Server, m)
+}
 
-	if reply != nil && reply.Truncated {
-		log.Debugf("Truncated reply from %s for %s over UDP, retrying over TCP", p.Server, m.Question[0].String())
-		reply, _, err = tcpClient.Exchange(m, p.Server)
+// ExchangeWire sends a packed query as is over UDP (with TCP fallback) or TCP and returns the packed reply
+func (p *Plain) ExchangeWire(query []byte) ([]byte, error) {
+	if IsMulticast(p.Server) {
+		return nil, ErrWireUnsupported
 	}
+	p.wire = Wire{Query: query}
 
-	return reply, err
+	// UDP can't be proxied, so always use TCP through a proxy
+	network := "udp"
+	if p.PreferTCP || p.dialer().Proxy != nil {
+		network = "tcp"
+	}
+	reply, err := p.exchangeConn(query, network)
+	if network == "udp" && err == nil && len(reply) > 2 && reply[2]&0x02 != 0 {
+		log.Debugf("Truncated reply from %s over UDP, retrying over TCP", p.Server)
+		reply, err = p.exchangeConn(query, "tcp")
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.wire.Reply = reply
+	return reply, nil
+}
+
+// exchangeConn sends a packed query over a new TCP or UDP connection and returns the packed reply
+func (p *Plain) exchangeConn(query []byte, network string) ([]byte, error) {
+	ctx := context.Background()
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+
+	conn, err := p.dialer().DialContext(ctx, network, p.Server)
+	if err != nil {
+		return nil, err
+	}
+	p.recordConn(conn)
+	co := &dns.Conn{Conn: conn}
+	defer co.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if _, err := co.Write(query); err != nil {
+		return nil, fmt.Errorf("writing query to %s: %w", p.Server, err)
+	}
+	buf := make([]byte, dns.MaxMsgSize)
+	for {
+		n, err := co.Read(buf)
+		if err != nil {
+			return nil, fmt.Errorf("reading reply from %s: %w", p.Server, err)
+		}
+		// Ignore UDP replies with other IDs, which may be late replies to earlier queries
+		if network == "tcp" || n < 2 || len(query) < 2 || (buf[0] == query[0] && buf[1] == query[1]) {
+			return buf[:n], nil
+		}
+		log.Debugf("Ignoring reply from %s with mismatched ID", p.Server)
+	}
 }
 
 // Close is a no-op for the plain transport
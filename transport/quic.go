@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"time"
 
 	"github.com/charmbracelet/log"
 	"github.com/miekg/dns"
@@ -31,8 +32,13 @@ type QUIC struct {
 	TLSConfig       *tls.Config
 	PMTUD           bool
 	AddLengthPrefix bool
+	ZeroRTT         bool // Send queries as 0-RTT data when resuming a session
 
 	conn *quic.Conn
+
+	// handshakeTime receives the time from dialing the current connection until its handshake completes, which is
+	// after the dial returns when sending 0-RTT data, or is nil once the handshake has been recorded
+	handshakeTime chan time.Duration
 }
 
 func (q *QUIC) connection() *quic.Conn {
@@ -49,6 +55,33 @@ func (q *QUIC) setServerName() {
 }
 
 func (q *QUIC) Exchange(msg *dns.Msg) (*dns.Msg, error) {
+	// Clients and servers MUST NOT send the edns-tcp-keepalive EDNS(0) Option [RFC7828] in any messages sent
+	// on a DoQ connection (because it is specific to the use of TCP/TLS as a transport).
+	// https://datatracker.ietf.org/doc/html/rfc9250#section-5.5.2
+	if opt := msg.IsEdns0(); opt != nil {
+		for _, option := range opt.Option {
+			if option.Option() == dns.EDNS0TCPKEEPALIVE {
+				if q.conn != nil {
+					_ = q.conn.CloseWithError(DoQProtocolError, "") // Already closing the connection, so we don't care about the error
+					q.conn = nil
+				}
+				return nil, fmt.Errorf("EDNS0 TCP keepalive option is set")
+			}
+		}
+	}
+
+	// When sending queries over a QUIC connection, the DNS Message ID MUST
+	// be set to zero. The stream mapping for DoQ allows for unambiguous
+	// correlation of queries and responses and so the Message ID field is
+	// not required.
+	// https://datatracker.ietf.org/doc/html/rfc9250#section-4.2.1
+	msg.Id = 0
+	return exchangePacked(q, q.Server, msg)
+}
+
+// ExchangeWire sends a packed query as is on a new stream and returns the packed reply
+func (q *QUIC) ExchangeWire(buf []byte) ([]byte, error) {
+	q.wire = Wire{Query: buf}
 	if q.conn == nil || !q.ReuseConn {
 		log.Debugf("Connecting to %s", q.Server)
 		q.setServerName()
@@ -57,31 +90,36 @@ func (q *QUIC) Exchange(msg *dns.Msg) (*dns.Msg, error) {
 			q.TLSConfig.NextProtos = []string{"doq"}
 		}
 		log.Debugf("Dialing with QUIC ALPN tokens: %v", q.TLSConfig.NextProtos)
-		conn, err := quic.DialAddr(
+		if q.conn != nil {
+			_ = q.conn.CloseWithError(DoQNoError, "")
+		}
+		if q.ZeroRTT {
+			log.Debug("Using 0-RTT if a session can be resumed")
+		}
+		start := time.Now()
+		conn, err := q.dialer().dialQUIC(
 			context.Background(),
 			q.Server,
 			q.TLSConfig,
 			&quic.Config{
 				DisablePathMTUDiscovery: !q.PMTUD,
 			},
+			q.ZeroRTT,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("opening quic session to %s: %v", q.Server, err)
+			return nil, fmt.Errorf("opening quic session to %s: %w", q.Server, q.connState.recordError(err))
 		}
 		q.conn = conn
-	}
-
-	// Clients and servers MUST NOT send the edns-tcp-keepalive EDNS(0) Option [RFC7828] in any messages sent
-	// on a DoQ connection (because it is specific to the use of TCP/TLS as a transport).
-	// https://datatracker.ietf.org/doc/html/rfc9250#section-5.5.2
-	if opt := msg.IsEdns0(); opt != nil {
-		for _, option := range opt.Option {
-			if option.Option() == dns.EDNS0TCPKEEPALIVE {
-				_ = q.connection().CloseWithError(DoQProtocolError, "") // Already closing the connection, so we don't care about the error
-				q.conn = nil
-				return nil, fmt.Errorf("EDNS0 TCP keepalive option is set")
+		q.recordConn(conn)
+		handshakeTime := make(chan time.Duration, 1)
+		go func() {
+			select {
+			case <-conn.HandshakeComplete():
+			case <-conn.Context().Done():
 			}
-		}
+			handshakeTime <- time.Since(start)
+		}()
+		q.handshakeTime = handshakeTime
 	}
 
 	stream, err := q.connection().OpenStream()
@@ -89,17 +127,6 @@ func (q *QUIC) Exchange(msg *dns.Msg) (*dns.Msg, error) {
 		return nil, fmt.Errorf("open new stream to %s: %v", q.Server, err)
 	}
 
-	// When sending queries over a QUIC connection, the DNS Message ID MUST
-	// be set to zero. The stream mapping for DoQ allows for unambiguous
-	// correlation of queries and responses and so the Message ID field is
-	// not required.
-	// https://datatracker.ietf.org/doc/html/rfc9250#section-4.2.1
-	msg.Id = 0
-	buf, err := msg.Pack()
-	if err != nil {
-		return nil, err
-	}
-
 	if q.AddLengthPrefix {
 		// All DNS messages (queries and responses) sent over DoQ connections
 		// MUST be encoded as a 2-octet length field followed by the message
@@ -127,17 +154,24 @@ func (q *QUIC) Exchange(msg *dns.Msg) (*dns.Msg, error) {
 		return nil, fmt.Errorf("empty response from %s", q.Server)
 	}
 
-	reply := dns.Msg{}
 	if q.AddLengthPrefix {
-		err = reply.Unpack(respBuf[2:])
-	} else {
-		err = reply.Unpack(respBuf)
+		if len(respBuf) < 2 {
+			return nil, fmt.Errorf("short response from %s", q.Server)
+		}
+		respBuf = respBuf[2:]
 	}
-	if err != nil {
-		return nil, fmt.Errorf("unpacking response from %s: %s", q.Server, err)
+
+	// The handshake is complete once a response has been read, even if the query was sent as 0-RTT data
+	if q.handshakeTime != nil {
+		<-q.conn.HandshakeComplete()
+		cs := q.conn.ConnectionState()
+		q.connState.recordHandshake(cs.TLS, cs.Used0RTT, <-q.handshakeTime)
+		q.connState.recordTLS(q.TLSConfig, cs.TLS)
+		q.handshakeTime = nil
 	}
 
-	return &reply, nil
+	q.wire.Reply = respBuf
+	return respBuf, nil
 }
 
 // addPrefix adds a 2-byte prefix with the DNS message length.
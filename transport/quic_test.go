@@ -1,6 +1,18 @@
 package transport
 
-import "crypto/tls"
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+	"github.com/stretchr/testify/assert"
+)
 
 func quicTransport() *QUIC {
 	return &QUIC{
@@ -10,3 +22,120 @@ func quicTransport() *QUIC {
 		TLSConfig:       &tls.Config{NextProtos: []string{"doq"}},
 	}
 }
+
+// localQUICServer starts a DoQ server on a random local port that accepts 0-RTT data and answers every query with an
+// empty reply
+func localQUICServer(t *testing.T) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	listener, err := quic.ListenEarly(pc, &tls.Config{
+		Certificates: []tls.Certificate{selfSignedCert(t)},
+		NextProtos:   []string{"doq"},
+	}, &quic.Config{Allow0RTT: true})
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		_ = listener.Close()
+		_ = pc.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			go func() {
+				for {
+					stream, err := conn.AcceptStream(context.Background())
+					if err != nil {
+						return
+					}
+					b, err := io.ReadAll(stream)
+					query := new(dns.Msg)
+					if err != nil || len(b) < 2 || query.Unpack(b[2:]) != nil {
+						stream.CancelWrite(0)
+						continue
+					}
+					reply := new(dns.Msg)
+					reply.SetReply(query)
+					buf, _ := reply.Pack()
+					_, _ = stream.Write(addPrefix(buf))
+					_ = stream.Close()
+				}
+			}()
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+// delayRelay forwards UDP packets between a single client and server, delaying each by d
+func delayRelay(t *testing.T, server string, d time.Duration) string {
+	serverAddr, err := net.ResolveUDPAddr("udp", server)
+	assert.Nil(t, err)
+	clientSide, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	serverSide, err := net.DialUDP("udp", nil, serverAddr)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		_ = clientSide.Close()
+		_ = serverSide.Close()
+	})
+
+	var mu sync.Mutex
+	var client net.Addr
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := clientSide.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			client = addr
+			mu.Unlock()
+			b := append([]byte(nil), buf[:n]...)
+			time.AfterFunc(d, func() { _, _ = serverSide.Write(b) })
+		}
+	}()
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, err := serverSide.Read(buf)
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			addr := client
+			mu.Unlock()
+			b := append([]byte(nil), buf[:n]...)
+			time.AfterFunc(d, func() { _, _ = clientSide.WriteTo(b, addr) })
+		}
+	}()
+	return clientSide.LocalAddr().String()
+}
+
+func TestTransportQUIC0RTTHandshakeTime(t *testing.T) {
+	delay := 25 * time.Millisecond
+	tp := &QUIC{
+		Common:          Common{Server: delayRelay(t, localQUICServer(t), delay)},
+		AddLengthPrefix: true,
+		ZeroRTT:         true,
+		TLSConfig: &tls.Config{
+			InsecureSkipVerify: true,
+			NextProtos:         []string{"doq"},
+			ClientSessionCache: tls.NewLRUClientSessionCache(8),
+		},
+	}
+	defer tp.Close()
+
+	for i := 0; i < 2; i++ {
+		_, err := tp.Exchange(validQuery())
+		assert.Nil(t, err)
+	}
+
+	// The resumed handshake still takes a round trip to complete, even though the query didn't wait for it
+	state := tp.ConnState()
+	assert.Equal(t, 1, state.FullHandshakes)
+	assert.Equal(t, 1, state.ZeroRTTHandshakes)
+	assert.GreaterOrEqual(t, state.ResumedHandshakeTime, 2*delay)
+}
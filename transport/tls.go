@@ -1,9 +1,11 @@
 package transport
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"net"
+	"time"
 
 	"github.com/miekg/dns"
 )
@@ -15,29 +17,72 @@ type TLS struct {
 	conn      *tls.Conn
 }
 
+// config returns the TLS config for the connection, setting the server name from the server address if unset
+func (t *TLS) config() *tls.Config {
+	config := t.TLSConfig
+	if config == nil {
+		config = &tls.Config{}
+	}
+	if config.ServerName == "" {
+		config = config.Clone()
+		host, _, err := net.SplitHostPort(t.Server)
+		if err != nil {
+			host = t.Server
+		}
+		config.ServerName = host
+	}
+	return config
+}
+
 func (t *TLS) Exchange(msg *dns.Msg) (*dns.Msg, error) {
+	return exchangePacked(t, t.Server, msg)
+}
+
+// ExchangeWire sends a packed query as is and returns the packed reply
+func (t *TLS) ExchangeWire(query []byte) ([]byte, error) {
+	t.wire = Wire{Query: query}
 	if t.conn == nil || !t.ReuseConn {
-		var err error
-		t.conn, err = tls.DialWithDialer(
-			&net.Dialer{},
-			"tcp",
-			t.Server,
-			t.TLSConfig,
-		)
+		if t.conn != nil {
+			_ = t.conn.Close()
+			t.conn = nil
+		}
+		conn, err := t.dialer().DialContext(context.Background(), "tcp", t.Server)
 		if err != nil {
 			return nil, err
 		}
-		if err = t.conn.Handshake(); err != nil {
-			return nil, err
+		t.recordConn(conn)
+
+		tlsConn := tls.Client(conn, t.config())
+		start := time.Now()
+		if err = tlsConn.Handshake(); err != nil {
+			_ = conn.Close()
+			return nil, t.connState.recordError(err)
 		}
+		t.connState.recordHandshake(tlsConn.ConnectionState(), false, time.Since(start))
+		t.connState.recordTLS(t.TLSConfig, tlsConn.ConnectionState())
+		t.conn = tlsConn
 	}
 
+	// A failed connection is dropped so the next query reconnects
 	c := dns.Conn{Conn: t.conn}
-	if err := c.WriteMsg(msg); err != nil {
+	if _, err := c.Write(query); err != nil {
+		t.dropConn()
 		return nil, fmt.Errorf("write msg to %s: %v", t.Server, err)
 	}
+	buf := make([]byte, dns.MaxMsgSize)
+	n, err := c.Read(buf)
+	if err != nil {
+		t.dropConn()
+		return nil, err
+	}
+	t.wire.Reply = buf[:n]
+	return t.wire.Reply, nil
+}
 
-	return c.ReadMsg()
+// dropConn closes the connection and clears it
+func (t *TLS) dropConn() {
+	_ = t.conn.Close()
+	t.conn = nil
 }
 
 // Close closes the TLS connection
@@ -1,5 +1,24 @@
 package transport
 
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	tlsutil "github.com/natesales/q/util/tls"
+)
+
 func tlsTransport() *TLS {
 	return &TLS{
 		Common: Common{
@@ -8,3 +27,96 @@ func tlsTransport() *TLS {
 		},
 	}
 }
+
+// selfSignedCert creates a self-signed certificate for localhost
+func selfSignedCert(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// localTLSServer starts a DoT server on a random local port that answers every query with an empty reply
+func localTLSServer(t *testing.T) string {
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{selfSignedCert(t)}})
+	assert.Nil(t, err)
+	server := &dns.Server{Listener: listener, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		_ = w.WriteMsg(m)
+	})}
+	go func() { _ = server.ActivateAndServe() }()
+	t.Cleanup(func() { _ = server.Shutdown() })
+	return listener.Addr().String()
+}
+
+func TestTransportTLSSessionResumption(t *testing.T) {
+	tp := &TLS{
+		Common: Common{Server: localTLSServer(t)},
+		TLSConfig: &tls.Config{
+			InsecureSkipVerify: true,
+			ClientSessionCache: tls.NewLRUClientSessionCache(8),
+		},
+	}
+	defer tp.Close()
+
+	for i := 0; i < 3; i++ {
+		_, err := tp.Exchange(validQuery())
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, 1, tp.ConnState().FullHandshakes)
+	assert.Equal(t, 2, tp.ConnState().ResumedHandshakes)
+}
+
+func TestTransportTLSSessionFile(t *testing.T) {
+	server := localTLSServer(t)
+	sessionFile := filepath.Join(t.TempDir(), "sessions.json")
+
+	// Each transport loads its own cache from the session file, like separate runs of q
+	for _, expectResumed := range []bool{false, true} {
+		tp := &TLS{
+			Common: Common{Server: server},
+			TLSConfig: &tls.Config{
+				InsecureSkipVerify: true,
+				ClientSessionCache: tlsutil.NewSessionCache(sessionFile),
+			},
+		}
+		_, err := tp.Exchange(validQuery())
+		assert.Nil(t, err)
+		assert.Nil(t, tp.Close())
+		assert.Equal(t, expectResumed, tp.ConnState().ResumedHandshakes == 1)
+	}
+}
+
+func TestTransportTLSReconnectAfterFailure(t *testing.T) {
+	tp := &TLS{
+		Common:    Common{Server: localTLSServer(t), ReuseConn: true},
+		TLSConfig: &tls.Config{ServerName: "localhost"},
+	}
+
+	// A failed handshake doesn't leave a connection to reuse
+	_, err := tp.Exchange(validQuery())
+	assert.NotNil(t, err)
+	assert.Nil(t, tp.conn)
+
+	tp.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+	_, err = tp.Exchange(validQuery())
+	assert.Nil(t, err)
+
+	// A broken connection is dropped, so the next query reconnects
+	_ = tp.conn.Close()
+	_, err = tp.Exchange(validQuery())
+	assert.NotNil(t, err)
+	assert.Nil(t, tp.conn)
+	_, err = tp.Exchange(validQuery())
+	assert.Nil(t, err)
+}
@@ -1,17 +1,46 @@
 package transport
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/miekg/dns"
 )
 
 type Transport interface {
 	Exchange(*dns.Msg) (*dns.Msg, error)
 	Close() error
+	ConnState() *ConnState
+}
+
+// WireTransport is implemented by transports that can send a packed message as is
+type WireTransport interface {
+	// ExchangeWire sends a packed query without modifying it and returns the packed reply
+	ExchangeWire(query []byte) ([]byte, error)
+}
+
+// ErrWireUnsupported is returned by ExchangeWire when a transport can't send a message as is
+var ErrWireUnsupported = errors.New("transport can't send a message as is")
+
+// Wire is the packed form of a query and its reply as sent and received
+type Wire struct {
+	Query []byte
+	Reply []byte
 }
 
 type Common struct {
 	Server    string
 	ReuseConn bool
+	Dialer    *Dialer
+
+	connState ConnState
+	wire      Wire
+}
+
+// LastWire returns the packed query and reply of the last exchange, or an empty Wire if the transport doesn't
+// send plain DNS messages
+func (c *Common) LastWire() Wire {
+	return c.wire
 }
 
 type Type string
@@ -28,6 +57,23 @@ const (
 // Types is a list of all supported transports
 var Types = []Type{TypePlain, TypeTCP, TypeTLS, TypeHTTP, TypeQUIC, TypeDNSCrypt}
 
+// exchangePacked packs a query, sends it with a transport's ExchangeWire and unpacks the reply
+func exchangePacked(t WireTransport, server string, m *dns.Msg) (*dns.Msg, error) {
+	query, err := m.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("packing message: %w", err)
+	}
+	buf, err := t.ExchangeWire(query)
+	if err != nil {
+		return nil, err
+	}
+	reply := new(dns.Msg)
+	if err := reply.Unpack(buf); err != nil {
+		return nil, fmt.Errorf("unpacking reply from %s: %w", server, err)
+	}
+	return reply, nil
+}
+
 // Interface guards
 var (
 	_ Transport = (*Plain)(nil)
@@ -36,4 +82,9 @@ var (
 	_ Transport = (*ODoH)(nil)
 	_ Transport = (*QUIC)(nil)
 	_ Transport = (*DNSCrypt)(nil)
+
+	_ WireTransport = (*Plain)(nil)
+	_ WireTransport = (*TLS)(nil)
+	_ WireTransport = (*HTTP)(nil)
+	_ WireTransport = (*QUIC)(nil)
 )
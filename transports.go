@@ -0,0 +1,100 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"sync"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/natesales/q/transport"
+)
+
+// Transport cache, which keeps transports open between queries at the interactive prompt
+var (
+	transportsMu     sync.Mutex                      // guards the cache, which query goroutines outliving a timeout still use
+	cachedTransports map[string]*transport.Transport // open transports by server, type and flags, or nil if not caching
+	transportsInUse  map[*transport.Transport]bool   // transports opened by a query and not closed yet
+	transportFlags   string                          // flags of the current query, so transports aren't shared across different settings
+)
+
+// startTransportCache keeps transports open between queries until stopTransportCache is called
+func startTransportCache() {
+	transportsMu.Lock()
+	defer transportsMu.Unlock()
+	cachedTransports = make(map[string]*transport.Transport)
+	transportsInUse = make(map[*transport.Transport]bool)
+}
+
+// stopTransportCache closes the cached transports and stops caching new ones
+func stopTransportCache() {
+	transportsMu.Lock()
+	defer transportsMu.Unlock()
+	for key, txp := range cachedTransports {
+		if err := (*txp).Close(); err != nil {
+			log.Debugf("Closing transport %s: %s", key, err)
+		}
+	}
+	cachedTransports = nil
+	transportsInUse = nil
+}
+
+// openTransport creates a transport, or returns one left open by an earlier query while the cache is running
+func openTransport(server string, transportType transport.Type, tlsConfig *tls.Config) (*transport.Transport, error) {
+	key := fmt.Sprintf("%s %s %s", transportType, server, transportFlags)
+	transportsMu.Lock()
+	caching := cachedTransports != nil
+	txp, ok := cachedTransports[key]
+	if ok {
+		transportsInUse[txp] = true
+	}
+	transportsMu.Unlock()
+	if !caching {
+		return newTransport(server, transportType, tlsConfig)
+	}
+	if ok {
+		log.Debugf("Reusing open transport for %s", server)
+		return txp, nil
+	}
+
+	txp, err := newTransport(server, transportType, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	transportsMu.Lock()
+	defer transportsMu.Unlock()
+	if cachedTransports != nil {
+		cachedTransports[key] = txp
+		transportsInUse[txp] = true
+	}
+	return txp, nil
+}
+
+// closeTransport closes a transport unless the cache keeps it open for later queries.
+// Transports that failed are always closed so the next query starts over.
+func closeTransport(txp *transport.Transport, failed bool) error {
+	transportsMu.Lock()
+	defer transportsMu.Unlock()
+	delete(transportsInUse, txp)
+	for key, open := range cachedTransports {
+		if open == txp {
+			if !failed {
+				return nil
+			}
+			delete(cachedTransports, key)
+		}
+	}
+	return (*txp).Close()
+}
+
+// abandonTransports removes the transports still in use from the cache after a query times out, so the next query
+// doesn't share a connection with the query's goroutine. The goroutine closes them when it finishes.
+func abandonTransports() {
+	transportsMu.Lock()
+	defer transportsMu.Unlock()
+	for key, txp := range cachedTransports {
+		if transportsInUse[txp] {
+			delete(cachedTransports, key)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+// Package dnstap reads and writes DNS messages as dnstap protobuf frames in a Frame Streams container
+// https://dnstap.info
+package dnstap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ContentType is the Frame Streams content type of dnstap data frames
+const ContentType = "protobuf:dnstap.Dnstap"
+
+// MessageType is the dnstap Message.Type enum
+type MessageType uint32
+
+const (
+	MessageAuthQuery         MessageType = 1
+	MessageAuthResponse      MessageType = 2
+	MessageResolverQuery     MessageType = 3
+	MessageResolverResponse  MessageType = 4
+	MessageClientQuery       MessageType = 5
+	MessageClientResponse    MessageType = 6
+	MessageForwarderQuery    MessageType = 7
+	MessageForwarderResponse MessageType = 8
+	MessageStubQuery         MessageType = 9
+	MessageStubResponse      MessageType = 10
+	MessageToolQuery         MessageType = 11
+	MessageToolResponse      MessageType = 12
+	MessageUpdateQuery       MessageType = 13
+	MessageUpdateResponse    MessageType = 14
+)
+
+// IsResponse returns true if the message type is a response type
+func (t MessageType) IsResponse() bool {
+	return t%2 == 0
+}
+
+// SocketFamily is the dnstap SocketFamily enum
+type SocketFamily uint32
+
+const (
+	FamilyINET  SocketFamily = 1
+	FamilyINET6 SocketFamily = 2
+)
+
+// SocketProtocol is the dnstap SocketProtocol enum
+type SocketProtocol uint32
+
+const (
+	ProtocolUDP         SocketProtocol = 1
+	ProtocolTCP         SocketProtocol = 2
+	ProtocolDOT         SocketProtocol = 3
+	ProtocolDOH         SocketProtocol = 4
+	ProtocolDNSCryptUDP SocketProtocol = 5
+	ProtocolDNSCryptTCP SocketProtocol = 6
+	ProtocolDOQ         SocketProtocol = 7
+)
+
+// Message is a DNS message and the connection details dnstap records for it
+type Message struct {
+	Type         MessageType
+	Family       SocketFamily
+	Protocol     SocketProtocol
+	ClientIP     net.IP
+	ClientPort   uint16
+	ServerIP     net.IP
+	ServerPort   uint16
+	QueryTime    time.Time
+	ResponseTime time.Time
+	Query        []byte
+	Response     []byte
+}
+
+// Frame Streams control frame types and fields
+// https://farsightsec.github.io/fstrm/
+const (
+	controlAccept      = 0x01
+	controlStart       = 0x02
+	controlStop        = 0x03
+	controlReady       = 0x04
+	controlFinish      = 0x05
+	controlContentType = 0x01
+)
+
+// Writer writes dnstap frames to a file or a Frame Streams socket
+type Writer struct {
+	Identity string
+	Version  string
+
+	mu            sync.Mutex
+	w             *bufio.Writer
+	rw            io.ReadWriteCloser
+	bidirectional bool
+	closed        bool
+}
+
+// Open opens a dnstap writer to a file, or to a Unix socket if path starts with unix:
+func Open(path string) (*Writer, error) {
+	if socket, ok := strings.CutPrefix(path, "unix:"); ok {
+		conn, err := net.Dial("unix", socket)
+		if err != nil {
+			return nil, fmt.Errorf("connecting to dnstap socket %s: %w", socket, err)
+		}
+		w, err := newWriter(conn, true)
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		return w, nil
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("creating dnstap file %s: %w", path, err)
+	}
+	w, err := newWriter(file, false)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// NewWriter returns a unidirectional dnstap writer to w
+func NewWriter(w io.WriteCloser) (*Writer, error) {
+	return newWriter(nopReader{w}, false)
+}
+
+// newWriter starts a Frame Streams session, performing the READY/ACCEPT handshake first if bidirectional
+func newWriter(rw io.ReadWriteCloser, bidirectional bool) (*Writer, error) {
+	w := &Writer{w: bufio.NewWriter(rw), rw: rw, bidirectional: bidirectional}
+	if bidirectional {
+		if err := w.writeControl(controlReady); err != nil {
+			return nil, err
+		}
+		if err := w.readControl(controlAccept); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.writeControl(controlStart); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// writeControl writes and flushes a control frame carrying the dnstap content type
+func (w *Writer) writeControl(controlType uint32) error {
+	var frame []byte
+	frame = binary.BigEndian.AppendUint32(frame, controlType)
+	if controlType != controlStop {
+		frame = binary.BigEndian.AppendUint32(frame, controlContentType)
+		frame = binary.BigEndian.AppendUint32(frame, uint32(len(ContentType)))
+		frame = append(frame, ContentType...)
+	}
+
+	var buf []byte
+	buf = binary.BigEndian.AppendUint32(buf, 0) // escape
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(frame)))
+	buf = append(buf, frame...)
+	if _, err := w.w.Write(buf); err != nil {
+		return fmt.Errorf("writing dnstap control frame: %w", err)
+	}
+	return w.w.Flush()
+}
+
+// readControl reads a control frame and checks its type
+func (w *Writer) readControl(controlType uint32) error {
+	frameType, err := readControlFrame(w.rw)
+	if err != nil {
+		return fmt.Errorf("reading dnstap control frame: %w", err)
+	}
+	if frameType != controlType {
+		return fmt.Errorf("unexpected dnstap control frame type %d, expected %d", frameType, controlType)
+	}
+	return nil
+}
+
+// readControlFrame reads a control frame and returns its type
+func readControlFrame(r io.Reader) (uint32, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, err
+	}
+	if binary.BigEndian.Uint32(header[:4]) != 0 {
+		return 0, errors.New("expected control frame")
+	}
+	frame := make([]byte, binary.BigEndian.Uint32(header[4:]))
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return 0, err
+	}
+	if len(frame) < 4 {
+		return 0, errors.New("short control frame")
+	}
+	return binary.BigEndian.Uint32(frame[:4]), nil
+}
+
+// Write writes a message as a dnstap data frame
+func (w *Writer) Write(m *Message) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return errors.New("dnstap writer closed")
+	}
+
+	payload := m.marshal(w.Identity, w.Version)
+	var buf []byte
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(payload)))
+	buf = append(buf, payload...)
+	if _, err := w.w.Write(buf); err != nil {
+		return fmt.Errorf("writing dnstap frame: %w", err)
+	}
+	return w.w.Flush()
+}
+
+// Close ends the Frame Streams session and closes the underlying file or socket
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	err := w.writeControl(controlStop)
+	if err == nil && w.bidirectional {
+		err = w.readControl(controlFinish)
+	}
+	if closeErr := w.rw.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// nopReader adds a Read method to a WriteCloser for unidirectional writers
+type nopReader struct {
+	io.WriteCloser
+}
+
+func (nopReader) Read([]byte) (int, error) {
+	return 0, io.EOF
+}
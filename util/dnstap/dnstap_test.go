@@ -0,0 +1,115 @@
+package dnstap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type nopCloser struct {
+	*bytes.Buffer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// writeControlFrame writes a control frame with the dnstap content type
+func writeControlFrame(w io.Writer, controlType uint32) error {
+	var frame []byte
+	frame = binary.BigEndian.AppendUint32(frame, controlType)
+	frame = binary.BigEndian.AppendUint32(frame, controlContentType)
+	frame = binary.BigEndian.AppendUint32(frame, uint32(len(ContentType)))
+	frame = append(frame, ContentType...)
+
+	var buf []byte
+	buf = binary.BigEndian.AppendUint32(buf, 0)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(frame)))
+	_, err := w.Write(append(buf, frame...))
+	return err
+}
+
+func testMessage() *Message {
+	return &Message{
+		Type:         MessageToolResponse,
+		Family:       FamilyINET,
+		Protocol:     ProtocolDOT,
+		ServerIP:     net.ParseIP("192.0.2.1"),
+		ServerPort:   853,
+		QueryTime:    time.Unix(1700000000, 5),
+		ResponseTime: time.Unix(1700000001, 7),
+		Query:        []byte{0x12, 0x34},
+		Response:     []byte{0x56, 0x78},
+	}
+}
+
+func TestDnstapWriterFile(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(nopCloser{&buf})
+	assert.Nil(t, err)
+	w.Identity = "q"
+	assert.Nil(t, w.Write(testMessage()))
+	assert.Nil(t, w.Close())
+
+	r := bytes.NewReader(buf.Bytes())
+	frameType, err := readControlFrame(r)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(controlStart), frameType)
+
+	var length uint32
+	assert.Nil(t, binary.Read(r, binary.BigEndian, &length))
+	payload := make([]byte, length)
+	_, err = io.ReadFull(r, payload)
+	assert.Nil(t, err)
+	assert.Equal(t, testMessage().marshal("q", ""), payload)
+	assert.True(t, bytes.HasPrefix(payload, []byte{0x0a, 0x01, 'q'}))
+	assert.True(t, bytes.Contains(payload, []byte{0x2a, 0x04, 192, 0, 2, 1}))
+
+	frameType, err = readControlFrame(r)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(controlStop), frameType)
+}
+
+func TestDnstapWriterSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "dnstap.sock")
+	listener, err := net.Listen("unix", socket)
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	frames := make(chan []uint32, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var seen []uint32
+		frameType, _ := readControlFrame(conn)
+		seen = append(seen, frameType)
+		_ = writeControlFrame(conn, controlAccept)
+		frameType, _ = readControlFrame(conn)
+		seen = append(seen, frameType)
+
+		var length uint32
+		_ = binary.Read(conn, binary.BigEndian, &length)
+		_, _ = io.CopyN(io.Discard, conn, int64(length))
+
+		frameType, _ = readControlFrame(conn)
+		seen = append(seen, frameType)
+		_ = writeControlFrame(conn, controlFinish)
+		frames <- seen
+	}()
+
+	w, err := Open("unix:" + socket)
+	assert.Nil(t, err)
+	assert.Nil(t, w.Write(testMessage()))
+	assert.Nil(t, w.Close())
+	assert.Equal(t, []uint32{controlReady, controlStart, controlStop}, <-frames)
+}
@@ -0,0 +1,199 @@
+package dnstap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// dnstapTypeMessage is the Dnstap.Type value for frames carrying a Message
+const dnstapTypeMessage = 1
+
+func appendTag(b []byte, field, wireType int) []byte {
+	return binary.AppendUvarint(b, uint64(field<<3|wireType))
+}
+
+func appendVarintField(b []byte, field int, v uint64) []byte {
+	b = appendTag(b, field, wireVarint)
+	return binary.AppendUvarint(b, v)
+}
+
+func appendBytesField(b []byte, field int, v []byte) []byte {
+	b = appendTag(b, field, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendFixed32Field(b []byte, field int, v uint32) []byte {
+	b = appendTag(b, field, wireFixed32)
+	return binary.LittleEndian.AppendUint32(b, v)
+}
+
+// packIP returns the 4 byte form of IPv4 addresses
+func packIP(ip net.IP) net.IP {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip
+}
+
+// marshal encodes a message as a dnstap.Dnstap protobuf
+func (m *Message) marshal(identity, version string) []byte {
+	var msg []byte
+	msg = appendVarintField(msg, 1, uint64(m.Type))
+	if m.Family != 0 {
+		msg = appendVarintField(msg, 2, uint64(m.Family))
+	}
+	if m.Protocol != 0 {
+		msg = appendVarintField(msg, 3, uint64(m.Protocol))
+	}
+	if m.ClientIP != nil {
+		msg = appendBytesField(msg, 4, packIP(m.ClientIP))
+		msg = appendVarintField(msg, 6, uint64(m.ClientPort))
+	}
+	if m.ServerIP != nil {
+		msg = appendBytesField(msg, 5, packIP(m.ServerIP))
+		msg = appendVarintField(msg, 7, uint64(m.ServerPort))
+	}
+	if !m.QueryTime.IsZero() {
+		msg = appendVarintField(msg, 8, uint64(m.QueryTime.Unix()))
+		msg = appendFixed32Field(msg, 9, uint32(m.QueryTime.Nanosecond()))
+	}
+	if m.Query != nil {
+		msg = appendBytesField(msg, 10, m.Query)
+	}
+	if !m.ResponseTime.IsZero() {
+		msg = appendVarintField(msg, 12, uint64(m.ResponseTime.Unix()))
+		msg = appendFixed32Field(msg, 13, uint32(m.ResponseTime.Nanosecond()))
+	}
+	if m.Response != nil {
+		msg = appendBytesField(msg, 14, m.Response)
+	}
+
+	var b []byte
+	if identity != "" {
+		b = appendBytesField(b, 1, []byte(identity))
+	}
+	if version != "" {
+		b = appendBytesField(b, 2, []byte(version))
+	}
+	b = appendBytesField(b, 14, msg)
+	b = appendVarintField(b, 15, dnstapTypeMessage)
+	return b
+}
+
+// forEachField calls fn with each field of a protobuf message. Varint and fixed values are passed as v,
+// length delimited values as b.
+func forEachField(data []byte, fn func(field int, v uint64, b []byte) error) error {
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errors.New("invalid protobuf tag")
+		}
+		data = data[n:]
+
+		var v uint64
+		var b []byte
+		switch tag & 7 {
+		case wireVarint:
+			v, n = binary.Uvarint(data)
+			if n <= 0 {
+				return errors.New("invalid protobuf varint")
+			}
+			data = data[n:]
+		case wireFixed64:
+			if len(data) < 8 {
+				return errors.New("short protobuf fixed64")
+			}
+			v, data = binary.LittleEndian.Uint64(data), data[8:]
+		case wireBytes:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || length > uint64(len(data)-n) {
+				return errors.New("invalid protobuf length")
+			}
+			b, data = data[n:n+int(length)], data[n+int(length):]
+		case wireFixed32:
+			if len(data) < 4 {
+				return errors.New("short protobuf fixed32")
+			}
+			v, data = uint64(binary.LittleEndian.Uint32(data)), data[4:]
+		default:
+			return fmt.Errorf("unsupported protobuf wire type %d", tag&7)
+		}
+
+		if err := fn(int(tag>>3), v, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unmarshal decodes a dnstap.Dnstap protobuf, returning nil if it doesn't carry a Message
+func unmarshal(data []byte) (*Message, error) {
+	var msgData []byte
+	if err := forEachField(data, func(field int, v uint64, b []byte) error {
+		if field == 14 {
+			msgData = b
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if msgData == nil {
+		return nil, nil
+	}
+
+	m := &Message{}
+	var querySec, queryNsec, responseSec, responseNsec uint64
+	var hasQueryTime, hasResponseTime bool
+	if err := forEachField(msgData, func(field int, v uint64, b []byte) error {
+		switch field {
+		case 1:
+			m.Type = MessageType(v)
+		case 2:
+			m.Family = SocketFamily(v)
+		case 3:
+			m.Protocol = SocketProtocol(v)
+		case 4:
+			m.ClientIP = net.IP(b)
+		case 5:
+			m.ServerIP = net.IP(b)
+		case 6:
+			m.ClientPort = uint16(v)
+		case 7:
+			m.ServerPort = uint16(v)
+		case 8:
+			querySec, hasQueryTime = v, true
+		case 9:
+			queryNsec = v
+		case 10:
+			m.Query = b
+		case 12:
+			responseSec, hasResponseTime = v, true
+		case 13:
+			responseNsec = v
+		case 14:
+			m.Response = b
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if hasQueryTime {
+		m.QueryTime = time.Unix(int64(querySec), int64(queryNsec))
+	}
+	if hasResponseTime {
+		m.ResponseTime = time.Unix(int64(responseSec), int64(responseNsec))
+	}
+	return m, nil
+}
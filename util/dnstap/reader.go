@@ -0,0 +1,93 @@
+package dnstap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Reader reads dnstap messages from a Frame Streams file
+type Reader struct {
+	r      *bufio.Reader
+	closer io.Closer
+}
+
+// OpenReader opens a dnstap file at path
+func OpenReader(path string) (*Reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening dnstap file %s: %w", path, err)
+	}
+	r, err := NewReader(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	r.closer = file
+	return r, nil
+}
+
+// NewReader reads the Frame Streams start frame from r and returns a Reader
+func NewReader(r io.Reader) (*Reader, error) {
+	dr := &Reader{r: bufio.NewReader(r)}
+	frameType, err := readControlFrame(dr.r)
+	if err != nil {
+		return nil, fmt.Errorf("reading dnstap start frame: %w", err)
+	}
+	if frameType != controlStart {
+		return nil, fmt.Errorf("unexpected dnstap control frame type %d, expected %d", frameType, controlStart)
+	}
+	return dr, nil
+}
+
+// Read returns the next dnstap message, or io.EOF at the end of the stream
+func (r *Reader) Read() (*Message, error) {
+	for {
+		var length [4]byte
+		if _, err := io.ReadFull(r.r, length[:]); err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil, fmt.Errorf("reading dnstap frame: %w", err)
+			}
+			return nil, err
+		}
+
+		// Control frame
+		if binary.BigEndian.Uint32(length[:]) == 0 {
+			var controlLength [4]byte
+			if _, err := io.ReadFull(r.r, controlLength[:]); err != nil {
+				return nil, fmt.Errorf("reading dnstap control frame: %w", err)
+			}
+			frame := make([]byte, binary.BigEndian.Uint32(controlLength[:]))
+			if _, err := io.ReadFull(r.r, frame); err != nil {
+				return nil, fmt.Errorf("reading dnstap control frame: %w", err)
+			}
+			if len(frame) >= 4 && binary.BigEndian.Uint32(frame) == controlStop {
+				return nil, io.EOF
+			}
+			continue
+		}
+
+		frame := make([]byte, binary.BigEndian.Uint32(length[:]))
+		if _, err := io.ReadFull(r.r, frame); err != nil {
+			return nil, fmt.Errorf("reading dnstap frame: %w", err)
+		}
+		m, err := unmarshal(frame)
+		if err != nil {
+			return nil, fmt.Errorf("decoding dnstap frame: %w", err)
+		}
+		if m != nil {
+			return m, nil
+		}
+	}
+}
+
+// Close closes the underlying file if the Reader was created by OpenReader
+func (r *Reader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
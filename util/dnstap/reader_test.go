@@ -0,0 +1,58 @@
+package dnstap
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDnstapReaderRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(nopCloser{&buf})
+	assert.Nil(t, err)
+	w.Identity = "q"
+	query := testMessage()
+	query.Type = MessageToolQuery
+	query.Response = nil
+	query.ResponseTime = query.ResponseTime.AddDate(-100, 0, 0) // zero values aren't encoded
+	assert.Nil(t, w.Write(query))
+	response := testMessage()
+	response.ClientIP = net.ParseIP("2001:db8::1")
+	response.ClientPort = 40000
+	assert.Nil(t, w.Write(response))
+	assert.Nil(t, w.Close())
+
+	r, err := NewReader(&buf)
+	assert.Nil(t, err)
+
+	m, err := r.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, MessageToolQuery, m.Type)
+	assert.False(t, m.Type.IsResponse())
+	assert.Equal(t, []byte{0x12, 0x34}, m.Query)
+	assert.Nil(t, m.Response)
+
+	m, err = r.Read()
+	assert.Nil(t, err)
+	assert.True(t, m.Type.IsResponse())
+	assert.Equal(t, ProtocolDOT, m.Protocol)
+	assert.Equal(t, FamilyINET, m.Family)
+	assert.Equal(t, "192.0.2.1", m.ServerIP.String())
+	assert.Equal(t, uint16(853), m.ServerPort)
+	assert.Equal(t, "2001:db8::1", m.ClientIP.String())
+	assert.Equal(t, uint16(40000), m.ClientPort)
+	assert.True(t, response.QueryTime.Equal(m.QueryTime))
+	assert.True(t, response.ResponseTime.Equal(m.ResponseTime))
+	assert.Equal(t, []byte{0x56, 0x78}, m.Response)
+
+	_, err = r.Read()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestDnstapReaderNotDnstap(t *testing.T) {
+	_, err := NewReader(bytes.NewReader([]byte{0x0A, 0x0D, 0x0D, 0x0A, 0, 0, 0, 0}))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,380 @@
+// Package expr evaluates boolean filter expressions such as `type == "A" && ttl < 300` over named fields
+package expr
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Expr is a parsed filter expression
+type Expr struct {
+	root node
+}
+
+// node is an expression tree node that evaluates to a string, float64 or bool
+type node interface {
+	eval(fields map[string]any) (any, error)
+}
+
+type (
+	literal struct{ v any }
+	field   struct{ name string }
+	not     struct{ x node }
+	logical struct {
+		op   string
+		l, r node
+	}
+	compare struct {
+		op   string
+		l, r node
+		re   *regexp.Regexp // precompiled pattern for =~ and !~ with a literal
+	}
+)
+
+// Parse parses an expression, returning an error if it refers to a field that isn't in fields
+func Parse(s string, fields []string) (*Expr, error) {
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, fields: fields}
+	root, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	return &Expr{root: root}, nil
+}
+
+// Match evaluates the expression against field values and reports whether it's true
+func (e *Expr) Match(fields map[string]any) (bool, error) {
+	v, err := e.root.eval(fields)
+	if err != nil {
+		return false, err
+	}
+	return truthy(v), nil
+}
+
+// token is a lexical token
+type token struct {
+	kind string // ident, number, string or op
+	text string
+}
+
+// operators in the order they're matched, longest first
+var operators = []string{"==", "!=", "<=", ">=", "=~", "!~", "&&", "||", "<", ">", "!", "(", ")"}
+
+// lex splits an expression into tokens
+func lex(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(s) && s[j] != c {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			text := s[i+1 : j]
+			if c == '"' {
+				unquoted, err := strconv.Unquote(s[i : j+1])
+				if err != nil {
+					return nil, fmt.Errorf("invalid string at %d: %s", i, err)
+				}
+				text = unquoted
+			}
+			tokens = append(tokens, token{"string", text})
+			i = j + 1
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9':
+			j := i
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{"number", s[i:j]})
+			i = j
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i
+			for j < len(s) && (s[j] == '_' || s[j] >= 'a' && s[j] <= 'z' || s[j] >= 'A' && s[j] <= 'Z' || s[j] >= '0' && s[j] <= '9') {
+				j++
+			}
+			tokens = append(tokens, token{"ident", s[i:j]})
+			i = j
+		default:
+			found := false
+			for _, op := range operators {
+				if strings.HasPrefix(s[i:], op) {
+					tokens = append(tokens, token{"op", op})
+					i += len(op)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("unexpected character %q at %d", c, i)
+			}
+		}
+	}
+	return tokens, nil
+}
+
+// parser is a recursive descent parser over tokens
+type parser struct {
+	tokens []token
+	pos    int
+	fields []string
+}
+
+// accept consumes the next token if it's one of the given operators
+func (p *parser) accept(ops ...string) (string, bool) {
+	if p.pos < len(p.tokens) && p.tokens[p.pos].kind == "op" {
+		for _, op := range ops {
+			if p.tokens[p.pos].text == op {
+				p.pos++
+				return op, true
+			}
+		}
+	}
+	return "", false
+}
+
+func (p *parser) or() (node, error) {
+	l, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("||"); !ok {
+			return l, nil
+		}
+		r, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l = &logical{op: "||", l: l, r: r}
+	}
+}
+
+func (p *parser) and() (node, error) {
+	l, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("&&"); !ok {
+			return l, nil
+		}
+		r, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l = &logical{op: "&&", l: l, r: r}
+	}
+}
+
+func (p *parser) unary() (node, error) {
+	if _, ok := p.accept("!"); ok {
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &not{x: x}, nil
+	}
+	return p.comparison()
+}
+
+func (p *parser) comparison() (node, error) {
+	l, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := p.accept("==", "!=", "<=", ">=", "<", ">", "=~", "!~")
+	if !ok {
+		return l, nil
+	}
+	r, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	c := &compare{op: op, l: l, r: r}
+	if lit, ok := r.(*literal); ok && (op == "=~" || op == "!~") {
+		c.re, err = regexp.Compile(fmt.Sprint(lit.v))
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression: %s", err)
+		}
+	}
+	return c, nil
+}
+
+func (p *parser) primary() (node, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	switch t.kind {
+	case "string":
+		return &literal{t.text}, nil
+	case "number":
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", t.text)
+		}
+		return &literal{f}, nil
+	case "ident":
+		switch t.text {
+		case "true":
+			return &literal{true}, nil
+		case "false":
+			return &literal{false}, nil
+		}
+		for _, f := range p.fields {
+			if f == t.text {
+				return &field{t.text}, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown field %q (expected one of %s)", t.text, strings.Join(p.fields, ", "))
+	}
+	if t.text == "(" {
+		x, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := p.accept(")"); !ok {
+			return nil, fmt.Errorf("missing )")
+		}
+		return x, nil
+	}
+	return nil, fmt.Errorf("unexpected %q", t.text)
+}
+
+func (n *literal) eval(map[string]any) (any, error) {
+	return n.v, nil
+}
+
+func (n *field) eval(fields map[string]any) (any, error) {
+	switch v := fields[n.name].(type) {
+	case int:
+		return float64(v), nil
+	case uint16:
+		return float64(v), nil
+	case uint32:
+		return float64(v), nil
+	case nil:
+		return "", nil
+	default:
+		return v, nil
+	}
+}
+
+func (n *not) eval(fields map[string]any) (any, error) {
+	v, err := n.x.eval(fields)
+	if err != nil {
+		return nil, err
+	}
+	return !truthy(v), nil
+}
+
+func (n *logical) eval(fields map[string]any) (any, error) {
+	l, err := n.l.eval(fields)
+	if err != nil {
+		return nil, err
+	}
+	// Short circuit
+	if n.op == "&&" && !truthy(l) || n.op == "||" && truthy(l) {
+		return truthy(l), nil
+	}
+	r, err := n.r.eval(fields)
+	if err != nil {
+		return nil, err
+	}
+	return truthy(r), nil
+}
+
+func (n *compare) eval(fields map[string]any) (any, error) {
+	l, err := n.l.eval(fields)
+	if err != nil {
+		return nil, err
+	}
+	r, err := n.r.eval(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	if n.op == "=~" || n.op == "!~" {
+		re := n.re
+		if re == nil {
+			re, err = regexp.Compile(fmt.Sprint(r))
+			if err != nil {
+				return nil, fmt.Errorf("invalid regular expression: %s", err)
+			}
+		}
+		return re.MatchString(fmt.Sprint(l)) == (n.op == "=~"), nil
+	}
+
+	// Compare as numbers if both sides are numeric, otherwise as case-insensitive strings
+	lf, lNum := number(l)
+	rf, rNum := number(r)
+	var c int
+	if lNum && rNum {
+		switch {
+		case lf < rf:
+			c = -1
+		case lf > rf:
+			c = 1
+		}
+	} else {
+		c = strings.Compare(strings.ToLower(fmt.Sprint(l)), strings.ToLower(fmt.Sprint(r)))
+	}
+
+	switch n.op {
+	case "==":
+		return c == 0, nil
+	case "!=":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	default: // >=
+		return c >= 0, nil
+	}
+}
+
+// number returns a value as a number if it's numeric
+func number(v any) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// truthy returns the boolean value of a value: true, a non-empty string or a non-zero number
+func truthy(v any) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case float64:
+		return v != 0
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package expr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testFields = []string{"type", "ttl", "owner", "rdata"}
+
+func TestExprMatch(t *testing.T) {
+	fields := map[string]any{"type": "A", "ttl": uint32(120), "owner": "www.example.com.", "rdata": "192.0.2.1"}
+	for s, want := range map[string]bool{
+		`type == "A"`:                     true,
+		`type == "a"`:                     true,
+		`type != 'A'`:                     false,
+		`ttl < 300`:                       true,
+		`ttl >= 120 && ttl <= 120`:        true,
+		`type == "AAAA" || ttl > 100`:     true,
+		`!(type == "A")`:                  false,
+		`owner =~ "^www\\."`:              true,
+		`rdata !~ "^192"`:                 false,
+		`type == "MX" || (ttl < 60 && 1)`: false,
+		`rdata`:                           true,
+		`true && !false`:                  true,
+	} {
+		e, err := Parse(s, testFields)
+		assert.Nil(t, err, s)
+		got, err := e.Match(fields)
+		assert.Nil(t, err, s)
+		assert.Equal(t, want, got, s)
+	}
+}
+
+func TestExprParseErrors(t *testing.T) {
+	for _, s := range []string{
+		``,
+		`type ==`,
+		`name == "x"`,
+		`(ttl < 5`,
+		`ttl < 5)`,
+		`type == "A`,
+		`owner =~ "("`,
+		`ttl # 5`,
+	} {
+		_, err := Parse(s, testFields)
+		assert.NotNil(t, err, s)
+	}
+}
@@ -0,0 +1,303 @@
+// Package lineedit reads lines from a terminal with emacs style editing, history and tab completion
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/x/term"
+)
+
+// ErrInterrupted is returned by ReadLine when the line is cancelled with Ctrl-C
+var ErrInterrupted = errors.New("interrupted")
+
+// maxHistory is the number of lines kept in history
+const maxHistory = 1000
+
+// Editor reads lines with editing when attached to a terminal, or plain lines otherwise
+type Editor struct {
+	Prompt  string
+	History []string
+
+	// Complete returns the candidates for the word before the cursor
+	Complete func(word string) []string
+
+	// Interactive enables line editing, and is set when the input is a terminal
+	Interactive bool
+
+	in  *bufio.Reader
+	out io.Writer
+	fd  uintptr
+	tty bool
+
+	line []rune
+	pos  int
+}
+
+// New creates an editor reading from in and echoing to out
+func New(in io.Reader, out io.Writer) *Editor {
+	e := &Editor{in: bufio.NewReader(in), out: out}
+	if f, ok := in.(*os.File); ok && term.IsTerminal(f.Fd()) {
+		e.fd = f.Fd()
+		e.tty = true
+		e.Interactive = true
+	}
+	return e
+}
+
+// AddHistory appends a line to the history, skipping empty lines and repeats of the last line
+func (e *Editor) AddHistory(line string) {
+	if line == "" || (len(e.History) > 0 && e.History[len(e.History)-1] == line) {
+		return
+	}
+	e.History = append(e.History, line)
+	if len(e.History) > maxHistory {
+		e.History = e.History[len(e.History)-maxHistory:]
+	}
+}
+
+// LoadHistory reads history lines from a file, ignoring a missing file
+func (e *Editor) LoadHistory(path string) error {
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		e.AddHistory(line)
+	}
+	return nil
+}
+
+// SaveHistory writes the history to a file
+func (e *Editor) SaveHistory(path string) error {
+	return os.WriteFile(path, []byte(strings.Join(e.History, "\n")+"\n"), 0600)
+}
+
+// ReadLine reads a line, returning io.EOF at the end of input or on Ctrl-D and ErrInterrupted on Ctrl-C
+func (e *Editor) ReadLine() (string, error) {
+	if !e.Interactive {
+		line, err := e.in.ReadString('\n')
+		if err != nil && (line == "" || !errors.Is(err, io.EOF)) {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	if e.tty {
+		state, err := term.MakeRaw(e.fd)
+		if err != nil {
+			return "", fmt.Errorf("setting terminal mode: %w", err)
+		}
+		defer func() {
+			_ = term.Restore(e.fd, state)
+		}()
+	}
+
+	e.line, e.pos = nil, 0
+	histPos := len(e.History)
+	var saved []rune // line being edited before moving through history
+	e.refresh()
+
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			e.write("\r\n")
+			return string(e.line), nil
+		case 0x03: // Ctrl-C
+			e.write("^C\r\n")
+			return "", ErrInterrupted
+		case 0x04: // Ctrl-D
+			if len(e.line) == 0 {
+				e.write("\r\n")
+				return "", io.EOF
+			}
+			e.delete()
+		case 0x7f, 0x08: // Backspace
+			if e.pos > 0 {
+				e.pos--
+				e.delete()
+			}
+		case 0x01: // Ctrl-A
+			e.pos = 0
+		case 0x05: // Ctrl-E
+			e.pos = len(e.line)
+		case 0x02: // Ctrl-B
+			e.pos = max(e.pos-1, 0)
+		case 0x06: // Ctrl-F
+			e.pos = min(e.pos+1, len(e.line))
+		case 0x0b: // Ctrl-K
+			e.line = e.line[:e.pos]
+		case 0x15: // Ctrl-U
+			e.line = e.line[e.pos:]
+			e.pos = 0
+		case 0x17: // Ctrl-W
+			start := e.pos
+			for start > 0 && e.line[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && e.line[start-1] != ' ' {
+				start--
+			}
+			e.line = append(e.line[:start], e.line[e.pos:]...)
+			e.pos = start
+		case 0x0c: // Ctrl-L
+			e.write("\x1b[H\x1b[2J")
+		case 0x10, 0x0e: // Ctrl-P, Ctrl-N
+			histPos, saved = e.moveHistory(r == 0x10, histPos, saved)
+		case '\t':
+			e.complete()
+		case 0x1b: // Escape sequence
+			switch e.escape() {
+			case 'A':
+				histPos, saved = e.moveHistory(true, histPos, saved)
+			case 'B':
+				histPos, saved = e.moveHistory(false, histPos, saved)
+			case 'C':
+				e.pos = min(e.pos+1, len(e.line))
+			case 'D':
+				e.pos = max(e.pos-1, 0)
+			case 'H':
+				e.pos = 0
+			case 'F':
+				e.pos = len(e.line)
+			case '~':
+				e.delete()
+			}
+		default:
+			if r < 0x20 || r == utf8.RuneError {
+				continue
+			}
+			e.line = slices.Insert(e.line, e.pos, r)
+			e.pos++
+		}
+		e.refresh()
+	}
+}
+
+// escape reads the rest of an escape sequence and returns its final byte, or '~' for delete
+func (e *Editor) escape() rune {
+	r, _, err := e.in.ReadRune()
+	if err != nil || (r != '[' && r != 'O') {
+		return 0
+	}
+	var params string
+	for {
+		r, _, err = e.in.ReadRune()
+		if err != nil {
+			return 0
+		}
+		if r >= 0x40 && r <= 0x7e {
+			break
+		}
+		params += string(r)
+	}
+	switch {
+	case r == '~' && params == "3":
+		return '~'
+	case r == '~' && (params == "1" || params == "7"):
+		return 'H'
+	case r == '~' && (params == "4" || params == "8"):
+		return 'F'
+	case r == '~':
+		return 0
+	}
+	return r
+}
+
+// delete removes the rune at the cursor
+func (e *Editor) delete() {
+	if e.pos < len(e.line) {
+		e.line = slices.Delete(e.line, e.pos, e.pos+1)
+	}
+}
+
+// wordStart returns the index of the start of the word before the cursor
+func (e *Editor) wordStart() int {
+	start := e.pos
+	for start > 0 && e.line[start-1] != ' ' {
+		start--
+	}
+	return start
+}
+
+// moveHistory replaces the line with the previous or next history entry
+func (e *Editor) moveHistory(back bool, histPos int, saved []rune) (int, []rune) {
+	if histPos == len(e.History) {
+		saved = slices.Clone(e.line)
+	}
+	if back && histPos > 0 {
+		histPos--
+	} else if !back && histPos < len(e.History) {
+		histPos++
+	} else {
+		return histPos, saved
+	}
+
+	if histPos == len(e.History) {
+		e.line = slices.Clone(saved)
+	} else {
+		e.line = []rune(e.History[histPos])
+	}
+	e.pos = len(e.line)
+	return histPos, saved
+}
+
+// complete replaces the word before the cursor with its completion, or extends it to the longest common
+// prefix of the candidates and lists them
+func (e *Editor) complete() {
+	if e.Complete == nil {
+		return
+	}
+	start := e.wordStart()
+	word := string(e.line[start:e.pos])
+	candidates := e.Complete(word)
+	if len(candidates) == 0 {
+		return
+	}
+
+	replacement := candidates[0]
+	if len(candidates) == 1 {
+		replacement += " "
+	} else {
+		for _, c := range candidates[1:] {
+			for !strings.HasPrefix(strings.ToLower(c), strings.ToLower(replacement)) {
+				replacement = replacement[:len(replacement)-1]
+			}
+		}
+		if len(replacement) <= len(word) {
+			e.write("\r\n" + strings.Join(candidates, "  ") + "\r\n")
+			return
+		}
+	}
+
+	rest := slices.Clone(e.line[e.pos:])
+	e.line = append(append(e.line[:start], []rune(replacement)...), rest...)
+	e.pos = start + len([]rune(replacement))
+}
+
+// refresh redraws the prompt and line and places the cursor
+func (e *Editor) refresh() {
+	s := "\r" + e.Prompt + string(e.line) + "\x1b[K"
+	if back := len(e.line) - e.pos; back > 0 {
+		s += fmt.Sprintf("\x1b[%dD", back)
+	}
+	e.write(s)
+}
+
+func (e *Editor) write(s string) {
+	_, _ = io.WriteString(e.out, s)
+}
@@ -0,0 +1,124 @@
+package lineedit
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// editor returns an interactive editor reading keys from a string
+func editor(keys string) *Editor {
+	e := New(strings.NewReader(keys), io.Discard)
+	e.Interactive = true
+	return e
+}
+
+func TestLineEditEditing(t *testing.T) {
+	for keys, want := range map[string]string{
+		"example.com\r":                "example.com",
+		"exampel\x7f\x7fle.com\r":      "example.com",
+		"example.com\x01www.\r":        "www.example.com",
+		"example\x1b[D\x1b[D\x1b[Cz\r": "examplze",
+		"a b c\x17\x17x\r":             "a x",
+		"abcdef\x1b[D\x1b[D\x0b\r":     "abcd",
+		"abcdef\x1b[D\x1b[D\x15\r":     "ef",
+		"abc\x01\x1b[3~\x05d\r":        "bcd",
+		"abc\x02\x02\x04\x06\x06x\r":   "acx",
+		"ünïcode\x7f\r":                "ünïcod",
+		"abc\x1bOH-\x1b[4~-\n":         "-abc-",
+		"plain\x1b[1;5Cline\r":         "plainline",
+		"\x00\x07bell\r":               "bell",
+		"ab\x1b[Hx\x1b[Fy\r":           "xaby",
+	} {
+		line, err := editor(keys).ReadLine()
+		assert.Nil(t, err, keys)
+		assert.Equal(t, want, line, keys)
+	}
+}
+
+func TestLineEditControl(t *testing.T) {
+	e := editor("partial\x03\x04")
+	_, err := e.ReadLine()
+	assert.ErrorIs(t, err, ErrInterrupted)
+	_, err = e.ReadLine()
+	assert.ErrorIs(t, err, io.EOF)
+
+	_, err = editor("no newline").ReadLine()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestLineEditHistory(t *testing.T) {
+	e := editor("\x1b[A\r\x1b[A\x1b[A\x1b[B\r\x10\x10\x10\x0e\x0enew\r")
+	e.AddHistory("first")
+	e.AddHistory("second")
+	e.AddHistory("second")
+	e.AddHistory("")
+	assert.Equal(t, []string{"first", "second"}, e.History)
+
+	for _, want := range []string{"second", "second", "new"} {
+		line, err := e.ReadLine()
+		assert.Nil(t, err)
+		assert.Equal(t, want, line)
+	}
+
+	path := filepath.Join(t.TempDir(), "history")
+	assert.Nil(t, e.SaveHistory(path))
+	loaded := editor("")
+	assert.Nil(t, loaded.LoadHistory(path))
+	assert.Equal(t, e.History, loaded.History)
+	assert.Nil(t, loaded.LoadHistory(filepath.Join(t.TempDir(), "missing")))
+}
+
+func TestLineEditComplete(t *testing.T) {
+	complete := func(word string) []string {
+		var out []string
+		for _, c := range []string{"AAAA", "A", "AFSDB", "MX"} {
+			if strings.HasPrefix(c, strings.ToUpper(word)) {
+				out = append(out, c)
+			}
+		}
+		return out
+	}
+
+	for keys, want := range map[string]string{
+		"example.com m\t\r":   "example.com MX ",
+		"example.com aa\t\r":  "example.com AAAA ",
+		"x\x01\tz\r":          "zx",
+		"example.com q\tq\r":  "example.com qq",
+		"example.com af\tx\r": "example.com AFSDB x",
+		"a\t\r":               "a",
+	} {
+		e := editor(keys)
+		e.Complete = complete
+		line, err := e.ReadLine()
+		assert.Nil(t, err, keys)
+		assert.Equal(t, want, line, keys)
+	}
+
+	// Ambiguous completions are listed
+	var out bytes.Buffer
+	e := New(strings.NewReader("a\t\r"), &out)
+	e.Interactive = true
+	e.Complete = complete
+	_, err := e.ReadLine()
+	assert.Nil(t, err)
+	assert.Contains(t, out.String(), "AAAA  A  AFSDB")
+}
+
+func TestLineEditNotInteractive(t *testing.T) {
+	var out bytes.Buffer
+	e := New(strings.NewReader("one\r\ntwo\nthree"), &out)
+	e.Prompt = "> "
+	for _, want := range []string{"one", "two", "three"} {
+		line, err := e.ReadLine()
+		assert.Nil(t, err)
+		assert.Equal(t, want, line)
+	}
+	_, err := e.ReadLine()
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Empty(t, out.String())
+}
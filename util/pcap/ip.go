@@ -0,0 +1,150 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"net/netip"
+)
+
+// IP protocol numbers
+const (
+	protocolTCP = 6
+	protocolUDP = 17
+)
+
+// ipPacket wraps a transport segment in an IPv4 or IPv6 header
+func ipPacket(src, dst netip.Addr, protocol byte, segment []byte) []byte {
+	if src.Is4() {
+		header := make([]byte, 20)
+		header[0] = 0x45 // version 4, 5 word header
+		binary.BigEndian.PutUint16(header[2:], uint16(20+len(segment)))
+		header[8] = 64 // TTL
+		header[9] = protocol
+		copy(header[12:16], src.AsSlice())
+		copy(header[16:20], dst.AsSlice())
+		binary.BigEndian.PutUint16(header[10:], checksum(0, header))
+		return append(header, segment...)
+	}
+
+	header := make([]byte, 40)
+	header[0] = 0x60 // version 6
+	binary.BigEndian.PutUint16(header[4:], uint16(len(segment)))
+	header[6] = protocol
+	header[7] = 64 // hop limit
+	copy(header[8:24], src.AsSlice())
+	copy(header[24:40], dst.AsSlice())
+	return append(header, segment...)
+}
+
+// transportChecksum computes a TCP or UDP checksum including the IP pseudo-header
+func transportChecksum(src, dst netip.Addr, protocol byte, segment []byte) uint16 {
+	var pseudo []byte
+	pseudo = append(pseudo, src.AsSlice()...)
+	pseudo = append(pseudo, dst.AsSlice()...)
+	if src.Is4() {
+		pseudo = append(pseudo, 0, protocol)
+		pseudo = binary.BigEndian.AppendUint16(pseudo, uint16(len(segment)))
+	} else {
+		pseudo = binary.BigEndian.AppendUint32(pseudo, uint32(len(segment)))
+		pseudo = append(pseudo, 0, 0, 0, protocol)
+	}
+	sum := checksum(checksum(0, pseudo)^0xFFFF, segment)
+	if sum == 0 && protocol == protocolUDP {
+		return 0xFFFF
+	}
+	return sum
+}
+
+// checksum computes the internet checksum of b, continuing from the one's complement sum initial
+func checksum(initial uint16, b []byte) uint16 {
+	sum := uint32(initial)
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(b[i:]))
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum > 0xFFFF {
+		sum = (sum >> 16) + (sum & 0xFFFF)
+	}
+	return ^uint16(sum)
+}
+
+// IPv6 extension headers that can precede a transport header
+const (
+	ipv6HopByHop    = 0
+	ipv6Routing     = 43
+	ipv6Fragment    = 44
+	ipv6Destination = 60
+)
+
+// decodeIP decodes an unfragmented IPv4 or IPv6 packet carrying UDP or TCP
+func decodeIP(b []byte) *Packet {
+	if len(b) < 1 {
+		return nil
+	}
+
+	var src, dst netip.Addr
+	var protocol byte
+	switch b[0] >> 4 {
+	case 4:
+		headerLen := int(b[0]&0x0F) * 4
+		if len(b) < 20 || headerLen < 20 || len(b) < headerLen {
+			return nil
+		}
+		if binary.BigEndian.Uint16(b[6:])&0x3FFF != 0 { // more fragments flag or fragment offset
+			return nil
+		}
+		if total := int(binary.BigEndian.Uint16(b[2:])); total >= headerLen && total < len(b) {
+			b = b[:total] // trim link layer padding
+		}
+		src, _ = netip.AddrFromSlice(b[12:16])
+		dst, _ = netip.AddrFromSlice(b[16:20])
+		protocol = b[9]
+		b = b[headerLen:]
+	case 6:
+		if len(b) < 40 {
+			return nil
+		}
+		if payloadLen := int(binary.BigEndian.Uint16(b[4:])); 40+payloadLen < len(b) {
+			b = b[:40+payloadLen]
+		}
+		src, _ = netip.AddrFromSlice(b[8:24])
+		dst, _ = netip.AddrFromSlice(b[24:40])
+		protocol = b[6]
+		b = b[40:]
+		for protocol == ipv6HopByHop || protocol == ipv6Routing || protocol == ipv6Destination {
+			if len(b) < 8 || len(b) < (int(b[1])+1)*8 {
+				return nil
+			}
+			protocol, b = b[0], b[(int(b[1])+1)*8:]
+		}
+		if protocol == ipv6Fragment {
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	switch protocol {
+	case protocolUDP:
+		if len(b) < 8 {
+			return nil
+		}
+		return &Packet{
+			Src:     netip.AddrPortFrom(src, binary.BigEndian.Uint16(b[0:])),
+			Dst:     netip.AddrPortFrom(dst, binary.BigEndian.Uint16(b[2:])),
+			Payload: b[8:],
+		}
+	case protocolTCP:
+		if len(b) < 20 || len(b) < int(b[12]>>4)*4 {
+			return nil
+		}
+		return &Packet{
+			Src:     netip.AddrPortFrom(src, binary.BigEndian.Uint16(b[0:])),
+			Dst:     netip.AddrPortFrom(dst, binary.BigEndian.Uint16(b[2:])),
+			TCP:     true,
+			Payload: b[int(b[12]>>4)*4:],
+		}
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+// Package pcap writes DNS messages to pcapng files with synthetic IP, UDP and TCP headers, and reads
+// UDP and TCP packets back from pcap and pcapng files
+// https://www.ietf.org/archive/id/draft-ietf-opsawg-pcapng-01.html
+package pcap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+)
+
+// pcapng block types
+const (
+	blockSectionHeader        = 0x0A0D0D0A
+	blockInterfaceDescription = 0x00000001
+	blockEnhancedPacket       = 0x00000006
+	byteOrderMagic            = 0x1A2B3C4D
+)
+
+// pcapng option codes
+const (
+	optEndOfOpt = 0
+	optComment  = 1
+	optUserAppl = 4 // shb_userappl
+)
+
+// LinkTypeRaw is the link type of packets that start with an IPv4 or IPv6 header
+const LinkTypeRaw = 101
+
+// Writer writes packets to a pcapng file
+type Writer struct {
+	mu     sync.Mutex
+	w      io.WriteCloser
+	seqs   map[string]uint32 // next TCP sequence number by flow
+	closed bool
+}
+
+// Create creates a pcapng file at path
+func Create(path, application string) (*Writer, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("creating pcap file %s: %w", path, err)
+	}
+	w, err := NewWriter(file, application)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// NewWriter writes the pcapng section and interface headers to w and returns a Writer
+func NewWriter(w io.WriteCloser, application string) (*Writer, error) {
+	pw := &Writer{w: w, seqs: make(map[string]uint32)}
+
+	var shb []byte
+	shb = binary.LittleEndian.AppendUint32(shb, byteOrderMagic)
+	shb = binary.LittleEndian.AppendUint16(shb, 1) // major version
+	shb = binary.LittleEndian.AppendUint16(shb, 0) // minor version
+	shb = binary.LittleEndian.AppendUint64(shb, 0xFFFFFFFFFFFFFFFF)
+	if application != "" {
+		shb = appendOption(shb, optUserAppl, []byte(application))
+		shb = appendOption(shb, optEndOfOpt, nil)
+	}
+	if err := pw.writeBlock(blockSectionHeader, shb); err != nil {
+		return nil, err
+	}
+
+	var idb []byte
+	idb = binary.LittleEndian.AppendUint16(idb, LinkTypeRaw)
+	idb = binary.LittleEndian.AppendUint16(idb, 0) // reserved
+	idb = binary.LittleEndian.AppendUint32(idb, 0) // no snap length limit
+	if err := pw.writeBlock(blockInterfaceDescription, idb); err != nil {
+		return nil, err
+	}
+
+	return pw, nil
+}
+
+// appendOption appends a pcapng option padded to 32 bits
+func appendOption(b []byte, code uint16, value []byte) []byte {
+	b = binary.LittleEndian.AppendUint16(b, code)
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(value)))
+	b = append(b, value...)
+	return append(b, make([]byte, pad4(len(value)))...)
+}
+
+// pad4 returns the number of bytes needed to pad n to a multiple of 4
+func pad4(n int) int {
+	return (4 - n%4) % 4
+}
+
+// writeBlock writes a pcapng block with its type and length fields
+func (w *Writer) writeBlock(blockType uint32, body []byte) error {
+	length := uint32(12 + len(body))
+	var b []byte
+	b = binary.LittleEndian.AppendUint32(b, blockType)
+	b = binary.LittleEndian.AppendUint32(b, length)
+	b = append(b, body...)
+	b = binary.LittleEndian.AppendUint32(b, length)
+	if _, err := w.w.Write(b); err != nil {
+		return fmt.Errorf("writing pcap block: %w", err)
+	}
+	return nil
+}
+
+// writePacket writes an IP packet captured at t with an optional comment
+func (w *Writer) writePacket(t time.Time, packet []byte, comment string) error {
+	if w.closed {
+		return errors.New("pcap writer closed")
+	}
+
+	ts := uint64(t.UnixMicro())
+	var epb []byte
+	epb = binary.LittleEndian.AppendUint32(epb, 0) // interface ID
+	epb = binary.LittleEndian.AppendUint32(epb, uint32(ts>>32))
+	epb = binary.LittleEndian.AppendUint32(epb, uint32(ts))
+	epb = binary.LittleEndian.AppendUint32(epb, uint32(len(packet)))
+	epb = binary.LittleEndian.AppendUint32(epb, uint32(len(packet)))
+	epb = append(epb, packet...)
+	epb = append(epb, make([]byte, pad4(len(packet)))...)
+	if comment != "" {
+		epb = appendOption(epb, optComment, []byte(comment))
+		epb = appendOption(epb, optEndOfOpt, nil)
+	}
+	return w.writeBlock(blockEnhancedPacket, epb)
+}
+
+// WriteUDP writes a UDP datagram from src to dst
+func (w *Writer) WriteUDP(t time.Time, src, dst netip.AddrPort, payload []byte, comment string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	segment := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint16(segment[0:], src.Port())
+	binary.BigEndian.PutUint16(segment[2:], dst.Port())
+	binary.BigEndian.PutUint16(segment[4:], uint16(8+len(payload)))
+	segment = append(segment, payload...)
+	binary.BigEndian.PutUint16(segment[6:], transportChecksum(src.Addr(), dst.Addr(), protocolUDP, segment))
+
+	return w.writePacket(t, ipPacket(src.Addr(), dst.Addr(), protocolUDP, segment), comment)
+}
+
+// WriteTCP writes a TCP segment from src to dst, continuing the sequence numbers of earlier segments between them
+func (w *Writer) WriteTCP(t time.Time, src, dst netip.AddrPort, payload []byte, comment string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	flow, reverse := src.String()+">"+dst.String(), dst.String()+">"+src.String()
+	seq, ok := w.seqs[flow]
+	if !ok {
+		seq = 1
+	}
+	ack, ok := w.seqs[reverse]
+	if !ok {
+		ack = 1
+	}
+	w.seqs[flow] = seq + uint32(len(payload))
+
+	segment := make([]byte, 20, 20+len(payload))
+	binary.BigEndian.PutUint16(segment[0:], src.Port())
+	binary.BigEndian.PutUint16(segment[2:], dst.Port())
+	binary.BigEndian.PutUint32(segment[4:], seq)
+	binary.BigEndian.PutUint32(segment[8:], ack)
+	segment[12] = 5 << 4                            // data offset
+	segment[13] = 0x18                              // PSH, ACK
+	binary.BigEndian.PutUint16(segment[14:], 65535) // window
+	segment = append(segment, payload...)
+	binary.BigEndian.PutUint16(segment[16:], transportChecksum(src.Addr(), dst.Addr(), protocolTCP, segment))
+
+	return w.writePacket(t, ipPacket(src.Addr(), dst.Addr(), protocolTCP, segment), comment)
+}
+
+// Close closes the underlying file
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.w.Close()
+}
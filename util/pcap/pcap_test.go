@@ -0,0 +1,87 @@
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type nopCloser struct {
+	*bytes.Buffer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// blocks splits a pcapng file into block types and bodies
+func blocks(t *testing.T, b []byte) ([]uint32, [][]byte) {
+	var types []uint32
+	var bodies [][]byte
+	for len(b) > 0 {
+		blockType := binary.LittleEndian.Uint32(b)
+		length := binary.LittleEndian.Uint32(b[4:])
+		assert.Equal(t, length, binary.LittleEndian.Uint32(b[length-4:]))
+		types = append(types, blockType)
+		bodies = append(bodies, b[8:length-4])
+		b = b[length:]
+	}
+	return types, bodies
+}
+
+func TestPcapWriteUDP(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(nopCloser{&buf}, "q test")
+	assert.Nil(t, err)
+
+	client := netip.MustParseAddrPort("192.0.2.1:40000")
+	server := netip.MustParseAddrPort("192.0.2.53:53")
+	payload := []byte{0x12, 0x34, 0x01}
+	assert.Nil(t, w.WriteUDP(time.Unix(1700000000, 0), client, server, payload, "decrypted"))
+	assert.Nil(t, w.Close())
+
+	types, bodies := blocks(t, buf.Bytes())
+	assert.Equal(t, []uint32{blockSectionHeader, blockInterfaceDescription, blockEnhancedPacket}, types)
+	assert.Equal(t, uint16(LinkTypeRaw), binary.LittleEndian.Uint16(bodies[1]))
+
+	epb := bodies[2]
+	assert.Equal(t, uint64(1700000000*1000000), uint64(binary.LittleEndian.Uint32(epb[4:]))<<32|uint64(binary.LittleEndian.Uint32(epb[8:])))
+	length := binary.LittleEndian.Uint32(epb[12:])
+	assert.Equal(t, uint32(20+8+len(payload)), length)
+	packet := epb[20 : 20+length]
+	assert.Contains(t, string(epb[20+length:]), "decrypted")
+
+	// IP and UDP checksums verify to zero
+	assert.Equal(t, uint16(0), checksum(0, packet[:20]))
+	pseudo := append(append(client.Addr().AsSlice(), server.Addr().AsSlice()...), 0, protocolUDP, 0, byte(8+len(payload)))
+	assert.Equal(t, uint16(0), checksum(checksum(0, pseudo)^0xFFFF, packet[20:]))
+	assert.Equal(t, payload, packet[28:])
+}
+
+func TestPcapWriteTCPSequence(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(nopCloser{&buf}, "")
+	assert.Nil(t, err)
+
+	client := netip.MustParseAddrPort("[2001:db8::1]:40000")
+	server := netip.MustParseAddrPort("[2001:db8::53]:53")
+	assert.Nil(t, w.WriteTCP(time.Now(), client, server, make([]byte, 30), ""))
+	assert.Nil(t, w.WriteTCP(time.Now(), server, client, make([]byte, 50), ""))
+	assert.Nil(t, w.WriteTCP(time.Now(), client, server, make([]byte, 30), ""))
+
+	_, bodies := blocks(t, buf.Bytes())
+	seqAck := func(epb []byte) (uint32, uint32) {
+		segment := epb[20+40:]
+		return binary.BigEndian.Uint32(segment[4:]), binary.BigEndian.Uint32(segment[8:])
+	}
+	seq, ack := seqAck(bodies[2])
+	assert.Equal(t, []uint32{1, 1}, []uint32{seq, ack})
+	seq, ack = seqAck(bodies[3])
+	assert.Equal(t, []uint32{1, 31}, []uint32{seq, ack})
+	seq, ack = seqAck(bodies[4])
+	assert.Equal(t, []uint32{31, 51}, []uint32{seq, ack})
+}
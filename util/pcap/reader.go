@@ -0,0 +1,302 @@
+package pcap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/netip"
+	"os"
+	"time"
+)
+
+// Classic pcap magic numbers for microsecond and nanosecond timestamps
+const (
+	magicMicroseconds = 0xA1B2C3D4
+	magicNanoseconds  = 0xA1B23C4D
+)
+
+// pcapng block types that are only read
+const blockSimplePacket = 0x00000003
+
+// optTSResol is the if_tsresol option of an interface description block
+const optTSResol = 9
+
+// Link types with an IP packet behind a fixed size header
+const (
+	linkTypeNull     = 0
+	linkTypeEthernet = 1
+	linkTypeLoop     = 108
+	linkTypeLinuxSLL = 113
+	linkTypeIPv4     = 228
+	linkTypeIPv6     = 229
+	linkTypeSLL2     = 276
+)
+
+// Packet is a UDP datagram or TCP segment read from a capture
+type Packet struct {
+	Time     time.Time
+	Src, Dst netip.AddrPort
+	TCP      bool
+	Payload  []byte
+}
+
+// iface is the link type and timestamp resolution of a pcapng interface
+type iface struct {
+	linkType uint16
+	tsUnits  uint64 // timestamp units per second
+}
+
+// time converts a timestamp in the interface's units to a time
+func (i iface) time(ts uint64) time.Time {
+	if i.tsUnits == 0 {
+		return time.Unix(0, 0)
+	}
+	frac := ts % i.tsUnits
+	return time.Unix(int64(ts/i.tsUnits), int64(float64(frac)*1e9/float64(i.tsUnits)))
+}
+
+// Reader reads UDP and TCP packets from a pcap or pcapng file
+type Reader struct {
+	r      *bufio.Reader
+	closer io.Closer
+
+	ng     bool
+	order  binary.ByteOrder
+	ifaces []iface // pcapng interfaces, or the single classic pcap link type
+}
+
+// Open opens a pcap or pcapng file at path
+func Open(path string) (*Reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening pcap file %s: %w", path, err)
+	}
+	r, err := NewReader(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	r.closer = file
+	return r, nil
+}
+
+// NewReader returns a Reader for a pcap or pcapng stream, detected from its first bytes
+func NewReader(r io.Reader) (*Reader, error) {
+	pr := &Reader{r: bufio.NewReader(r)}
+	magic, err := pr.r.Peek(4)
+	if err != nil {
+		return nil, fmt.Errorf("reading pcap header: %w", err)
+	}
+
+	if binary.LittleEndian.Uint32(magic) == blockSectionHeader {
+		pr.ng = true
+		return pr, nil // the section header is read as the first block
+	}
+
+	var header [24]byte
+	if _, err := io.ReadFull(pr.r, header[:]); err != nil {
+		return nil, fmt.Errorf("reading pcap header: %w", err)
+	}
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		switch order.Uint32(header[:4]) {
+		case magicMicroseconds:
+			pr.ifaces = []iface{{linkType: uint16(order.Uint32(header[20:])), tsUnits: 1e6}}
+		case magicNanoseconds:
+			pr.ifaces = []iface{{linkType: uint16(order.Uint32(header[20:])), tsUnits: 1e9}}
+		default:
+			continue
+		}
+		pr.order = order
+		return pr, nil
+	}
+	return nil, errors.New("not a pcap or pcapng file")
+}
+
+// Next returns the next UDP or TCP packet, skipping other packets, or io.EOF at the end of the file
+func (r *Reader) Next() (*Packet, error) {
+	for {
+		var t time.Time
+		var data []byte
+		var linkType uint16
+		var err error
+		if r.ng {
+			t, data, linkType, err = r.nextBlock()
+		} else {
+			t, data, linkType, err = r.nextRecord()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if data == nil {
+			continue
+		}
+
+		if p := decodeLink(linkType, data); p != nil {
+			p.Time = t
+			return p, nil
+		}
+	}
+}
+
+// nextRecord reads a classic pcap record
+func (r *Reader) nextRecord() (time.Time, []byte, uint16, error) {
+	var header [16]byte
+	if _, err := io.ReadFull(r.r, header[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return time.Time{}, nil, 0, fmt.Errorf("reading pcap record: %w", err)
+		}
+		return time.Time{}, nil, 0, err
+	}
+	data := make([]byte, r.order.Uint32(header[8:]))
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		return time.Time{}, nil, 0, fmt.Errorf("reading pcap record: %w", err)
+	}
+
+	i := r.ifaces[0]
+	ts := uint64(r.order.Uint32(header[0:]))*i.tsUnits + uint64(r.order.Uint32(header[4:]))
+	return i.time(ts), data, i.linkType, nil
+}
+
+// nextBlock reads a pcapng block, returning packet data for packet blocks and nil data for others
+func (r *Reader) nextBlock() (time.Time, []byte, uint16, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r.r, header[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return time.Time{}, nil, 0, fmt.Errorf("reading pcapng block: %w", err)
+		}
+		return time.Time{}, nil, 0, err
+	}
+
+	blockType := binary.LittleEndian.Uint32(header[:4])
+	if blockType == blockSectionHeader {
+		// The byte order magic following the header sets the order for the whole section
+		var bom [4]byte
+		if _, err := io.ReadFull(r.r, bom[:]); err != nil {
+			return time.Time{}, nil, 0, fmt.Errorf("reading pcapng section header: %w", err)
+		}
+		if binary.LittleEndian.Uint32(bom[:]) == byteOrderMagic {
+			r.order = binary.LittleEndian
+		} else if binary.BigEndian.Uint32(bom[:]) == byteOrderMagic {
+			r.order = binary.BigEndian
+		} else {
+			return time.Time{}, nil, 0, errors.New("invalid pcapng byte order magic")
+		}
+		r.ifaces = nil
+		length := r.order.Uint32(header[4:])
+		if length < 16 {
+			return time.Time{}, nil, 0, fmt.Errorf("invalid pcapng section header length %d", length)
+		}
+		_, err := r.r.Discard(int(length) - 12)
+		return time.Time{}, nil, 0, err
+	}
+
+	length := r.order.Uint32(header[4:])
+	if length < 12 || length%4 != 0 {
+		return time.Time{}, nil, 0, fmt.Errorf("invalid pcapng block length %d", length)
+	}
+	body := make([]byte, length-8)
+	if _, err := io.ReadFull(r.r, body); err != nil {
+		return time.Time{}, nil, 0, fmt.Errorf("reading pcapng block: %w", err)
+	}
+	body = body[:len(body)-4] // trailing length
+
+	switch blockType {
+	case blockInterfaceDescription:
+		if len(body) < 8 {
+			return time.Time{}, nil, 0, errors.New("short pcapng interface description block")
+		}
+		i := iface{linkType: r.order.Uint16(body), tsUnits: 1e6}
+		r.forEachOption(body[8:], func(code uint16, value []byte) {
+			if code == optTSResol && len(value) == 1 {
+				if value[0]&0x80 != 0 {
+					i.tsUnits = 1 << (value[0] & 0x7F)
+				} else {
+					i.tsUnits = uint64(math.Pow10(int(value[0])))
+				}
+			}
+		})
+		r.ifaces = append(r.ifaces, i)
+	case blockEnhancedPacket:
+		if len(body) < 20 {
+			return time.Time{}, nil, 0, errors.New("short pcapng enhanced packet block")
+		}
+		id := r.order.Uint32(body)
+		capLen := r.order.Uint32(body[12:])
+		if int(id) >= len(r.ifaces) || int(capLen) > len(body)-20 {
+			return time.Time{}, nil, 0, errors.New("invalid pcapng enhanced packet block")
+		}
+		i := r.ifaces[id]
+		ts := uint64(r.order.Uint32(body[4:]))<<32 | uint64(r.order.Uint32(body[8:]))
+		return i.time(ts), body[20 : 20+capLen], i.linkType, nil
+	case blockSimplePacket:
+		if len(r.ifaces) == 0 || len(body) < 4 {
+			return time.Time{}, nil, 0, errors.New("invalid pcapng simple packet block")
+		}
+		data := body[4:]
+		if origLen := int(r.order.Uint32(body)); origLen < len(data) {
+			data = data[:origLen]
+		}
+		return time.Time{}, data, r.ifaces[0].linkType, nil
+	}
+	return time.Time{}, nil, 0, nil
+}
+
+// forEachOption calls fn with each option in a pcapng options list
+func (r *Reader) forEachOption(b []byte, fn func(code uint16, value []byte)) {
+	for len(b) >= 4 {
+		code, length := r.order.Uint16(b), int(r.order.Uint16(b[2:]))
+		if code == optEndOfOpt || 4+length > len(b) {
+			return
+		}
+		fn(code, b[4:4+length])
+		b = b[min(len(b), 4+length+pad4(length)):]
+	}
+}
+
+// Close closes the underlying file if the Reader was created by Open
+func (r *Reader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// decodeLink strips the link layer header and decodes the IP packet behind it
+func decodeLink(linkType uint16, data []byte) *Packet {
+	switch linkType {
+	case LinkTypeRaw, linkTypeIPv4, linkTypeIPv6:
+	case linkTypeNull, linkTypeLoop:
+		if len(data) < 4 {
+			return nil
+		}
+		data = data[4:]
+	case linkTypeEthernet:
+		if len(data) < 14 {
+			return nil
+		}
+		etherType, data := binary.BigEndian.Uint16(data[12:]), data[14:]
+		for (etherType == 0x8100 || etherType == 0x88A8) && len(data) >= 4 { // VLAN tags
+			etherType, data = binary.BigEndian.Uint16(data[2:]), data[4:]
+		}
+		if etherType != 0x0800 && etherType != 0x86DD {
+			return nil
+		}
+		return decodeIP(data)
+	case linkTypeLinuxSLL:
+		if len(data) < 16 {
+			return nil
+		}
+		data = data[16:]
+	case linkTypeSLL2:
+		if len(data) < 20 {
+			return nil
+		}
+		data = data[20:]
+	default:
+		return nil
+	}
+	return decodeIP(data)
+}
@@ -0,0 +1,88 @@
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPcapReaderRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(nopCloser{&buf}, "q test")
+	assert.Nil(t, err)
+
+	client := netip.MustParseAddrPort("192.0.2.1:40000")
+	server := netip.MustParseAddrPort("192.0.2.53:53")
+	queryTime := time.Unix(1700000000, 123456000)
+	assert.Nil(t, w.WriteUDP(queryTime, client, server, []byte{1, 2, 3}, "comment"))
+	assert.Nil(t, w.WriteTCP(queryTime, server, client, []byte{4, 5}, ""))
+	assert.Nil(t, w.Close())
+
+	r, err := NewReader(&buf)
+	assert.Nil(t, err)
+
+	p, err := r.Next()
+	assert.Nil(t, err)
+	assert.True(t, queryTime.Equal(p.Time))
+	assert.Equal(t, client, p.Src)
+	assert.Equal(t, server, p.Dst)
+	assert.False(t, p.TCP)
+	assert.Equal(t, []byte{1, 2, 3}, p.Payload)
+
+	p, err = r.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, server, p.Src)
+	assert.True(t, p.TCP)
+	assert.Equal(t, []byte{4, 5}, p.Payload)
+
+	_, err = r.Next()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestPcapReaderClassicEthernet(t *testing.T) {
+	src := netip.MustParseAddrPort("[2001:db8::1]:5353")
+	dst := netip.MustParseAddrPort("[ff02::fb]:5353")
+	segment := make([]byte, 8)
+	binary.BigEndian.PutUint16(segment[0:], src.Port())
+	binary.BigEndian.PutUint16(segment[2:], dst.Port())
+	binary.BigEndian.PutUint16(segment[4:], 10)
+	segment = append(segment, 0xAB, 0xCD)
+	frame := append(make([]byte, 12), 0x81, 0x00, 0x00, 0x05, 0x86, 0xDD) // VLAN 5 tagged IPv6
+	frame = append(frame, ipPacket(src.Addr(), dst.Addr(), protocolUDP, segment)...)
+
+	// Big endian classic pcap with nanosecond timestamps
+	var file []byte
+	file = binary.BigEndian.AppendUint32(file, magicNanoseconds)
+	file = binary.BigEndian.AppendUint16(file, 2)
+	file = binary.BigEndian.AppendUint16(file, 4)
+	file = append(file, make([]byte, 8)...)
+	file = binary.BigEndian.AppendUint32(file, 65535)
+	file = binary.BigEndian.AppendUint32(file, linkTypeEthernet)
+	file = binary.BigEndian.AppendUint32(file, 1700000000)
+	file = binary.BigEndian.AppendUint32(file, 42)
+	file = binary.BigEndian.AppendUint32(file, uint32(len(frame)))
+	file = binary.BigEndian.AppendUint32(file, uint32(len(frame)))
+	file = append(file, frame...)
+
+	r, err := NewReader(bytes.NewReader(file))
+	assert.Nil(t, err)
+	p, err := r.Next()
+	assert.Nil(t, err)
+	assert.True(t, time.Unix(1700000000, 42).Equal(p.Time))
+	assert.Equal(t, src, p.Src)
+	assert.Equal(t, dst, p.Dst)
+	assert.Equal(t, []byte{0xAB, 0xCD}, p.Payload)
+
+	_, err = r.Next()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestPcapReaderInvalid(t *testing.T) {
+	_, err := NewReader(bytes.NewReader(make([]byte, 24)))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,127 @@
+// Package resolvconf parses resolv.conf(5) stub resolver configuration
+package resolvconf
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Config is a stub resolver configuration
+type Config struct {
+	Nameservers []string
+	Search      []string
+
+	// Ndots is the number of dots a name needs to be tried as is before the search list
+	Ndots int
+
+	// Timeout is how long to wait for a reply from each nameserver
+	Timeout time.Duration
+
+	// Attempts is how many times to try the list of nameservers
+	Attempts int
+
+	// Rotate starts each query at the next nameserver instead of the first
+	Rotate bool
+}
+
+// Parse parses a resolv.conf file, using the glibc defaults and limits for options
+func Parse(r io.Reader) (*Config, error) {
+	c := &Config{
+		Ndots:    1,
+		Timeout:  5 * time.Second,
+		Attempts: 2,
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexAny(line, "#;"); i >= 0 {
+			line = line[:i]
+		}
+		f := strings.Fields(line)
+		if len(f) < 2 {
+			continue
+		}
+
+		switch f[0] {
+		case "nameserver":
+			c.Nameservers = append(c.Nameservers, f[1])
+		case "domain":
+			c.Search = []string{f[1]}
+		case "search":
+			c.Search = f[1:]
+		case "options":
+			c.setOptions(f[1:])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Load reads a resolv.conf file, then applies the LOCALDOMAIN and RES_OPTIONS environment variables like glibc
+func Load(path string) (*Config, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	c, err := Parse(file)
+	if err != nil {
+		return nil, err
+	}
+	if domains, ok := os.LookupEnv("LOCALDOMAIN"); ok {
+		c.Search = strings.Fields(domains)
+	}
+	c.setOptions(strings.Fields(os.Getenv("RES_OPTIONS")))
+	return c, nil
+}
+
+// setOptions applies options line values, ignoring unknown and invalid ones
+func (c *Config) setOptions(options []string) {
+	for _, o := range options {
+		name, value, _ := strings.Cut(o, ":")
+		n, err := strconv.Atoi(value)
+		switch {
+		case name == "rotate":
+			c.Rotate = true
+		case err != nil:
+			continue
+		case name == "ndots":
+			c.Ndots = min(max(n, 0), 15)
+		case name == "timeout":
+			c.Timeout = time.Duration(min(max(n, 1), 30)) * time.Second
+		case name == "attempts":
+			c.Attempts = min(max(n, 1), 5)
+		}
+	}
+}
+
+// Candidates returns the names to try for a name in order. Fully qualified names are only tried as is. Names with at
+// least ndots dots are tried as is before the search list, and other names after it.
+func (c *Config) Candidates(name string) []string {
+	if dns.IsFqdn(name) {
+		return []string{name}
+	}
+
+	var out []string
+	asIs := strings.Count(name, ".") >= c.Ndots
+	if asIs {
+		out = append(out, dns.Fqdn(name))
+	}
+	for _, domain := range c.Search {
+		out = append(out, dns.Fqdn(name+"."+strings.TrimSuffix(domain, ".")))
+	}
+	if !asIs {
+		out = append(out, dns.Fqdn(name))
+	}
+	return out
+}
@@ -0,0 +1,66 @@
+package resolvconf
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolvConfParse(t *testing.T) {
+	c, err := Parse(strings.NewReader(`# generated
+nameserver 192.0.2.1
+nameserver 2001:db8::1 ; secondary
+domain ignored.example
+search corp.example example.com
+options ndots:3 timeout:2 attempts:9 rotate edns0 ndots:x
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"192.0.2.1", "2001:db8::1"}, c.Nameservers)
+	assert.Equal(t, []string{"corp.example", "example.com"}, c.Search)
+	assert.Equal(t, 3, c.Ndots)
+	assert.Equal(t, 2*time.Second, c.Timeout)
+	assert.Equal(t, 5, c.Attempts)
+	assert.True(t, c.Rotate)
+
+	c, err = Parse(strings.NewReader("search a.example\ndomain b.example\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"b.example"}, c.Search)
+	assert.Equal(t, 1, c.Ndots)
+	assert.Equal(t, 5*time.Second, c.Timeout)
+	assert.Equal(t, 2, c.Attempts)
+	assert.False(t, c.Rotate)
+}
+
+func TestResolvConfCandidates(t *testing.T) {
+	c := &Config{Search: []string{"corp.example", "example.com."}, Ndots: 1}
+	assert.Equal(t, []string{"printer.corp.example.", "printer.example.com.", "printer."}, c.Candidates("printer"))
+	assert.Equal(t, []string{"host.lab.", "host.lab.corp.example.", "host.lab.example.com."}, c.Candidates("host.lab"))
+	assert.Equal(t, []string{"host.lab."}, c.Candidates("host.lab."))
+
+	c.Ndots = 2
+	assert.Equal(t, []string{"host.lab.corp.example.", "host.lab.example.com.", "host.lab."}, c.Candidates("host.lab"))
+
+	c.Search = nil
+	assert.Equal(t, []string{"printer."}, c.Candidates("printer"))
+}
+
+func TestResolvConfLoadEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resolv.conf")
+	assert.Nil(t, os.WriteFile(path, []byte("nameserver 192.0.2.1\nsearch example.com\noptions attempts:3\n"), 0600))
+
+	t.Setenv("LOCALDOMAIN", "a.example b.example")
+	t.Setenv("RES_OPTIONS", "ndots:4 timeout:40")
+	c, err := Load(path)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a.example", "b.example"}, c.Search)
+	assert.Equal(t, 4, c.Ndots)
+	assert.Equal(t, 30*time.Second, c.Timeout)
+	assert.Equal(t, 3, c.Attempts)
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing"))
+	assert.NotNil(t, err)
+}
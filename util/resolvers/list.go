@@ -0,0 +1,142 @@
+package resolvers
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/jedisct1/go-dnsstamps"
+)
+
+// ListEntry is a resolver from a list in the dnscrypt-proxy public-resolvers.md format
+type ListEntry struct {
+	Name        string
+	Description string
+
+	// Stamps are the entry's DNS stamps, which are alternative addresses for the same resolver
+	Stamps []string
+
+	// Protocol is the catalog transport name of the first stamp, or odoh, relay or unknown for servers that can't be
+	// queried directly
+	Protocol string
+
+	DNSSEC   bool
+	NoLog    bool
+	NoFilter bool
+	IPv6     bool
+}
+
+// ListFields are the ListEntry fields available to resolver match expressions
+var ListFields = []string{"name", "description", "protocol", "dnssec", "nolog", "nofilter", "ipv6"}
+
+// stampProtocols maps stamp protocols to catalog transport names
+var stampProtocols = map[dnsstamps.StampProtoType]string{
+	dnsstamps.StampProtoTypePlain:         "udp",
+	dnsstamps.StampProtoTypeDNSCrypt:      "dnscrypt",
+	dnsstamps.StampProtoTypeDoH:           "doh",
+	dnsstamps.StampProtoTypeTLS:           "dot",
+	dnsstamps.StampProtoTypeDoQ:           "doq",
+	dnsstamps.StampProtoTypeODoHTarget:    "odoh",
+	dnsstamps.StampProtoTypeDNSCryptRelay: "relay",
+	dnsstamps.StampProtoTypeODoHRelay:     "relay",
+}
+
+// Queryable returns true if the entry's protocol can be queried directly
+func (e *ListEntry) Queryable() bool {
+	return slices.Contains(Transports, e.Protocol)
+}
+
+// Fields returns the values of ListFields for the entry
+func (e *ListEntry) Fields() map[string]any {
+	return map[string]any{
+		"name":        e.Name,
+		"description": e.Description,
+		"protocol":    e.Protocol,
+		"dnssec":      e.DNSSEC,
+		"nolog":       e.NoLog,
+		"nofilter":    e.NoFilter,
+		"ipv6":        e.IPv6,
+	}
+}
+
+// LoadList reads a resolver list file
+func LoadList(path string) ([]ListEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries, err := ParseList(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return entries, nil
+}
+
+// ParseList parses a resolver list: ## name headings each followed by a description and sdns:// stamps.
+// Stamps that can't be parsed are skipped, and so are entries without any valid stamps.
+func ParseList(r io.Reader) ([]ListEntry, error) {
+	var entries []ListEntry
+	var cur *ListEntry
+	var description []string
+	finish := func() {
+		if cur != nil && len(cur.Stamps) > 0 {
+			cur.Description = strings.Join(description, " ")
+			entries = append(entries, *cur)
+		}
+		cur, description = nil, nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if name, ok := strings.CutPrefix(line, "## "); ok {
+			finish()
+			cur = &ListEntry{Name: strings.TrimSpace(name)}
+			continue
+		}
+		if cur == nil || line == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(line, dnsstamps.StampScheme) {
+			description = append(description, line)
+			continue
+		}
+		stamp, err := dnsstamps.NewServerStampFromString(line)
+		if err != nil {
+			continue
+		}
+		if len(cur.Stamps) == 0 {
+			cur.Protocol = stampProtocols[stamp.Proto]
+			if cur.Protocol == "" {
+				cur.Protocol = "unknown"
+			}
+			cur.DNSSEC = stamp.Props&dnsstamps.ServerInformalPropertyDNSSEC != 0
+			cur.NoLog = stamp.Props&dnsstamps.ServerInformalPropertyNoLog != 0
+			cur.NoFilter = stamp.Props&dnsstamps.ServerInformalPropertyNoFilter != 0
+			cur.IPv6 = strings.HasPrefix(stamp.ServerAddrStr, "[")
+		}
+		cur.Stamps = append(cur.Stamps, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	finish()
+	return entries, nil
+}
+
+// FindEntry returns the list entry with a name
+func FindEntry(entries []ListEntry, name string) *ListEntry {
+	for i := range entries {
+		if strings.EqualFold(entries[i].Name, name) {
+			return &entries[i]
+		}
+	}
+	return nil
+}
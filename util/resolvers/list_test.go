@@ -0,0 +1,88 @@
+package resolvers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jedisct1/go-dnsstamps"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolversParseList(t *testing.T) {
+	plain := dnsstamps.ServerStamp{
+		Proto:         dnsstamps.StampProtoTypePlain,
+		ServerAddrStr: "[2001:db8::53]:53",
+		Props:         dnsstamps.ServerInformalPropertyDNSSEC | dnsstamps.ServerInformalPropertyNoLog,
+	}
+	relay := dnsstamps.ServerStamp{Proto: dnsstamps.StampProtoTypeDNSCryptRelay, ServerAddrStr: "192.0.2.1:443"}
+
+	list := `# public-resolvers
+
+This is an extensive list of public DNS resolvers.
+
+--
+
+## adguard-dns
+
+Remove ads and protect your computer from malware
+(over DNSCrypt)
+
+sdns://AQMAAAAAAAAAETk0LjE0MC4xNC4xNDo1NDQzINErR_JS3PLCu_iZEIbq95zkSV2LFsigxDIuUso_OQhzIjIuZG5zY3J5cHQuZGVmYXVsdC5uczEuYWRndWFyZC5jb20
+
+## cloudflare
+
+Cloudflare DNS (anycast) - aka 1.1.1.1 / 1.0.0.1
+
+sdns://AgcAAAAAAAAADjEwNC4xNi4yNDguMjQ5ABJjbG91ZGZsYXJlLWRucy5jb20A
+sdns://AgcAAAAAAAAADjEwNC4xNi4yNDguMjQ5ABJjbG91ZGZsYXJlLWRucy5jb20FL3Rlc3Q
+
+## broken
+
+sdns://invalid
+
+## example-ipv6
+
+Plain DNS over IPv6
+
+` + plain.String() + `
+
+## anon-example
+
+` + relay.String() + "\n"
+
+	entries, err := ParseList(strings.NewReader(list))
+	assert.Nil(t, err)
+	assert.Len(t, entries, 4)
+
+	assert.Equal(t, "adguard-dns", entries[0].Name)
+	assert.Equal(t, "Remove ads and protect your computer from malware (over DNSCrypt)", entries[0].Description)
+	assert.Equal(t, "dnscrypt", entries[0].Protocol)
+	assert.True(t, entries[0].DNSSEC)
+	assert.True(t, entries[0].NoLog)
+	assert.False(t, entries[0].NoFilter)
+
+	cloudflare := FindEntry(entries, "Cloudflare")
+	assert.NotNil(t, cloudflare)
+	assert.Equal(t, "doh", cloudflare.Protocol)
+	assert.Len(t, cloudflare.Stamps, 2)
+	assert.True(t, cloudflare.NoLog)
+	assert.True(t, cloudflare.NoFilter)
+
+	assert.Nil(t, FindEntry(entries, "broken"))
+
+	ipv6 := FindEntry(entries, "example-ipv6")
+	assert.Equal(t, map[string]any{
+		"name":        "example-ipv6",
+		"description": "Plain DNS over IPv6",
+		"protocol":    "udp",
+		"dnssec":      true,
+		"nolog":       true,
+		"nofilter":    false,
+		"ipv6":        true,
+	}, ipv6.Fields())
+	assert.True(t, ipv6.Queryable())
+
+	anon := FindEntry(entries, "anon-example")
+	assert.Equal(t, "relay", anon.Protocol)
+	assert.False(t, anon.Queryable())
+}
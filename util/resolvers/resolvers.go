@@ -0,0 +1,166 @@
+// Package resolvers is a catalog of well-known public resolvers
+package resolvers
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Resolver is a public resolver and its server address for each transport it supports
+type Resolver struct {
+	Name        string
+	Description string
+
+	// Servers are addresses in q's server syntax by transport name (udp, tcp, dot, doh, doq or dnscrypt)
+	Servers map[string]string
+}
+
+// Transports are the catalog transport names, in order of preference when no transport is given
+var Transports = []string{"doh", "dot", "doq", "dnscrypt", "udp", "tcp"}
+
+// transportAliases maps q's server URL schemes to catalog transport names
+var transportAliases = map[string]string{
+	"plain": "udp",
+	"tls":   "dot",
+	"https": "doh",
+	"http":  "doh",
+	"quic":  "doq",
+	"sdns":  "dnscrypt",
+}
+
+// Catalog is the list of public resolvers
+var Catalog = []Resolver{
+	{
+		Name:        "cloudflare",
+		Description: "Cloudflare 1.1.1.1",
+		Servers: map[string]string{
+			"udp": "1.1.1.1",
+			"tcp": "tcp://1.1.1.1",
+			"dot": "tls://one.one.one.one",
+			"doh": "https://cloudflare-dns.com/dns-query",
+		},
+	},
+	{
+		Name:        "google",
+		Description: "Google Public DNS",
+		Servers: map[string]string{
+			"udp": "8.8.8.8",
+			"tcp": "tcp://8.8.8.8",
+			"dot": "tls://dns.google",
+			"doh": "https://dns.google/dns-query",
+		},
+	},
+	{
+		Name:        "quad9",
+		Description: "Quad9 with malware blocking and DNSSEC validation",
+		Servers: map[string]string{
+			"udp": "9.9.9.9",
+			"tcp": "tcp://9.9.9.9",
+			"dot": "tls://dns.quad9.net",
+			"doh": "https://dns.quad9.net/dns-query",
+			"doq": "quic://dns.quad9.net",
+		},
+	},
+	{
+		Name:        "adguard",
+		Description: "AdGuard DNS with ad and tracker blocking",
+		Servers: map[string]string{
+			"udp":      "94.140.14.14",
+			"tcp":      "tcp://94.140.14.14",
+			"dot":      "tls://dns.adguard-dns.com",
+			"doh":      "https://dns.adguard-dns.com/dns-query",
+			"doq":      "quic://dns.adguard-dns.com",
+			"dnscrypt": "sdns://AQMAAAAAAAAAETk0LjE0MC4xNC4xNDo1NDQzINErR_JS3PLCu_iZEIbq95zkSV2LFsigxDIuUso_OQhzIjIuZG5zY3J5cHQuZGVmYXVsdC5uczEuYWRndWFyZC5jb20",
+		},
+	},
+	{
+		Name:        "opendns",
+		Description: "Cisco OpenDNS",
+		Servers: map[string]string{
+			"udp": "208.67.222.222",
+			"tcp": "tcp://208.67.222.222",
+			"doh": "https://doh.opendns.com/dns-query",
+		},
+	},
+	{
+		Name:        "mullvad",
+		Description: "Mullvad DNS without filtering",
+		Servers: map[string]string{
+			"dot": "tls://dns.mullvad.net",
+			"doh": "https://dns.mullvad.net/dns-query",
+		},
+	},
+	{
+		Name:        "controld",
+		Description: "Control D free DNS without filtering",
+		Servers: map[string]string{
+			"udp": "76.76.2.0",
+			"tcp": "tcp://76.76.2.0",
+			"dot": "tls://p0.freedns.controld.com",
+			"doh": "https://freedns.controld.com/p0",
+			"doq": "quic://p0.freedns.controld.com",
+		},
+	},
+}
+
+// Find returns the catalog resolver with a name
+func Find(name string) *Resolver {
+	for i := range Catalog {
+		if strings.EqualFold(Catalog[i].Name, name) {
+			return &Catalog[i]
+		}
+	}
+	return nil
+}
+
+// Default returns the server for a resolver's most preferred transport
+func (r *Resolver) Default() string {
+	for _, t := range Transports {
+		if server, ok := r.Servers[t]; ok {
+			return server
+		}
+	}
+	return ""
+}
+
+// Supported returns the transports a resolver supports in preference order
+func (r *Resolver) Supported() []string {
+	var out []string
+	for _, t := range Transports {
+		if _, ok := r.Servers[t]; ok {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// Lookup returns the server for a catalog name like quad9 or quad9/doq, or false if the name isn't in the catalog
+func Lookup(alias string) (string, bool, error) {
+	name, transport, hasTransport := strings.Cut(alias, "/")
+	r := Find(name)
+	if r == nil {
+		return "", false, nil
+	}
+	if !hasTransport {
+		return r.Default(), true, nil
+	}
+
+	transport = strings.ToLower(transport)
+	if t, ok := transportAliases[transport]; ok {
+		transport = t
+	}
+	if !slices.Contains(Transports, transport) {
+		return "", true, fmt.Errorf("unknown transport %s (expected one of %s)", transport, strings.Join(Transports, ", "))
+	}
+	server, ok := r.Servers[transport]
+	if !ok {
+		return "", true, fmt.Errorf("%s doesn't support %s (supported: %s)", r.Name, transport, strings.Join(r.Supported(), ", "))
+	}
+	return server, true, nil
+}
+
+// Fallback returns the server used when none is given or found in the system configuration
+func Fallback() string {
+	return Find("cloudflare").Servers["doh"]
+}
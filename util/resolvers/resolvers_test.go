@@ -0,0 +1,53 @@
+package resolvers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolversLookup(t *testing.T) {
+	for alias, want := range map[string]string{
+		"cloudflare":    "https://cloudflare-dns.com/dns-query",
+		"Quad9":         "https://dns.quad9.net/dns-query",
+		"quad9/doq":     "quic://dns.quad9.net",
+		"quad9/quic":    "quic://dns.quad9.net",
+		"google/dot":    "tls://dns.google",
+		"google/plain":  "8.8.8.8",
+		"adguard/sdns":  Find("adguard").Servers["dnscrypt"],
+		"controld/UDP":  "76.76.2.0",
+		"mullvad/https": "https://dns.mullvad.net/dns-query",
+	} {
+		server, ok, err := Lookup(alias)
+		assert.Nil(t, err, alias)
+		assert.True(t, ok, alias)
+		assert.Equal(t, want, server, alias)
+	}
+
+	for _, alias := range []string{"1.1.1.1", "https://dns.google/dns-query", "tls://dns.quad9.net", "example"} {
+		_, ok, err := Lookup(alias)
+		assert.Nil(t, err, alias)
+		assert.False(t, ok, alias)
+	}
+
+	_, ok, err := Lookup("google/doq")
+	assert.True(t, ok)
+	assert.ErrorContains(t, err, "google doesn't support doq (supported: doh, dot, udp, tcp)")
+	_, _, err = Lookup("quad9/carrier-pigeon")
+	assert.ErrorContains(t, err, "unknown transport carrier-pigeon")
+}
+
+func TestResolversCatalog(t *testing.T) {
+	names := map[string]bool{}
+	for _, r := range Catalog {
+		assert.False(t, names[r.Name], r.Name)
+		names[r.Name] = true
+		assert.Equal(t, strings.ToLower(r.Name), r.Name)
+		assert.NotEmpty(t, r.Default(), r.Name)
+		for transport := range r.Servers {
+			assert.Contains(t, Transports, transport, r.Name)
+		}
+	}
+	assert.Equal(t, "https://cloudflare-dns.com/dns-query", Fallback())
+}
@@ -0,0 +1,120 @@
+package tls
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/charmbracelet/log"
+)
+
+// persistedSession is the on-disk representation of a TLS session ticket
+type persistedSession struct {
+	Ticket []byte `json:"ticket"`
+	State  []byte `json:"state"`
+}
+
+// SessionCache is a tls.ClientSessionCache that optionally persists session tickets to a file
+type SessionCache struct {
+	path     string
+	mu       sync.Mutex
+	sessions map[string]*tls.ClientSessionState
+}
+
+// NewSessionCache creates a session cache, loading previously saved tickets from path if set
+func NewSessionCache(path string) *SessionCache {
+	c := &SessionCache{
+		path:     path,
+		sessions: make(map[string]*tls.ClientSessionState),
+	}
+	if path != "" {
+		c.load()
+	}
+	return c
+}
+
+// Get returns the session state stored for a session key
+func (c *SessionCache) Get(sessionKey string) (*tls.ClientSessionState, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cs, ok := c.sessions[sessionKey]
+	if ok {
+		log.Debugf("Found TLS session ticket for %s", sessionKey)
+	}
+	return cs, ok
+}
+
+// Put stores a session state for a session key, or removes it if cs is nil
+func (c *SessionCache) Put(sessionKey string, cs *tls.ClientSessionState) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cs == nil {
+		delete(c.sessions, sessionKey)
+	} else {
+		log.Debugf("Storing TLS session ticket for %s", sessionKey)
+		c.sessions[sessionKey] = cs
+	}
+	if c.path != "" {
+		c.save()
+	}
+}
+
+// load reads session tickets from the cache file
+func (c *SessionCache) load() {
+	b, err := os.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		log.Warnf("Could not read TLS session file %s: %s", c.path, err)
+		return
+	}
+
+	var persisted map[string]persistedSession
+	if err := json.Unmarshal(b, &persisted); err != nil {
+		log.Warnf("Could not parse TLS session file %s: %s", c.path, err)
+		return
+	}
+
+	for key, p := range persisted {
+		state, err := tls.ParseSessionState(p.State)
+		if err != nil {
+			log.Debugf("Skipping invalid TLS session for %s: %s", key, err)
+			continue
+		}
+		cs, err := tls.NewResumptionState(p.Ticket, state)
+		if err != nil {
+			log.Debugf("Skipping invalid TLS session for %s: %s", key, err)
+			continue
+		}
+		c.sessions[key] = cs
+	}
+	log.Debugf("Loaded %d TLS session tickets from %s", len(c.sessions), c.path)
+}
+
+// save writes session tickets to the cache file
+func (c *SessionCache) save() {
+	persisted := make(map[string]persistedSession, len(c.sessions))
+	for key, cs := range c.sessions {
+		ticket, state, err := cs.ResumptionState()
+		if err != nil || state == nil {
+			continue
+		}
+		stateBytes, err := state.Bytes()
+		if err != nil {
+			log.Debugf("Could not serialize TLS session for %s: %s", key, err)
+			continue
+		}
+		persisted[key] = persistedSession{Ticket: ticket, State: stateBytes}
+	}
+
+	b, err := json.Marshal(persisted)
+	if err != nil {
+		log.Warnf("Could not serialize TLS sessions: %s", err)
+		return
+	}
+	if err := os.WriteFile(c.path, b, 0600); err != nil {
+		log.Warnf("Could not write TLS session file %s: %s", c.path, err)
+	}
+}
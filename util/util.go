@@ -66,3 +66,27 @@ func MustWritef(out io.Writer, format string, a ...interface{}) {
 		log.Fatal(err)
 	}
 }
+
+// Unescape returns the bytes of a label or character string in presentation format, decoding \DDD and \X escapes
+func Unescape(s string) []byte {
+	var out []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			out = append(out, s[i])
+			continue
+		}
+		i++
+		if i+2 < len(s) && isDigit(s[i]) && isDigit(s[i+1]) && isDigit(s[i+2]) {
+			out = append(out, (s[i]-'0')*100+(s[i+1]-'0')*10+(s[i+2]-'0'))
+			i += 2
+			continue
+		}
+		out = append(out, s[i])
+	}
+	return out
+}
+
+// isDigit returns true if b is an ASCII digit
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
@@ -29,3 +29,9 @@ func TestUtilColor(t *testing.T) {
 	assert.Equal(t, "\033[1;31mfoo\033[0m", Color("red", "foo"))
 	assert.Equal(t, "\033[1;37mfoo\033[0m", Color("white", "foo"))
 }
+
+func TestUtilUnescape(t *testing.T) {
+	assert.Equal(t, []byte{'D', 'N', 'S', 'C', 0, 1, '"', '\\'}, Unescape(`DNSC\000\001\"\\`))
+	assert.Equal(t, "My Printer.", string(Unescape(`My\032Printer\.`)))
+	assert.Equal(t, "A", string(Unescape(`\065`)))
+}
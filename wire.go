@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/miekg/dns"
+
+	"github.com/natesales/q/output"
+	"github.com/natesales/q/transport"
+)
+
+// sendWire is the packed --send-wire message, or nil to build queries
+var sendWire []byte
+
+// wireEncodings are the base64 variants tried when decoding a message, DoH's unpadded base64url first
+var wireEncodings = []*base64.Encoding{
+	base64.RawURLEncoding,
+	base64.URLEncoding,
+	base64.RawStdEncoding,
+	base64.StdEncoding,
+}
+
+// decodeWire decodes a hex or base64 wire format DNS message, or the dns parameter of a DoH GET URL, and returns it
+// with its packed bytes
+func decodeWire(s string) (*dns.Msg, []byte, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "dns=") || strings.Contains(s, "?dns=") || strings.Contains(s, "&dns=") {
+		_, query, _ := strings.Cut(s, "?")
+		if query == "" {
+			query = s
+		}
+		values, err := url.ParseQuery(query)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parsing DoH URL: %s", err)
+		}
+		s = values.Get("dns")
+	}
+
+	// Hex dumps are often split by spaces or colons and prefixed with 0x
+	hexStr := strings.TrimPrefix(strings.ToLower(s), "0x")
+	hexStr = strings.NewReplacer(" ", "", ":", "", "\n", "", "\t", "").Replace(hexStr)
+	if b, err := hex.DecodeString(hexStr); err == nil {
+		msg := new(dns.Msg)
+		if err := msg.Unpack(b); err == nil {
+			return msg, b, nil
+		}
+	}
+
+	var unpackErr error
+	for _, encoding := range wireEncodings {
+		b, err := encoding.DecodeString(s)
+		if err != nil {
+			continue
+		}
+		msg := new(dns.Msg)
+		if err := msg.Unpack(b); err != nil {
+			unpackErr = err
+			continue
+		}
+		return msg, b, nil
+	}
+	if unpackErr != nil {
+		return nil, nil, fmt.Errorf("unpacking DNS message: %s", unpackErr)
+	}
+	return nil, nil, errors.New("message is not valid hex or base64")
+}
+
+// decodeMessage prints the message given by --decode
+func decodeMessage(out io.Writer) error {
+	msg, b, err := decodeWire(opts.Decode)
+	if err != nil {
+		return fmt.Errorf("decoding message: %s", err)
+	}
+
+	// Queries have no answers, so always show the question
+	opts.ShowQuestion = true
+	return printEntries(output.Printer{Out: out, Opts: &opts}, []*output.Entry{{
+		Replies: []*dns.Msg{msg},
+		Server:  "input",
+		Wire:    []transport.Wire{{Reply: b}},
+	}})
+}
+
+// exchange sends a query with a transport, or the --send-wire message as is if the transport can send it unchanged,
+// and returns the reply with the packed query and reply if the transport records them
+func exchange(txp transport.Transport, msg *dns.Msg) (*dns.Msg, transport.Wire, error) {
+	if sendWire != nil {
+		if w, ok := txp.(transport.WireTransport); ok {
+			buf, err := w.ExchangeWire(sendWire)
+			if !errors.Is(err, transport.ErrWireUnsupported) {
+				wire := transport.Wire{Query: sendWire, Reply: buf}
+				if err != nil {
+					return nil, wire, err
+				}
+				reply := new(dns.Msg)
+				if err := reply.Unpack(buf); err != nil {
+					return nil, wire, fmt.Errorf("unpacking reply: %s", err)
+				}
+				return reply, wire, nil
+			}
+		}
+		log.Debugf("Transport can't send the message as is, sending it repacked")
+	}
+
+	reply, err := txp.Exchange(msg)
+	var wire transport.Wire
+	if r, ok := txp.(wireRecorder); ok {
+		wire = r.LastWire()
+	}
+	return reply, wire, err
+}
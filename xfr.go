@@ -19,13 +19,13 @@ var (
 	all     []dns.RR
 )
 
-func axfr(label, server string) []dns.RR {
+func axfr(label, server string) ([]dns.RR, error) {
 	t := new(dns.Transfer)
 	m := new(dns.Msg)
 	m.SetAxfr(dns.Fqdn(label))
 	ch, err := t.In(m, server)
 	if err != nil {
-		log.Fatalf("Failed to transfer zone: %s", err)
+		return nil, fmt.Errorf("transferring zone %s: %w", label, err)
 	}
 
 	var rrs []dns.RR
@@ -37,11 +37,11 @@ func axfr(label, server string) []dns.RR {
 		rrs = append(rrs, env.RR...)
 	}
 
-	return rrs
+	return rrs, nil
 }
 
 // RecAXFR performs an AXFR on the given label and all of its children and writes the zone file to disk
-func RecAXFR(label, server string, out io.Writer) []dns.RR {
+func RecAXFR(label, server string, out io.Writer) ([]dns.RR, error) {
 	util.MustWritef(out, "Attempting recursive AXFR for %s\n", label)
 
 	// Reset state
@@ -57,24 +57,29 @@ func RecAXFR(label, server string, out io.Writer) []dns.RR {
 	if _, err := os.Stat(dir); os.IsNotExist(err) {
 		err := os.MkdirAll(dir, 0755)
 		if err != nil {
-			log.Fatalf("creating recaxfr directory: %s", err)
+			return nil, fmt.Errorf("creating recaxfr directory: %w", err)
 		}
 	}
 
-	addToTree(label, dir, server, out)
+	if err := addToTree(label, dir, server, out); err != nil {
+		return nil, err
+	}
 	util.MustWritef(out, "AXFR complete, %d records saved to %s\n", len(all), dir)
 
-	return all
+	return all, nil
 }
 
-func addToTree(label, dir, server string, out io.Writer) {
+func addToTree(label, dir, server string, out io.Writer) error {
 	label = dns.Fqdn(label)
 	if queried[label] {
-		return
+		return nil
 	}
 	util.MustWritef(out, "AXFR %s\n", label)
 	queried[label] = true
-	rrs := axfr(label, server)
+	rrs, err := axfr(label, server)
+	if err != nil {
+		return err
+	}
 
 	// Write RRs to zone file
 	if len(rrs) > 0 {
@@ -87,14 +92,18 @@ func addToTree(label, dir, server string, out io.Writer) {
 			[]byte(zoneFile),
 			0644,
 		); err != nil {
-			log.Fatalf("Failed to write zone file: %s", err)
+			return fmt.Errorf("writing zone file: %w", err)
 		}
 	}
 
 	for _, rr := range rrs {
 		all = append(all, rr)
 		if _, ok := rr.(*dns.NS); ok {
-			addToTree(rr.Header().Name, dir, server, out)
+			if err := addToTree(rr.Header().Name, dir, server, out); err != nil {
+				return err
+			}
 		}
 	}
+
+	return nil
 }